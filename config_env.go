@@ -0,0 +1,441 @@
+package godump
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+/* Configuration from the environment
+ Every setting has a canonical lower case name, the environment loader looks them up as <PREFIX>_<NAME> in upper case:
+	GODUMP_HEAP=1                          -> GoDumpHeap
+	GODUMP_HEAP_THRESHOLD=512MiB           -> HeapDumpConfigs.HeapThresholdBytes
+	GODUMP_HEAP_THRESHOLD_PCT=80%          -> HeapDumpConfigs.HeapThresholdPercentage
+	GODUMP_HEAP_TIERS="warning=1GiB/1m, critical=2GiB/5m, emergency=3GiB"
+	                                       -> HeapDumpConfigs.HeapBytesTiers
+	GODUMP_HEAP_PCT_TIERS="warning=70%, critical=85%, emergency=95%"
+	                                       -> HeapDumpConfigs.HeapPercentageTiers
+	GODUMP_HEAP_PREFIX=heap                -> HeapDumpConfigs.HeapDumpPrefix
+	GODUMP_HEAP_METRIC=/gc/heap/goal:bytes -> HeapDumpConfigs.HeapMetric
+	GODUMP_GOROUTINE=1                     -> GoDumpGoroutine
+	GODUMP_GOROUTINE_THRESHOLD=5k          -> GoroutineDumpConfigs.GoroutineThreshold
+	GODUMP_GOROUTINE_TIERS="warning=5k, critical=20k/10m"
+	                                       -> GoroutineDumpConfigs.GoroutineTiers
+	GODUMP_HANG_TIME=90s                   -> GoroutineDumpConfigs.GoroutineHangingTimeMs
+	GODUMP_HANG_TIME_BY_STATE="sync.Mutex.Lock=10s; chan receive=5m; IO wait=never"
+	                                       -> GoroutineDumpConfigs.GoroutineHangingTimeByState
+	GODUMP_HANG_TIERS="warning=1m, critical=5m/10m"
+	                                       -> GoroutineDumpConfigs.GoroutineHangingTiers
+	GODUMP_GOROUTINE_GROWTH_WINDOW=5m      -> GoroutineDumpConfigs.GoroutineGrowthWindowMs
+	GODUMP_GOROUTINE_GROWTH_THRESHOLD=50   -> GoroutineDumpConfigs.GoroutineGrowthThreshold
+	GODUMP_GOROUTINE_GROWTH_TIERS="warning=50, critical=500"
+	                                       -> GoroutineDumpConfigs.GoroutineGrowthTiers
+	GODUMP_GOROUTINE_RULES="label=pool:workers > 10k; function=net/http.* > warning=50, critical=200"
+	                                       -> GoroutineDumpConfigs.GoroutineRules
+	GODUMP_HANG_IGNORE="function=main.(*pool).worker; state=IO wait"
+	                                       -> GoroutineDumpConfigs.HangIgnore
+	GODUMP_HANG_IGNORE_NO_DEFAULTS=1       -> GoroutineDumpConfigs.HangIgnoreNoDefaults
+	GODUMP_STALL_FRACTION=95%              -> GoroutineDumpConfigs.GoroutineStallFraction
+	GODUMP_STALL_SAMPLES=5                 -> GoroutineDumpConfigs.GoroutineStallSamples
+	GODUMP_STALL_PREFIX=stall              -> GoroutineDumpConfigs.GoroutineStallReportPrefix
+	GODUMP_GOROUTINE_SUMMARY_PREFIX=gsum   -> GoroutineDumpConfigs.GoroutineSummaryPrefix
+	GODUMP_GOROUTINE_PREFIX=goroutines     -> GoroutineDumpConfigs.GoroutineDumpPrefix
+	GODUMP_GC=1                            -> GoDumpGC
+	GODUMP_GC_CPU_FRACTION=30%             -> GCDumpConfigs.GCCPUFractionThreshold
+	GODUMP_GC_CYCLES_PER_MINUTE=120        -> GCDumpConfigs.GCCyclesPerMinuteThreshold
+	GODUMP_GC_PAUSE_P99=5ms                -> GCDumpConfigs.GCPauseP99ThresholdMs
+	GODUMP_GC_PREFIX=gc                    -> GCDumpConfigs.GCDumpPrefix
+	GODUMP_SCHED=1                         -> GoDumpSched
+	GODUMP_SCHED_LATENCY=10ms              -> SchedDumpConfigs.SchedLatencyThresholdMs
+	GODUMP_SCHED_LATENCY_QUANTILE=99%      -> SchedDumpConfigs.SchedLatencyQuantile
+	GODUMP_TICKER_LAG=100ms                -> SchedDumpConfigs.TickerLagThresholdMs
+	GODUMP_SCHED_SUSTAINED=30s             -> SchedDumpConfigs.SchedSustainedMs
+	GODUMP_OS=1                            -> GoDumpOS
+	GODUMP_THREAD_THRESHOLD=500            -> OSDumpConfigs.ThreadThreshold
+	GODUMP_THREAD_GROWTH_PER_MINUTE=20     -> OSDumpConfigs.ThreadGrowthPerMinute
+	GODUMP_THREADCREATE_THRESHOLD=1k       -> OSDumpConfigs.ThreadCreateThreshold
+	GODUMP_FD_THRESHOLD=10k                -> OSDumpConfigs.FDThreshold
+	GODUMP_FD_GROWTH_PER_MINUTE=100        -> OSDumpConfigs.FDGrowthPerMinute
+	GODUMP_OS_GROWTH_WINDOW=5m             -> OSDumpConfigs.OSGrowthWindowMs
+	GODUMP_OS_PREFIX=os                    -> OSDumpConfigs.OSDumpPrefix
+	GODUMP_CPU=1                           -> GoDumpCPU
+	GODUMP_CPU_THRESHOLD=90%               -> CPUDumpConfigs.CPUThresholdPercentage
+	GODUMP_CPU_SUSTAINED_INTERVALS=5       -> CPUDumpConfigs.CPUSustainedIntervals
+	GODUMP_CPU_PROFILE_DURATION=30s        -> CPUDumpConfigs.CPUProfileDurationMs
+	GODUMP_CPU_PREFIX=cpu                  -> CPUDumpConfigs.CPUProfilePrefix
+	GODUMP_NATIVE_MEMORY=1                 -> GoDumpNativeMemory
+	GODUMP_NATIVE_MEMORY_THRESHOLD=256MiB  -> NativeMemoryDumpConfigs.NativeMemoryThresholdBytes
+	GODUMP_NATIVE_MEMORY_PREFIX=native     -> NativeMemoryDumpConfigs.NativeMemoryDumpPrefix
+	GODUMP_CONTENTION=1                    -> GoDumpContention
+	GODUMP_MUTEX_WAIT_THRESHOLD=100ms      -> ContentionDumpConfigs.MutexWaitThresholdMs
+	GODUMP_BLOCK_WAIT_THRESHOLD=1s         -> ContentionDumpConfigs.BlockWaitThresholdMs
+	GODUMP_MUTEX_PROFILE_FRACTION=10       -> ContentionDumpConfigs.MutexProfileFraction
+	GODUMP_BLOCK_PROFILE_RATE=10us         -> ContentionDumpConfigs.BlockProfileRate
+	GODUMP_CONTENTION_TOP_SITES=20         -> ContentionDumpConfigs.ContentionTopSites
+	GODUMP_CONTENTION_PREFIX=contention    -> ContentionDumpConfigs.ContentionDumpPrefix
+	GODUMP_TRIGGER_RULES="heap > 1GiB && goroutines > 5k for 3 => heap_dump; pressure: gc_fraction > 30%"
+	                                       -> TriggerRules
+	GODUMP_INTERVAL=5s                     -> WatchdogIntervalMs
+	GODUMP_PATH=/dumps                     -> GoDumpPath
+ Settings that are not set keep the value from DefaultConfigs
+*/
+
+// DefaultEnvPrefix is used by ConfigFromEnv when the prefix is empty
+const DefaultEnvPrefix = "GODUMP"
+
+// configKey describes one setting shared by the configuration loaders
+type configKey struct {
+	name  string
+	apply func(configs *GoDumpConfigs, value string) error
+}
+
+func heapConfigs(configs *GoDumpConfigs) *DumpHeapConfigs {
+	if configs.HeapDumpConfigs == nil {
+		configs.HeapDumpConfigs = &DumpHeapConfigs{}
+	}
+	return configs.HeapDumpConfigs
+}
+
+func goroutineConfigs(configs *GoDumpConfigs) *DumpGoroutineConfigs {
+	if configs.GoroutineDumpConfigs == nil {
+		configs.GoroutineDumpConfigs = &DumpGoroutineConfigs{}
+	}
+	return configs.GoroutineDumpConfigs
+}
+
+func gcConfigs(configs *GoDumpConfigs) *DumpGCConfigs {
+	if configs.GCDumpConfigs == nil {
+		configs.GCDumpConfigs = &DumpGCConfigs{}
+	}
+	return configs.GCDumpConfigs
+}
+
+func schedConfigs(configs *GoDumpConfigs) *DumpSchedConfigs {
+	if configs.SchedDumpConfigs == nil {
+		configs.SchedDumpConfigs = &DumpSchedConfigs{}
+	}
+	return configs.SchedDumpConfigs
+}
+
+func osConfigs(configs *GoDumpConfigs) *DumpOSConfigs {
+	if configs.OSDumpConfigs == nil {
+		configs.OSDumpConfigs = &DumpOSConfigs{}
+	}
+	return configs.OSDumpConfigs
+}
+
+func cpuConfigs(configs *GoDumpConfigs) *DumpCPUConfigs {
+	if configs.CPUDumpConfigs == nil {
+		configs.CPUDumpConfigs = &DumpCPUConfigs{}
+	}
+	return configs.CPUDumpConfigs
+}
+
+func nativeMemoryConfigs(configs *GoDumpConfigs) *DumpNativeMemoryConfigs {
+	if configs.NativeMemoryDumpConfigs == nil {
+		configs.NativeMemoryDumpConfigs = &DumpNativeMemoryConfigs{}
+	}
+	return configs.NativeMemoryDumpConfigs
+}
+
+func contentionConfigs(configs *GoDumpConfigs) *DumpContentionConfigs {
+	if configs.ContentionDumpConfigs == nil {
+		configs.ContentionDumpConfigs = &DumpContentionConfigs{}
+	}
+	return configs.ContentionDumpConfigs
+}
+
+var configKeys = []configKey{
+	{"heap", func(configs *GoDumpConfigs, value string) (err error) {
+		configs.GoDumpHeap, err = parseBool(value)
+		return err
+	}},
+	{"heap_threshold", func(configs *GoDumpConfigs, value string) (err error) {
+		heapConfigs(configs).HeapThresholdBytes, err = parseSize(value)
+		return err
+	}},
+	{"heap_threshold_pct", func(configs *GoDumpConfigs, value string) (err error) {
+		heapConfigs(configs).HeapThresholdPercentage, err = parsePercentage(value)
+		return err
+	}},
+	{"heap_tiers", func(configs *GoDumpConfigs, value string) (err error) {
+		heapConfigs(configs).HeapBytesTiers, err = parseTiers(value, func(level string) (float64, error) {
+			size, err := parseSize(level)
+			return float64(size), err
+		})
+		return err
+	}},
+	{"heap_pct_tiers", func(configs *GoDumpConfigs, value string) (err error) {
+		heapConfigs(configs).HeapPercentageTiers, err = parseTiers(value, parsePercentage)
+		return err
+	}},
+	{"heap_prefix", func(configs *GoDumpConfigs, value string) error {
+		heapConfigs(configs).HeapDumpPrefix = &value
+		return nil
+	}},
+	{"heap_metric", func(configs *GoDumpConfigs, value string) error {
+		heapConfigs(configs).HeapMetric = strings.TrimSpace(value)
+		return nil
+	}},
+	{"goroutine", func(configs *GoDumpConfigs, value string) (err error) {
+		configs.GoDumpGoroutine, err = parseBool(value)
+		return err
+	}},
+	{"goroutine_threshold", func(configs *GoDumpConfigs, value string) (err error) {
+		goroutineConfigs(configs).GoroutineThreshold, err = parseCount(value)
+		return err
+	}},
+	{"goroutine_tiers", func(configs *GoDumpConfigs, value string) (err error) {
+		goroutineConfigs(configs).GoroutineTiers, err = parseTiers(value, parseCountLevel)
+		return err
+	}},
+	{"hang_time", func(configs *GoDumpConfigs, value string) (err error) {
+		goroutineConfigs(configs).GoroutineHangingTimeMs, err = parseDurationMs(value)
+		return err
+	}},
+	{"hang_time_by_state", func(configs *GoDumpConfigs, value string) (err error) {
+		goroutineConfigs(configs).GoroutineHangingTimeByState, err = parseHangingTimes(value)
+		return err
+	}},
+	{"hang_tiers", func(configs *GoDumpConfigs, value string) (err error) {
+		goroutineConfigs(configs).GoroutineHangingTiers, err = parseTiers(value, func(level string) (float64, error) {
+			ms, err := parseDurationMs(level)
+			return float64(ms), err
+		})
+		return err
+	}},
+	{"goroutine_growth_window", func(configs *GoDumpConfigs, value string) (err error) {
+		goroutineConfigs(configs).GoroutineGrowthWindowMs, err = parseDurationMs(value)
+		return err
+	}},
+	{"goroutine_growth_threshold", func(configs *GoDumpConfigs, value string) (err error) {
+		goroutineConfigs(configs).GoroutineGrowthThreshold, err = parseCount(value)
+		return err
+	}},
+	{"goroutine_growth_tiers", func(configs *GoDumpConfigs, value string) (err error) {
+		goroutineConfigs(configs).GoroutineGrowthTiers, err = parseTiers(value, parseCountLevel)
+		return err
+	}},
+	{"goroutine_rules", func(configs *GoDumpConfigs, value string) (err error) {
+		goroutineConfigs(configs).GoroutineRules, err = parseGoroutineRules(value)
+		return err
+	}},
+	{"hang_ignore", func(configs *GoDumpConfigs, value string) (err error) {
+		goroutineConfigs(configs).HangIgnore, err = parseHangIgnore(value)
+		return err
+	}},
+	{"hang_ignore_no_defaults", func(configs *GoDumpConfigs, value string) (err error) {
+		goroutineConfigs(configs).HangIgnoreNoDefaults, err = parseBool(value)
+		return err
+	}},
+	{"stall_fraction", func(configs *GoDumpConfigs, value string) (err error) {
+		goroutineConfigs(configs).GoroutineStallFraction, err = parsePercentage(value)
+		return err
+	}},
+	{"stall_samples", func(configs *GoDumpConfigs, value string) (err error) {
+		goroutineConfigs(configs).GoroutineStallSamples, err = parseCount(value)
+		return err
+	}},
+	{"stall_prefix", func(configs *GoDumpConfigs, value string) error {
+		goroutineConfigs(configs).GoroutineStallReportPrefix = &value
+		return nil
+	}},
+	{"goroutine_summary_prefix", func(configs *GoDumpConfigs, value string) error {
+		goroutineConfigs(configs).GoroutineSummaryPrefix = &value
+		return nil
+	}},
+	{"goroutine_prefix", func(configs *GoDumpConfigs, value string) error {
+		goroutineConfigs(configs).GoroutineDumpPrefix = &value
+		return nil
+	}},
+	{"gc", func(configs *GoDumpConfigs, value string) (err error) {
+		configs.GoDumpGC, err = parseBool(value)
+		return err
+	}},
+	{"gc_cpu_fraction", func(configs *GoDumpConfigs, value string) (err error) {
+		gcConfigs(configs).GCCPUFractionThreshold, err = parsePercentage(value)
+		return err
+	}},
+	{"gc_cycles_per_minute", func(configs *GoDumpConfigs, value string) error {
+		cycles, err := parseCount(value)
+		gcConfigs(configs).GCCyclesPerMinuteThreshold = float64(cycles)
+		return err
+	}},
+	{"gc_pause_p99", func(configs *GoDumpConfigs, value string) error {
+		d, err := parseDuration(value)
+		gcConfigs(configs).GCPauseP99ThresholdMs = float64(d) / float64(time.Millisecond)
+		return err
+	}},
+	{"gc_prefix", func(configs *GoDumpConfigs, value string) error {
+		gcConfigs(configs).GCDumpPrefix = &value
+		return nil
+	}},
+	{"sched", func(configs *GoDumpConfigs, value string) (err error) {
+		configs.GoDumpSched, err = parseBool(value)
+		return err
+	}},
+	{"sched_latency", func(configs *GoDumpConfigs, value string) error {
+		d, err := parseDuration(value)
+		schedConfigs(configs).SchedLatencyThresholdMs = float64(d) / float64(time.Millisecond)
+		return err
+	}},
+	{"sched_latency_quantile", func(configs *GoDumpConfigs, value string) (err error) {
+		schedConfigs(configs).SchedLatencyQuantile, err = parsePercentage(value)
+		return err
+	}},
+	{"ticker_lag", func(configs *GoDumpConfigs, value string) error {
+		d, err := parseDuration(value)
+		schedConfigs(configs).TickerLagThresholdMs = float64(d) / float64(time.Millisecond)
+		return err
+	}},
+	{"sched_sustained", func(configs *GoDumpConfigs, value string) (err error) {
+		schedConfigs(configs).SchedSustainedMs, err = parseDurationMs(value)
+		return err
+	}},
+	{"os", func(configs *GoDumpConfigs, value string) (err error) {
+		configs.GoDumpOS, err = parseBool(value)
+		return err
+	}},
+	{"thread_threshold", func(configs *GoDumpConfigs, value string) (err error) {
+		osConfigs(configs).ThreadThreshold, err = parseCount(value)
+		return err
+	}},
+	{"thread_growth_per_minute", func(configs *GoDumpConfigs, value string) error {
+		growth, err := parseCount(value)
+		osConfigs(configs).ThreadGrowthPerMinute = float64(growth)
+		return err
+	}},
+	{"threadcreate_threshold", func(configs *GoDumpConfigs, value string) (err error) {
+		osConfigs(configs).ThreadCreateThreshold, err = parseCount(value)
+		return err
+	}},
+	{"fd_threshold", func(configs *GoDumpConfigs, value string) (err error) {
+		osConfigs(configs).FDThreshold, err = parseCount(value)
+		return err
+	}},
+	{"fd_growth_per_minute", func(configs *GoDumpConfigs, value string) error {
+		growth, err := parseCount(value)
+		osConfigs(configs).FDGrowthPerMinute = float64(growth)
+		return err
+	}},
+	{"os_growth_window", func(configs *GoDumpConfigs, value string) (err error) {
+		osConfigs(configs).OSGrowthWindowMs, err = parseDurationMs(value)
+		return err
+	}},
+	{"os_prefix", func(configs *GoDumpConfigs, value string) error {
+		osConfigs(configs).OSDumpPrefix = &value
+		return nil
+	}},
+	{"cpu", func(configs *GoDumpConfigs, value string) (err error) {
+		configs.GoDumpCPU, err = parseBool(value)
+		return err
+	}},
+	{"cpu_threshold", func(configs *GoDumpConfigs, value string) (err error) {
+		cpuConfigs(configs).CPUThresholdPercentage, err = parsePercentage(value)
+		return err
+	}},
+	{"cpu_sustained_intervals", func(configs *GoDumpConfigs, value string) (err error) {
+		cpuConfigs(configs).CPUSustainedIntervals, err = parseCount(value)
+		return err
+	}},
+	{"cpu_profile_duration", func(configs *GoDumpConfigs, value string) (err error) {
+		cpuConfigs(configs).CPUProfileDurationMs, err = parseDurationMs(value)
+		return err
+	}},
+	{"cpu_prefix", func(configs *GoDumpConfigs, value string) error {
+		cpuConfigs(configs).CPUProfilePrefix = &value
+		return nil
+	}},
+	{"native_memory", func(configs *GoDumpConfigs, value string) (err error) {
+		configs.GoDumpNativeMemory, err = parseBool(value)
+		return err
+	}},
+	{"native_memory_threshold", func(configs *GoDumpConfigs, value string) (err error) {
+		nativeMemoryConfigs(configs).NativeMemoryThresholdBytes, err = parseSize(value)
+		return err
+	}},
+	{"native_memory_prefix", func(configs *GoDumpConfigs, value string) error {
+		nativeMemoryConfigs(configs).NativeMemoryDumpPrefix = &value
+		return nil
+	}},
+	{"contention", func(configs *GoDumpConfigs, value string) (err error) {
+		configs.GoDumpContention, err = parseBool(value)
+		return err
+	}},
+	{"mutex_wait_threshold", func(configs *GoDumpConfigs, value string) error {
+		d, err := parseDuration(value)
+		contentionConfigs(configs).MutexWaitThresholdMs = float64(d) / float64(time.Millisecond)
+		return err
+	}},
+	{"block_wait_threshold", func(configs *GoDumpConfigs, value string) error {
+		d, err := parseDuration(value)
+		contentionConfigs(configs).BlockWaitThresholdMs = float64(d) / float64(time.Millisecond)
+		return err
+	}},
+	{"mutex_profile_fraction", func(configs *GoDumpConfigs, value string) (err error) {
+		contentionConfigs(configs).MutexProfileFraction, err = parseCount(value)
+		return err
+	}},
+	{"block_profile_rate", func(configs *GoDumpConfigs, value string) error {
+		d, err := parseDuration(value)
+		contentionConfigs(configs).BlockProfileRate = uint64(d)
+		return err
+	}},
+	{"contention_top_sites", func(configs *GoDumpConfigs, value string) (err error) {
+		contentionConfigs(configs).ContentionTopSites, err = parseCount(value)
+		return err
+	}},
+	{"contention_prefix", func(configs *GoDumpConfigs, value string) error {
+		contentionConfigs(configs).ContentionDumpPrefix = &value
+		return nil
+	}},
+	{"trigger_rules", func(configs *GoDumpConfigs, value string) (err error) {
+		configs.TriggerRules, err = parseTriggerRules(value)
+		return err
+	}},
+	{"interval", func(configs *GoDumpConfigs, value string) (err error) {
+		configs.WatchdogIntervalMs, err = parseDurationMs(value)
+		return err
+	}},
+	{"path", func(configs *GoDumpConfigs, value string) error {
+		configs.GoDumpPath = strings.TrimSpace(value)
+		return nil
+	}},
+}
+
+// loadConfig builds a configuration from the settings found by lookup on top of DefaultConfigs, describe turns a setting name into the name the user wrote
+// All the settings are parsed so that every problem is reported at once
+func loadConfig(lookup func(name string) (string, bool), describe func(name string) string) (*GoDumpConfigs, error) {
+	configs := DefaultConfigs()
+	var errs []error
+	for _, key := range configKeys {
+		value, ok := lookup(key.name)
+		if !ok {
+			continue
+		}
+		if err := key.apply(configs, value); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", describe(key.name), err))
+		}
+	}
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+	return configs, nil
+}
+
+// ConfigFromEnv builds a configuration from the <prefix>_* environment variables, the prefix defaults to GODUMP
+// The result still has to go through NewGoDumpService, which validates it
+func ConfigFromEnv(prefix string) (*GoDumpConfigs, error) {
+	prefix = strings.TrimSuffix(prefix, "_")
+	if prefix == "" {
+		prefix = DefaultEnvPrefix
+	}
+	envName := func(name string) string {
+		return prefix + "_" + strings.ToUpper(name)
+	}
+	return loadConfig(func(name string) (string, bool) {
+		return os.LookupEnv(envName(name))
+	}, envName)
+}
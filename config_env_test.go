@@ -0,0 +1,86 @@
+package godump
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestConfigFromEnv(t *testing.T) {
+	t.Setenv("GODUMP_HEAP", "1")
+	t.Setenv("GODUMP_HEAP_THRESHOLD", "512MiB")
+	t.Setenv("GODUMP_HEAP_THRESHOLD_PCT", "80%")
+	t.Setenv("GODUMP_HEAP_PCT_TIERS", "warning=70%/30s, critical=90%")
+	t.Setenv("GODUMP_GOROUTINE", "true")
+	t.Setenv("GODUMP_GOROUTINE_TIERS", "warning=5k, emergency=50k/10m")
+	t.Setenv("GODUMP_HANG_TIME", "90s")
+	t.Setenv("GODUMP_HANG_TIERS", "warning=1m, critical=5m/10m")
+	t.Setenv("GODUMP_HANG_IGNORE", "state=IO wait; function=main.(*pool).worker")
+	t.Setenv("GODUMP_HANG_IGNORE_NO_DEFAULTS", "1")
+	t.Setenv("GODUMP_HANG_TIME_BY_STATE", "sync.Mutex.Lock=10s; IO wait=never")
+	t.Setenv("GODUMP_GC", "on")
+	t.Setenv("GODUMP_GC_PAUSE_P99", "500us")
+	t.Setenv("GODUMP_CONTENTION", "1")
+	t.Setenv("GODUMP_MUTEX_WAIT_THRESHOLD", "100ms")
+	t.Setenv("GODUMP_BLOCK_PROFILE_RATE", "10us")
+	t.Setenv("GODUMP_TRIGGER_RULES", "heap > 1GiB && goroutines > 5k for 3 => heap_dump; pressure: gc_fraction > 30%")
+	t.Setenv("GODUMP_PATH", "/dumps")
+	configs, err := ConfigFromEnv("")
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	if !configs.GoDumpHeap || !configs.GoDumpGoroutine {
+		t.Errorf("Error: Expected heap and goroutine dumps to be enabled")
+	}
+	if configs.HeapDumpConfigs.HeapThresholdBytes != 512*1024*1024 || configs.HeapDumpConfigs.HeapThresholdPercentage != 0.8 {
+		t.Errorf("Error: Unexpected heap configs %+v", configs.HeapDumpConfigs)
+	}
+	if tiers := configs.HeapDumpConfigs.HeapPercentageTiers; tiers == nil || *tiers != (Tiers{Warning: 0.7, WarningCooldownMs: 30000, Critical: 0.9}) {
+		t.Errorf("Error: Unexpected heap tiers %+v", tiers)
+	}
+	if tiers := configs.GoroutineDumpConfigs.GoroutineTiers; tiers == nil || *tiers != (Tiers{Warning: 5000, Emergency: 50000, EmergencyCooldownMs: 600000}) {
+		t.Errorf("Error: Unexpected goroutine tiers %+v", tiers)
+	}
+	if tiers := configs.GoroutineDumpConfigs.GoroutineHangingTiers; tiers == nil || *tiers != (Tiers{Warning: 60000, Critical: 300000, CriticalCooldownMs: 600000}) {
+		t.Errorf("Error: Unexpected hanging tiers %+v", tiers)
+	}
+	if configs.GoroutineDumpConfigs.GoroutineHangingTimeMs != 90000 {
+		t.Errorf("Error: Expected 90000ms, got %v", configs.GoroutineDumpConfigs.GoroutineHangingTimeMs)
+	}
+	if ignore := configs.GoroutineDumpConfigs.HangIgnore; len(ignore) != 2 || ignore[0].State != "IO wait" || ignore[1].Function != "main.(*pool).worker" ||
+		!configs.GoroutineDumpConfigs.HangIgnoreNoDefaults {
+		t.Errorf("Error: Unexpected hang ignore list %+v", configs.GoroutineDumpConfigs)
+	}
+	if times := configs.GoroutineDumpConfigs.GoroutineHangingTimeByState; len(times) != 2 || times["sync.Mutex.Lock"] != 10000 || times["IO wait"] != 0 {
+		t.Errorf("Error: Unexpected hanging times %v", times)
+	}
+	if !configs.GoDumpGC || configs.GCDumpConfigs.GCPauseP99ThresholdMs != 0.5 {
+		t.Errorf("Error: Unexpected GC configs %+v", configs.GCDumpConfigs)
+	}
+	if !configs.GoDumpContention || configs.ContentionDumpConfigs.MutexWaitThresholdMs != 100 || configs.ContentionDumpConfigs.BlockProfileRate != 10000 {
+		t.Errorf("Error: Unexpected contention configs %+v", configs.ContentionDumpConfigs)
+	}
+	if rules := configs.TriggerRules; len(rules) != 2 || rules[0].When.ForTicks != 3 || len(rules[0].Actions) != 1 || rules[1].Name != "pressure" {
+		t.Errorf("Error: Unexpected trigger rules %+v", rules)
+	}
+	if configs.GoDumpPath != "/dumps" || configs.WatchdogIntervalMs != DefaultWatchdogIntervalMs {
+		t.Errorf("Error: Unexpected configs %+v", configs)
+	}
+	if _, err := NewGoDumpService(configs); err != nil {
+		t.Errorf("Error: Expected the configs to be valid, got %v", err)
+	}
+}
+
+func TestConfigFromEnvReportsEveryBadVariable(t *testing.T) {
+	t.Setenv("APP_HEAP", "sure")
+	t.Setenv("APP_HEAP_THRESHOLD", "512XB")
+	t.Setenv("APP_INTERVAL", "5")
+	_, err := ConfigFromEnv("APP_")
+	if err == nil {
+		t.Fatalf("Error: Expected error, got nil")
+	}
+	for _, expected := range []string{`APP_HEAP: invalid boolean "sure"`, `APP_HEAP_THRESHOLD: invalid size "512XB": unknown unit "XB"`, `APP_INTERVAL: invalid duration "5"`} {
+		if !strings.Contains(err.Error(), expected) {
+			t.Errorf("Error: Expected %q in %v", expected, err)
+		}
+	}
+}
@@ -0,0 +1,235 @@
+package godump
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+/* Configuration files
+ The settings are the same as the environment variables, written in lower case without the prefix (see config_env.go)
+ Two formats are supported:
+	- JSON, selected by the .json extension or a file starting with '{'
+		{"heap": true, "heap_threshold": "512MiB", "interval": "5s", "path": "/dumps"}
+	- A simple TOML-like format with one "key = value" per line, '#' starts a comment and values may be quoted
+		heap = true
+		heap_threshold = "512MiB" # trigger above 512MiB
+ The service can watch a file and apply every change live, the file modification time is polled so no external dependency is needed
+*/
+
+// DefaultConfigFilePollInterval is used by WatchConfigFile when the poll interval is 0
+const DefaultConfigFilePollInterval = 5 * time.Second
+
+// ConfigFromFile builds a configuration from a JSON or key = value file, unknown settings are rejected to catch typos
+// Like ConfigFromEnv it only parses, validation happens in NewGoDumpService or ApplyConfig
+func ConfigFromFile(path string) (*GoDumpConfigs, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var values map[string]string
+	if strings.EqualFold(filepath.Ext(path), ".json") || bytes.HasPrefix(bytes.TrimSpace(data), []byte("{")) {
+		values, err = parseJSONConfig(data)
+	} else {
+		values, err = parseKeyValueConfig(data)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	known := make(map[string]bool, len(configKeys))
+	for _, key := range configKeys {
+		known[key.name] = true
+	}
+	for name := range values {
+		if !known[name] {
+			return nil, fmt.Errorf("%s: unknown setting %q", path, name)
+		}
+	}
+	return loadConfig(func(name string) (string, bool) {
+		value, ok := values[name]
+		return value, ok
+	}, func(name string) string {
+		return path + ": " + name
+	})
+}
+
+// parseJSONConfig reads a flat JSON object, numbers, booleans and lists of strings are accepted as well as strings
+func parseJSONConfig(data []byte) (map[string]string, error) {
+	raw := map[string]any{}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, err
+	}
+	values := make(map[string]string, len(raw))
+	for name, value := range raw {
+		name = strings.ToLower(name)
+		switch v := value.(type) {
+		case nil:
+			continue
+		case string:
+			values[name] = v
+		case bool:
+			values[name] = strconv.FormatBool(v)
+		case float64:
+			values[name] = strconv.FormatFloat(v, 'f', -1, 64)
+		case []any:
+			// Lists, like goroutine_rules, are joined with the ';' separator of their text form
+			items := make([]string, 0, len(v))
+			for _, item := range v {
+				text, ok := item.(string)
+				if !ok {
+					return nil, fmt.Errorf("%s: expected a list of strings", name)
+				}
+				items = append(items, text)
+			}
+			values[name] = strings.Join(items, "; ")
+		default:
+			return nil, fmt.Errorf("%s: expected a string, number or boolean", name)
+		}
+	}
+	return values, nil
+}
+
+// parseKeyValueConfig reads the simple "key = value" format
+func parseKeyValueConfig(data []byte) (map[string]string, error) {
+	values := map[string]string{}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		name, value, ok := strings.Cut(text, "=")
+		if !ok {
+			return nil, fmt.Errorf("line %d: expected key = value, got %q", line, text)
+		}
+		name = strings.ToLower(strings.TrimSpace(name))
+		value = strings.TrimSpace(value)
+		if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') {
+			// Quoted value, everything after the closing quote must be a comment
+			end := strings.IndexByte(value[1:], value[0])
+			if end < 0 {
+				return nil, fmt.Errorf("line %d: missing closing quote in %q", line, text)
+			}
+			rest := strings.TrimSpace(value[end+2:])
+			if rest != "" && !strings.HasPrefix(rest, "#") {
+				return nil, fmt.Errorf("line %d: unexpected %q after the quoted value", line, rest)
+			}
+			value = value[1 : end+1]
+		} else if i := strings.Index(value, "#"); i >= 0 {
+			value = strings.TrimSpace(value[:i])
+		}
+		if name == "" {
+			return nil, fmt.Errorf("line %d: missing key in %q", line, text)
+		}
+		values[name] = value
+	}
+	return values, scanner.Err()
+}
+
+// configFileWatch is the file watched by the service and the state of its last load
+type configFileWatch struct {
+	path         string
+	PollInterval time.Duration
+	modTime      time.Time
+	size         int64
+	// a change is only loaded once the file kept the same state for a whole poll, so a file being written is not read half way
+	pending        bool
+	pendingModTime time.Time
+	pendingSize    int64
+}
+
+// inheritRuntimeFields copies the settings that cannot be written in a file from the configuration in use
+func inheritRuntimeFields(from *GoDumpConfigs, to *GoDumpConfigs) {
+	if to.Logger == nil {
+		to.Logger = from.Logger
+	}
+}
+
+// WatchConfigFile loads the configuration from a file, applies it and keeps polling the file for changes
+// Changes are validated like NewGoDumpService does, an invalid file is rejected and the last good configuration is kept
+// The polling stops with the service, the file is watched once the service is started
+func (gd *GoDumpService) WatchConfigFile(path string, PollInterval time.Duration) error {
+	if PollInterval <= 0 {
+		PollInterval = DefaultConfigFilePollInterval
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	configs, err := ConfigFromFile(path)
+	if err != nil {
+		return err
+	}
+	inheritRuntimeFields(gd.config(), configs)
+	if err := gd.ApplyConfig(configs); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	watch := &configFileWatch{
+		path:         path,
+		PollInterval: PollInterval,
+		modTime:      info.ModTime(),
+		size:         info.Size(),
+	}
+	gd.state.mu.Lock()
+	defer gd.state.mu.Unlock()
+	gd.state.configFile = watch
+	if gd.state.running {
+		gd.state.SafeExitWg.Add(1)
+		go gd.pollConfigFile(watch, gd.state.done, gd.state.SafeExitWg)
+	}
+	return nil
+}
+
+// pollConfigFile reloads the watched file every time its modification time or size changes and then stays the same for one poll
+func (gd *GoDumpService) pollConfigFile(watch *configFileWatch, done chan bool, SafeExitWg *sync.WaitGroup) {
+	defer SafeExitWg.Done()
+	for {
+		select {
+		case <-done:
+			return
+		case <-time.After(watch.PollInterval):
+			gd.state.mu.Lock()
+			replaced := gd.state.configFile != watch
+			gd.state.mu.Unlock()
+			if replaced {
+				// WatchConfigFile was called again with another file
+				return
+			}
+			info, err := os.Stat(watch.path)
+			if err != nil {
+				gd.logger().Error("godump could not read the configuration file", slog.String("file", watch.path), slog.Any("error", err))
+				continue
+			}
+			if info.ModTime().Equal(watch.modTime) && info.Size() == watch.size {
+				watch.pending = false
+				continue
+			}
+			if !watch.pending || !info.ModTime().Equal(watch.pendingModTime) || info.Size() != watch.pendingSize {
+				// The file changed, wait for it to settle
+				watch.pending = true
+				watch.pendingModTime = info.ModTime()
+				watch.pendingSize = info.Size()
+				continue
+			}
+			watch.pending = false
+			watch.modTime = info.ModTime()
+			watch.size = info.Size()
+			configs, err := ConfigFromFile(watch.path)
+			if err != nil {
+				gd.logger().Error("godump rejected the new configuration", slog.String("file", watch.path), slog.Any("error", err))
+				continue
+			}
+			inheritRuntimeFields(gd.config(), configs)
+			// ApplyConfig logs the rejection of an invalid configuration
+			gd.ApplyConfig(configs)
+		}
+	}
+}
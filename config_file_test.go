@@ -0,0 +1,127 @@
+package godump
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func writeConfigFile(t *testing.T, path string, content string, modTime time.Time) {
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	// Force a new modification time, some filesystems have a coarse resolution
+	if err := os.Chtimes(path, modTime, modTime); err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+}
+
+func TestConfigFromFileFormats(t *testing.T) {
+	dir := t.TempDir()
+	jsonFile := filepath.Join(dir, "godump.json")
+	writeConfigFile(t, jsonFile, `{"heap": true, "heap_threshold": "512MiB", "interval": "5s", "path": "/dumps"}`, time.Now())
+	keyValueFile := filepath.Join(dir, "godump.conf")
+	writeConfigFile(t, keyValueFile, `
+# godump settings
+heap = true
+heap_threshold = "512MiB" # trigger above 512MiB
+interval = 5s
+path = '/dumps'
+`, time.Now())
+	for _, file := range []string{jsonFile, keyValueFile} {
+		configs, err := ConfigFromFile(file)
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		if !configs.GoDumpHeap || configs.HeapDumpConfigs.HeapThresholdBytes != 512*1024*1024 || configs.WatchdogIntervalMs != 5000 || configs.GoDumpPath != "/dumps" {
+			t.Errorf("Error: Unexpected configs from %s: %+v", file, configs)
+		}
+	}
+}
+
+func TestConfigFromFileGoroutineRulesList(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "godump.json")
+	writeConfigFile(t, file, `{"goroutine": true, "goroutine_rules": ["function=net/http.* > 50", "label=pool:workers > 10k"]}`, time.Now())
+	configs, err := ConfigFromFile(file)
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	rules := configs.GoroutineDumpConfigs.GoroutineRules
+	if len(rules) != 2 || rules[0].Function != "net/http.*" || rules[1].LabelValue != "workers" || rules[1].Threshold != 10000 {
+		t.Errorf("Error: Unexpected rules %+v", rules)
+	}
+}
+
+func TestConfigFromFileErrors(t *testing.T) {
+	dir := t.TempDir()
+	testCases := []struct {
+		name     string
+		content  string
+		expected string
+	}{
+		{name: "unknown.json", content: `{"heap_treshold": "1GiB"}`, expected: `unknown setting "heap_treshold"`},
+		{name: "bad-value.json", content: `{"heap_threshold": "1XB"}`, expected: `heap_threshold: invalid size "1XB"`},
+		{name: "bad-list.json", content: `{"goroutine_rules": [50]}`, expected: "goroutine_rules: expected a list of strings"},
+		{name: "bad-line.conf", content: "heap true\n", expected: "line 1: expected key = value"},
+		{name: "bad-quote.conf", content: "path = \"/dumps\n", expected: "line 1: missing closing quote"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			file := filepath.Join(dir, tc.name)
+			writeConfigFile(t, file, tc.content, time.Now())
+			_, err := ConfigFromFile(file)
+			if err == nil || !strings.Contains(err.Error(), tc.expected) {
+				t.Errorf("Error: Expected %q, got %v", tc.expected, err)
+			}
+		})
+	}
+}
+
+func TestWatchConfigFileHotReload(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "godump.conf")
+	modTime := time.Now().Add(-time.Hour)
+	writeConfigFile(t, file, "heap = true\nheap_threshold = 1GiB\ninterval = 1s\npath = "+dir+"\n", modTime)
+
+	gds, err := NewGoDumpService(&GoDumpConfigs{GoDumpPath: dir, WatchdogIntervalMs: 1000})
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	if err := gds.WatchConfigFile(file, 10*time.Millisecond); err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	if gds.config().HeapDumpConfigs.HeapThresholdBytes != 1<<30 {
+		t.Fatalf("Error: Expected the file to be applied, got %+v", gds.config())
+	}
+	wg := sync.WaitGroup{}
+	programChanEnd := make(chan bool)
+	if err := gds.Start(programChanEnd, &wg); err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	waitFor := func(condition func() bool) bool {
+		for deadline := time.Now().Add(2 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+			if condition() {
+				return true
+			}
+		}
+		return false
+	}
+
+	// A valid change is applied
+	writeConfigFile(t, file, "heap = true\nheap_threshold = 2GiB\ninterval = 1s\npath = "+dir+"\n", modTime.Add(time.Minute))
+	if !waitFor(func() bool { return gds.config().HeapDumpConfigs.HeapThresholdBytes == 2<<30 }) {
+		t.Errorf("Error: Expected the new threshold to be applied, got %+v", gds.config().HeapDumpConfigs)
+	}
+	// An invalid change is rejected and the last good configuration is kept
+	writeConfigFile(t, file, "heap = true\nheap_threshold = 0\ninterval = 1s\npath = "+dir+"\n", modTime.Add(2*time.Minute))
+	time.Sleep(100 * time.Millisecond)
+	if gds.config().HeapDumpConfigs.HeapThresholdBytes != 2<<30 {
+		t.Errorf("Error: Expected the last good configuration to be kept, got %+v", gds.config().HeapDumpConfigs)
+	}
+
+	programChanEnd <- true
+	wg.Wait()
+}
@@ -0,0 +1,200 @@
+package godump
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+/* Events let the application react in-process when godump fires
+ Every watchdog reports what it sees to the service, the service then fans the event out to:
+	- The callbacks registered with OnEvent, called synchronously from the watchdog goroutine
+	- The channels returned by Subscribe, events are dropped for a subscriber that is not keeping up
+*/
+
+type EventType int
+
+const (
+	// EventThresholdCrossed is emitted once when a watchdog value goes above its threshold
+	EventThresholdCrossed EventType = iota + 1
+	// EventThresholdRecovered is emitted once when a watchdog value goes back below its threshold
+	EventThresholdRecovered
+	// EventDumpWritten is emitted for every dump file that was written
+	EventDumpWritten
+	// EventDumpFailed is emitted when a dump file could not be created or written
+	EventDumpFailed
+	// EventHangDetected is emitted when goroutines kept the same stack for longer than the hanging time
+	EventHangDetected
+	// EventTierReached is emitted every time the actions of a level of Tiers run, Detail is the level
+	EventTierReached
+)
+
+func (t EventType) String() string {
+	switch t {
+	case EventThresholdCrossed:
+		return "ThresholdCrossed"
+	case EventThresholdRecovered:
+		return "ThresholdRecovered"
+	case EventDumpWritten:
+		return "DumpWritten"
+	case EventDumpFailed:
+		return "DumpFailed"
+	case EventHangDetected:
+		return "HangDetected"
+	case EventTierReached:
+		return "TierReached"
+	}
+	return "Unknown"
+}
+
+// Names of the built-in watchdogs as reported in Event.Watchdog
+const (
+	WatchdogHeapBytes         = "heap_bytes"
+	WatchdogHeapPercentage    = "heap_percentage"
+	WatchdogGoroutines        = "goroutines"
+	WatchdogGoroutinesHanging = "goroutines_hanging"
+)
+
+type Event struct {
+	Type      EventType
+	Time      time.Time
+	Watchdog  string
+	Detail    string  // what fired within the watchdog when it watches several things, e.g. the creation site of leaking goroutines
+	Value     float64 // the measured value (bytes, goroutines, or number of hanging goroutines for EventHangDetected)
+	Threshold float64 // the configured threshold (bytes, goroutines, or hanging time in ms for EventHangDetected)
+	File      string  // the dump file for EventDumpWritten and EventDumpFailed
+	Err       error   // the error for EventDumpFailed
+}
+
+// subscriberBuffer is the size of the channels returned by Subscribe
+const subscriberBuffer = 64
+
+type eventBus struct {
+	mu          sync.RWMutex
+	callbacks   []func(Event)
+	subscribers []chan Event
+	emergency   []func(Event) // the callbacks registered with OnEmergency
+}
+
+// OnEvent registers a callback that is called for every event, the callback runs on the watchdog goroutine so it must not block
+func (gd *GoDumpService) OnEvent(callback func(Event)) {
+	if callback == nil {
+		return
+	}
+	gd.events.mu.Lock()
+	defer gd.events.mu.Unlock()
+	gd.events.callbacks = append(gd.events.callbacks, callback)
+}
+
+// Subscribe returns a buffered channel that receives every event, events are dropped while the channel is full
+func (gd *GoDumpService) Subscribe() <-chan Event {
+	ch := make(chan Event, subscriberBuffer)
+	gd.events.mu.Lock()
+	defer gd.events.mu.Unlock()
+	gd.events.subscribers = append(gd.events.subscribers, ch)
+	return ch
+}
+
+// Unsubscribe stops delivering events to a channel returned by Subscribe and closes it
+func (gd *GoDumpService) Unsubscribe(ch <-chan Event) {
+	gd.events.mu.Lock()
+	defer gd.events.mu.Unlock()
+	for i, sub := range gd.events.subscribers {
+		if sub == ch {
+			gd.events.subscribers = append(gd.events.subscribers[:i], gd.events.subscribers[i+1:]...)
+			close(sub)
+			return
+		}
+	}
+}
+
+func (gd *GoDumpService) emit(event Event) {
+	if gd.events == nil {
+		// The service was not created through NewGoDumpService, nobody can be listening
+		return
+	}
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+	// The callbacks run without the lock so that they can register callbacks or subscribe themselves
+	gd.events.mu.RLock()
+	callbacks := gd.events.callbacks
+	gd.events.mu.RUnlock()
+	for _, callback := range callbacks {
+		callback(event)
+	}
+	// The sends never block, they stay under the lock so that Unsubscribe cannot close a channel in between
+	gd.events.mu.RLock()
+	defer gd.events.mu.RUnlock()
+	for _, sub := range gd.events.subscribers {
+		select {
+		case sub <- event:
+		default:
+			// The subscriber is not keeping up, drop the event
+		}
+	}
+}
+
+// checkThreshold compares a value to its threshold and emits the crossed/recovered events on transitions
+// above holds the state of the watchdog between ticks, it returns true while the value is above the threshold
+func (gd *GoDumpService) checkThreshold(watchdog string, above *bool, value, threshold float64) bool {
+	return gd.checkDetailThreshold(watchdog, "", above, value, threshold)
+}
+
+// checkDetailThreshold is checkThreshold for one of the things a watchdog watches, detail is reported in the events and logs
+func (gd *GoDumpService) checkDetailThreshold(watchdog string, detail string, above *bool, value, threshold float64) bool {
+	log := gd.logger()
+	// attrs are only built for the records the logger keeps, the sampler checks every threshold on every tick
+	attrs := func() []any {
+		attrs := []any{slog.String("watchdog", watchdog), slog.Float64("value", value), slog.Float64("threshold", threshold)}
+		if detail != "" {
+			attrs = append(attrs, slog.String("detail", detail))
+		}
+		return attrs
+	}
+	if value > threshold {
+		// Only the crossing is a warning, the caller logs what it does about it on every tick
+		if !*above {
+			*above = true
+			gd.emit(Event{Type: EventThresholdCrossed, Watchdog: watchdog, Detail: detail, Value: value, Threshold: threshold})
+			log.Warn("godump threshold exceeded", attrs()...)
+		} else if log.Enabled(context.Background(), slog.LevelDebug) {
+			log.Debug("godump threshold still exceeded", attrs()...)
+		}
+		return true
+	}
+	if *above {
+		*above = false
+		gd.emit(Event{Type: EventThresholdRecovered, Watchdog: watchdog, Detail: detail, Value: value, Threshold: threshold})
+		log.Info("godump threshold recovered", attrs()...)
+		return false
+	}
+	if log.Enabled(context.Background(), slog.LevelDebug) {
+		log.Debug("godump threshold not exceeded", attrs()...)
+	}
+	return false
+}
+
+// emitDump reports the outcome of writing a dump file
+func (gd *GoDumpService) emitDump(watchdog string, file string, err error) {
+	if err != nil {
+		gd.logger().Error("godump could not write the dump", slog.String("watchdog", watchdog), slog.String("file", file), slog.Any("error", err))
+		gd.emit(Event{Type: EventDumpFailed, Watchdog: watchdog, File: file, Err: err})
+		return
+	}
+	gd.logger().Info("godump dump written", slog.String("watchdog", watchdog), slog.String("file", file))
+	gd.emit(Event{Type: EventDumpWritten, Watchdog: watchdog, File: file})
+}
+
+// takeHeapDump writes a heap dump on behalf of a watchdog and reports the outcome
+func (gd *GoDumpService) takeHeapDump(watchdog string) {
+	file, err := writeHeapDump(gd.config())
+	gd.emitDump(watchdog, file, err)
+}
+
+// takeGoroutineDump writes a goroutine dump on behalf of a watchdog and reports the outcome
+func (gd *GoDumpService) takeGoroutineDump(watchdog string, hangingStacks []GoStackAnalyzerRecord, sections ...dumpSection) {
+	file, err := writeGoroutineDump(gd.config(), hangingStacks, sections...)
+	gd.emitDump(watchdog, file, err)
+}
@@ -0,0 +1,103 @@
+package godump
+
+import (
+	"errors"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestEventsThresholdTransitions(t *testing.T) {
+	gds, err := NewGoDumpService(&GoDumpConfigs{
+		GoDumpHeap:         true,
+		GoDumpPath:         t.TempDir(),
+		WatchdogIntervalMs: 1000,
+		HeapDumpConfigs:    &DumpHeapConfigs{HeapThresholdBytes: 100},
+	})
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	var received []Event
+	gds.OnEvent(func(e Event) { received = append(received, e) })
+	sub := gds.Subscribe()
+
+	above := false
+	// Crossing only emits once while the value stays above the threshold
+	for _, value := range []float64{50, 150, 200, 80, 90} {
+		gds.checkThreshold(WatchdogHeapBytes, &above, value, 100)
+	}
+	if len(received) != 2 {
+		t.Fatalf("Error: Expected 2 events, got %v", len(received))
+	}
+	if received[0].Type != EventThresholdCrossed || received[0].Value != 150 || received[0].Threshold != 100 {
+		t.Errorf("Error: Unexpected first event %+v", received[0])
+	}
+	if received[1].Type != EventThresholdRecovered || received[1].Value != 80 {
+		t.Errorf("Error: Unexpected second event %+v", received[1])
+	}
+	if len(sub) != 2 {
+		t.Errorf("Error: Expected 2 events on the subscription, got %v", len(sub))
+	}
+	gds.Unsubscribe(sub)
+	if _, ok := <-sub; !ok {
+		t.Errorf("Error: Expected buffered events to remain readable after Unsubscribe")
+	}
+}
+
+func TestEventsDumpWrittenAndFailed(t *testing.T) {
+	configs := &GoDumpConfigs{
+		GoDumpHeap:         true,
+		GoDumpPath:         t.TempDir(),
+		WatchdogIntervalMs: 1000,
+		HeapDumpConfigs:    &DumpHeapConfigs{HeapThresholdBytes: 100},
+	}
+	gds, err := NewGoDumpService(configs)
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	sub := gds.Subscribe()
+
+	gds.takeHeapDump(WatchdogHeapBytes)
+	event := <-sub
+	if event.Type != EventDumpWritten || event.File == "" || event.Err != nil {
+		t.Errorf("Error: Unexpected event %+v", event)
+	}
+
+	configs.GoDumpPath = configs.GoDumpPath + "/does/not/exist"
+	gds.takeHeapDump(WatchdogHeapBytes)
+	event = <-sub
+	if event.Type != EventDumpFailed || event.Err == nil {
+		t.Errorf("Error: Unexpected event %+v", event)
+	}
+	var pathErr *os.PathError
+	if !errors.As(event.Err, &pathErr) {
+		t.Errorf("Error: Expected the os.Create error, got %v", event.Err)
+	}
+}
+
+func TestEventsCallbackCanSubscribe(t *testing.T) {
+	gds, err := NewGoDumpService(&GoDumpConfigs{GoDumpPath: t.TempDir(), WatchdogIntervalMs: 1000})
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	calls := 0
+	gds.OnEvent(func(e Event) {
+		calls++
+		// Registering from a callback must not deadlock
+		gds.Unsubscribe(gds.Subscribe())
+		gds.OnEvent(func(e Event) {})
+	})
+	done := make(chan bool)
+	go func() {
+		gds.emit(Event{Type: EventThresholdCrossed, Watchdog: WatchdogHeapBytes})
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Error: Expected emit to return while a callback subscribes")
+	}
+	if calls != 1 {
+		t.Errorf("Error: Expected the callback to be called once, got %d", calls)
+	}
+}
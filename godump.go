@@ -2,12 +2,14 @@ package godump
 
 import (
 	"fmt"
+	"log/slog"
 	"os"
 	"reflect"
 	"runtime"
 	"runtime/pprof"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 )
@@ -23,57 +25,123 @@ import (
 type DumpHeapConfigs struct {
 	HeapThresholdBytes      uint64
 	HeapThresholdPercentage float64
+	HeapBytesTiers          *Tiers // warning, critical and emergency levels in bytes, see tiers.go
+	HeapPercentageTiers     *Tiers // warning, critical and emergency levels as fractions (0 to 1) of the system memory
 	HeapDumpPrefix          *string
+	HeapMetric              string // runtime/metrics name compared to the thresholds, DefaultHeapMetric (live heap) when empty
 }
 
 type DumpGoroutineConfigs struct {
-	GoroutineThreshold     uint64
-	GoroutineHangingTimeMs uint64
-	GoroutineDumpPrefix    *string
+	GoroutineThreshold          uint64
+	GoroutineTiers              *Tiers // warning, critical and emergency levels in goroutines, see tiers.go
+	GoroutineHangingTimeMs      uint64
+	GoroutineHangingTimeByState map[string]uint64 // hanging time per wait state, e.g. "sync.Mutex.Lock", in milliseconds, 0 never reports the state
+	GoroutineHangingTiers       *Tiers            // warning, critical and emergency levels in milliseconds of the longest hang, see tiers.go
+	GoroutineGrowthWindowMs     uint64            // window a creation site has to grow over to be reported as leaking, 0 disables it
+	GoroutineGrowthThreshold    uint64            // goroutines a creation site has to gain over the window, DefaultGoroutineGrowthThreshold when 0 without GoroutineGrowthTiers
+	GoroutineGrowthTiers        *Tiers            // warning, critical and emergency levels in goroutines gained over the window, see tiers.go
+	GoroutineRules              []GoroutineRule   // limits per function, creation site or pprof label
+	HangIgnore                  []HangIgnore      // goroutines the hang detection never reports, added to DefaultHangIgnore
+	HangIgnoreNoDefaults        bool              // do not add DefaultHangIgnore to HangIgnore
+	GoroutineStallFraction      float64           // fraction (0 to 1) of blocked goroutines above which a program without progress is stalled, 0 disables it
+	GoroutineStallSamples       uint64            // samples in a row without progress before a stall is reported, DefaultGoroutineStallSamples when 0
+	GoroutineStallReportPrefix  *string
+	GoroutineSummaryPrefix      *string // prefix of the summaries written at the warning level of GoroutineTiers or by ActionGoroutineSummary
+	GoroutineDumpPrefix         *string
 }
 
 type GoDumpConfigs struct {
-	GoDumpHeap           bool
-	GoDumpGoroutine      bool
-	GoDumpPath           string
-	HeapDumpConfigs      *DumpHeapConfigs
-	GoroutineDumpConfigs *DumpGoroutineConfigs
-	WatchdogIntervalMs   uint64
+	GoDumpHeap              bool
+	GoDumpGoroutine         bool
+	GoDumpPath              string
+	HeapDumpConfigs         *DumpHeapConfigs
+	GoroutineDumpConfigs    *DumpGoroutineConfigs
+	GoDumpGC                bool
+	GCDumpConfigs           *DumpGCConfigs
+	GoDumpSched             bool
+	SchedDumpConfigs        *DumpSchedConfigs
+	GoDumpOS                bool
+	OSDumpConfigs           *DumpOSConfigs
+	GoDumpCPU               bool
+	CPUDumpConfigs          *DumpCPUConfigs
+	GoDumpNativeMemory      bool
+	NativeMemoryDumpConfigs *DumpNativeMemoryConfigs
+	GoDumpContention        bool
+	ContentionDumpConfigs   *DumpContentionConfigs
+	TriggerRules            []TriggerRule // composite conditions evaluated on every sample, they need no GoDump* flag
+	WatchdogIntervalMs      uint64
+	Logger                  *slog.Logger // optional, godump is silent when nil
 }
 
-func TakeHeapDump(goDumpConfigs *GoDumpConfigs) {
-	prefix := "heapdump"
-	if goDumpConfigs.HeapDumpConfigs.HeapDumpPrefix != nil {
-		prefix = *goDumpConfigs.HeapDumpConfigs.HeapDumpPrefix
+// dumpSequence numbers the dump files, several dumps written in the same millisecond get distinct names
+var dumpSequence atomic.Uint64
+
+// dumpFilePath returns the path of a new dump file named after the prefix, or defaultPrefix when the prefix is not set
+// The name ends with the time in milliseconds and a sequence number so two dumps never share a file
+func dumpFilePath(goDumpConfigs *GoDumpConfigs, prefix *string, defaultPrefix string, extension string) string {
+	name := defaultPrefix
+	if prefix != nil {
+		name = *prefix
 	}
-	HeapDumpFile := goDumpConfigs.GoDumpPath + "/" + prefix + time.Now().Format("2006-01-02T15:04:05") + ".hprof"
+	DumpFile := goDumpConfigs.GoDumpPath + "/" + name + time.Now().Format("2006-01-02T15:04:05.000") + fmt.Sprintf("-%d", dumpSequence.Add(1)) + extension
 	// Replace double slashes with single slashes
-	HeapDumpFile = strings.Replace(HeapDumpFile, "//", "/", -1)
-	// Take the heap dump and write it to the file
-	f, err := os.Create(HeapDumpFile)
+	return strings.Replace(DumpFile, "//", "/", -1)
+}
+
+// writeDumpFile creates a dump file and lets write fill it, it returns the path of the file
+func writeDumpFile(DumpFile string, write func(f *os.File) error) (string, error) {
+	f, err := os.Create(DumpFile)
 	if err != nil {
 		// Could not create the file
-		return
+		return DumpFile, err
+	}
+	err = write(f)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
 	}
-	// Write the heap dump to the file
-	pprof.WriteHeapProfile(f)
-	f.Close()
+	return DumpFile, err
+}
+
+func TakeHeapDump(goDumpConfigs *GoDumpConfigs) {
+	writeHeapDump(goDumpConfigs)
+}
+
+// writeHeapDump writes the heap profile and returns the path of the file it created
+func writeHeapDump(goDumpConfigs *GoDumpConfigs) (string, error) {
+	var prefix *string
+	if goDumpConfigs.HeapDumpConfigs != nil {
+		prefix = goDumpConfigs.HeapDumpConfigs.HeapDumpPrefix
+	}
+	HeapDumpFile := dumpFilePath(goDumpConfigs, prefix, DefaultHeapDumpPrefix, ".hprof")
+	// Take the heap dump and write it to the file
+	return writeDumpFile(HeapDumpFile, func(f *os.File) error {
+		return pprof.WriteHeapProfile(f)
+	})
 }
+
 func TakeGoroutineDump(goDumpConfigs *GoDumpConfigs, hangingStacks []GoStackAnalyzerRecord) {
-	prefix := "goroutinedump"
-	if goDumpConfigs.GoroutineDumpConfigs.GoroutineDumpPrefix != nil {
-		prefix = *goDumpConfigs.GoroutineDumpConfigs.GoroutineDumpPrefix
+	writeGoroutineDump(goDumpConfigs, hangingStacks)
+}
+
+// dumpSection is a titled block of lines a watchdog appends to its dump to explain why it fired
+type dumpSection struct {
+	title string
+	lines []string
+}
+
+// writeGoroutineDump writes the goroutine dump and returns the path of the file it created
+func writeGoroutineDump(goDumpConfigs *GoDumpConfigs, hangingStacks []GoStackAnalyzerRecord, sections ...dumpSection) (string, error) {
+	var prefix *string
+	if goDumpConfigs.GoroutineDumpConfigs != nil {
+		prefix = goDumpConfigs.GoroutineDumpConfigs.GoroutineDumpPrefix
 	}
-	GoroutineDumpFile := goDumpConfigs.GoDumpPath + "/" + prefix + time.Now().Format("2006-01-02T15:04:05") + ".txt"
-	// Replace double slashes with single slashes
-	GoroutineDumpFile = strings.Replace(GoroutineDumpFile, "//", "/", -1)
+	GoroutineDumpFile := dumpFilePath(goDumpConfigs, prefix, DefaultGoroutineDumpPrefix, ".txt")
 	// Write the goroutine dump to the file
 	f, err := os.Create(GoroutineDumpFile)
 	if err != nil {
 		// Could not create the file
-		return
+		return GoroutineDumpFile, err
 	}
-	defer f.Close()
 
 	// Write the stack to the file
 	// Write the current time to the file
@@ -92,7 +160,11 @@ func TakeGoroutineDump(goDumpConfigs *GoDumpConfigs, hangingStacks []GoStackAnal
 	f.WriteString("Number of Goroutines: " + fmt.Sprint(runtime.NumGoroutine()) + "\n")
 	f.WriteString("Goroutines:\n")
 	// Write the goroutine dump to the file
-	pprof.Lookup("goroutine").WriteTo(f, 1)
+	err = pprof.Lookup("goroutine").WriteTo(f, 1)
+	if err != nil {
+		f.Close()
+		return GoroutineDumpFile, err
+	}
 	// Append the hanging goroutines IDs to the end of the file
 	if len(hangingStacks) > 0 {
 		f.WriteString("---\n\n")
@@ -100,6 +172,9 @@ func TakeGoroutineDump(goDumpConfigs *GoDumpConfigs, hangingStacks []GoStackAnal
 		f.WriteString("\nHanging Goroutines Detected:\n")
 		f.WriteString("Number of Hanging Goroutines: " + fmt.Sprint(len(hangingStacks)) + "\n")
 		f.WriteString("Considered Hanging time (ms): " + fmt.Sprint(goDumpConfigs.GoroutineDumpConfigs.GoroutineHangingTimeMs) + "\n")
+		if len(goDumpConfigs.GoroutineDumpConfigs.GoroutineHangingTimeByState) > 0 {
+			f.WriteString("Hanging time per state: " + formatHangingTimes(goDumpConfigs.GoroutineDumpConfigs.GoroutineHangingTimeByState) + "\n")
+		}
 		for _, stack := range hangingStacks {
 			// Convert the identifier to a string in hexadecimal
 			eachStack := make(map[int]string)
@@ -116,11 +191,21 @@ func TakeGoroutineDump(goDumpConfigs *GoDumpConfigs, hangingStacks []GoStackAnal
 			// Write the stack to the file
 			f.WriteString(" * Last Change: " + stack.LastChange.Format("2006-01-02T15:04:05"))
 			f.WriteString(" * Last Mesure: " + stack.CurrentMesure.Format("2006-01-02T15:04:05"))
+			if stack.State != "" {
+				f.WriteString(" * State: " + stack.State)
+			}
 			f.WriteString(" (Stack) -> [" + identifierString + "]\n")
 		}
-		// Close the file
 	}
-	f.Close()
+	for _, section := range sections {
+		f.WriteString("---\n\n")
+		f.WriteString(section.title + ":\n")
+		for _, line := range section.lines {
+			f.WriteString(line + "\n")
+		}
+	}
+	// Close the file
+	return GoroutineDumpFile, f.Close()
 }
 func compareStacks(stack1, stack2 runtime.StackRecord) bool {
 	return reflect.DeepEqual(stack1, stack2)
@@ -137,82 +222,57 @@ func getAvailableMemory() (uint64, error) {
 
 /*
 	 == Watchdogs ==
-		We split the watchdogs into two functions to make it more performant we don't want to have to always check if we should be looking at bytes or percentage for the heap threshold
-		Instead we will have two watchdogs, one for bytes and one for percentage and select the one to run based on the configuration
+		Every watchdog is fed by the single sampler of the service (see sampler.go), the sampler gathers the metrics once per interval
+		and hands the same Sample to every enabled watchdog, so they stay consistent with each other and the world is never stopped to read the heap
+		We still split the heap watchdog in two, one for bytes and one for percentage, and the sampler only runs the ones enabled by the configuration
 */
-func WatchHeapBytes(gd GoDumpService, ApplicationStopChannel chan bool, SafeExitWg *sync.WaitGroup) {
-	// start watching the heap
-	SafeExitWg.Add(1) // add one to the wait group
-	LastMemStats := &runtime.MemStats{}
-	// get the initial memory stats
-	runtime.ReadMemStats(LastMemStats)
-	for {
-		select {
-		case <-ApplicationStopChannel:
-			// stop the watchdog
-			SafeExitWg.Done()
-			return
-		case <-time.After(time.Duration(gd.configs.WatchdogIntervalMs) * time.Millisecond):
-			// check the heap usage
-			// if the heap usage exceeds the threshold, take a heap dump
-			var CurrentMemStats runtime.MemStats
-			runtime.ReadMemStats(&CurrentMemStats)
-			// Check the heap allocation
-			if CurrentMemStats.Alloc > uint64(gd.configs.HeapDumpConfigs.HeapThresholdBytes) {
-				// take a heap dump
-				TakeHeapDump(gd.configs)
-			}
-			// update the last memory stats
-			LastMemStats = &CurrentMemStats
-		}
+
+type heapBytesWatchdog struct {
+	above bool
+	tiers tierState
+}
+
+func (w *heapBytesWatchdog) check(gd *GoDumpService, configs *GoDumpConfigs, sample *Sample) {
+	// if the heap usage exceeds the threshold, take a heap dump, the tiers may be set without it
+	if (configs.HeapDumpConfigs.HeapThresholdBytes > 0 || configs.HeapDumpConfigs.HeapBytesTiers == nil) &&
+		gd.checkThreshold(WatchdogHeapBytes, &w.above, float64(sample.HeapBytes), float64(configs.HeapDumpConfigs.HeapThresholdBytes)) {
+		gd.takeHeapDump(WatchdogHeapBytes)
+	}
+	if tiers := configs.HeapDumpConfigs.HeapBytesTiers; tiers != nil {
+		gd.checkTiers(WatchdogHeapBytes, "", tiers, &w.tiers, float64(sample.HeapBytes), 1, configs, sample)
 	}
 }
 
-func WatchHeapPercentage(gd GoDumpService, ApplicationStopChannel chan bool, SafeExitWg *sync.WaitGroup, AvailableSystemMemory uint64) {
-	// start watching the heap
-	SafeExitWg.Add(1) // add one to the wait group
-	LastMemStats := &runtime.MemStats{}
-	// get the initial memory stats
-	runtime.ReadMemStats(LastMemStats)
-	for {
-		select {
-		case <-ApplicationStopChannel:
-			// stop the watchdog
-			SafeExitWg.Done()
-			return
-		case <-time.After(time.Duration(gd.configs.WatchdogIntervalMs) * time.Millisecond):
-			// check the heap usage
-			// if the heap usage exceeds the threshold, take a heap dump
-			var CurrentMemStats runtime.MemStats
-			runtime.ReadMemStats(&CurrentMemStats)
-			// Check the heap allocation
-			if CurrentMemStats.Alloc > uint64(float64(AvailableSystemMemory)*float64(gd.configs.HeapDumpConfigs.HeapThresholdPercentage)) {
-				// take a heap dump
-				TakeHeapDump(gd.configs)
-			}
-			// update the last memory stats
-			LastMemStats = &CurrentMemStats
-		}
+type heapPercentageWatchdog struct {
+	above bool
+	tiers tierState
+}
+
+func (w *heapPercentageWatchdog) check(gd *GoDumpService, configs *GoDumpConfigs, sample *Sample) {
+	// if the heap usage exceeds the percentage of the system memory, take a heap dump
+	threshold := float64(uint64(float64(sample.AvailableSystemMemory) * float64(configs.HeapDumpConfigs.HeapThresholdPercentage)))
+	if (configs.HeapDumpConfigs.HeapThresholdPercentage > 0 || configs.HeapDumpConfigs.HeapPercentageTiers == nil) &&
+		gd.checkThreshold(WatchdogHeapPercentage, &w.above, float64(sample.HeapBytes), threshold) {
+		gd.takeHeapDump(WatchdogHeapPercentage)
+	}
+	if tiers := configs.HeapDumpConfigs.HeapPercentageTiers; tiers != nil {
+		gd.checkTiers(WatchdogHeapPercentage, "", tiers, &w.tiers, float64(sample.HeapBytes), float64(sample.AvailableSystemMemory), configs, sample)
 	}
 }
 
-func WatchGoroutines(gd GoDumpService, ApplicationStopChannel chan bool, SafeExitWg *sync.WaitGroup) {
-	// start watching the goroutines
-	SafeExitWg.Add(1) // add one to the wait group
-	for {
-		select {
-		case <-ApplicationStopChannel:
-			// stop the watchdog
-			SafeExitWg.Done()
-			return
-		case <-time.After(time.Duration(gd.configs.WatchdogIntervalMs) * time.Millisecond):
-			// check the number of goroutines
-			// if the number of goroutines exceeds the threshold, take a goroutine dump
-			if uint64(runtime.NumGoroutine()) > gd.configs.GoroutineDumpConfigs.GoroutineThreshold {
-				// take a goroutine dump
-				TakeGoroutineDump(gd.configs, []GoStackAnalyzerRecord{})
-			}
-		}
+type goroutinesWatchdog struct {
+	above bool
+	tiers tierState
+}
+
+func (w *goroutinesWatchdog) check(gd *GoDumpService, configs *GoDumpConfigs, sample *Sample) {
+	// if the number of goroutines exceeds the threshold, take a goroutine dump
+	if (configs.GoroutineDumpConfigs.GoroutineThreshold > 0 || configs.GoroutineDumpConfigs.GoroutineTiers == nil) &&
+		gd.checkThreshold(WatchdogGoroutines, &w.above, float64(sample.Goroutines), float64(configs.GoroutineDumpConfigs.GoroutineThreshold)) {
+		gd.takeGoroutineDump(WatchdogGoroutines, []GoStackAnalyzerRecord{})
+	}
+	if tiers := configs.GoroutineDumpConfigs.GoroutineTiers; tiers != nil {
+		gd.checkTiers(WatchdogGoroutines, "", tiers, &w.tiers, float64(sample.Goroutines), 1, configs, sample)
 	}
 }
 
@@ -222,150 +282,280 @@ type GoStackAnalyzerRecord struct {
 	CurrentStacks runtime.StackRecord
 	CurrentMesure time.Time
 	LastChange    time.Time
+	State         string // wait state from the goroutine profile, only read when GoroutineHangingTimeByState is set
 }
 
-func WatchGoroutinesHanging(gd GoDumpService, ApplicationStopChannel chan bool, SafeExitWg *sync.WaitGroup) {
-	// start watching the goroutines
-	SafeExitWg.Add(1) // add one to the wait group
-	GoStackAnalyzerRecords := make(map[[32]uintptr]*GoStackAnalyzerRecord)
-	for {
-		select {
-		case <-ApplicationStopChannel:
-			// stop the watchdog
-			SafeExitWg.Done()
-			return
-		case <-time.After(time.Duration(gd.configs.WatchdogIntervalMs) * time.Millisecond):
-			// We map the goroutine id to the stack trace
-			// if the goroutine is still running, we update the stack trace in the map
-			// if a goroutine is not running anymore we remove it from the map
-			// if a goroutine has been having the same stack trace for a long time, we take a goroutine dump
-
-			// Get the stack and the goroutine id for all the goroutines
-			goroutines := make([]runtime.StackRecord, runtime.NumGoroutine())
-			idsPresentOnThisRun := make(map[[32]uintptr]bool)
-			n, ok := runtime.GoroutineProfile(goroutines)
-			if !ok {
-				// Could not get the goroutines
-				continue
-			}
-			// Get the current time
-			currentTime := time.Now()
-			// Loop through the goroutines
-			for i := 0; i < n; i++ {
-				// Get the goroutine id
-				goid := goroutines[i].Stack0
-				// Get the stack trace
-				stack := goroutines[i]
-				// Check if the goroutine is in the map
-				if _, ok := GoStackAnalyzerRecords[goid]; !ok {
-					// The goroutine is not in the map, add it
-					GoStackAnalyzerRecords[goid] = &GoStackAnalyzerRecord{
-						LastStacks:    runtime.StackRecord{},
-						CurrentStacks: stack,
-						CurrentMesure: currentTime,
-						LastChange:    currentTime,
-					}
-				} else {
-					// The goroutine is in the map, update it
-					GoStackAnalyzerRecords[goid].LastStacks = GoStackAnalyzerRecords[goid].CurrentStacks
-					GoStackAnalyzerRecords[goid].CurrentStacks = stack
-					GoStackAnalyzerRecords[goid].CurrentMesure = currentTime
-				}
-				idsPresentOnThisRun[goid] = true
-			}
-			// Check if there are goroutines that are not present anymore
-			toDelete := [][32]uintptr{}
-			for goid := range GoStackAnalyzerRecords {
-				if _, ok := idsPresentOnThisRun[goid]; !ok {
-					// The goroutine is not present anymore, remove it
-					toDelete = append(toDelete, goid)
-				}
-			}
-			// Remove the goroutines that are not present anymore
-			for _, goid := range toDelete {
-				delete(GoStackAnalyzerRecords, goid)
+type goroutinesHangingWatchdog struct {
+	records map[[32]uintptr]*GoStackAnalyzerRecord
+	tiers   tierState
+}
+
+func (w *goroutinesHangingWatchdog) check(gd *GoDumpService, configs *GoDumpConfigs, sample *Sample) {
+	if w.records == nil {
+		w.records = make(map[[32]uintptr]*GoStackAnalyzerRecord)
+	}
+	// We map the goroutine id to the stack trace
+	// if the goroutine is still running, we update the stack trace in the map
+	// if a goroutine is not running anymore we remove it from the map
+	// if a goroutine has been having the same stack trace for a long time, we take a goroutine dump
+
+	// Get the stack and the goroutine id for all the goroutines
+	goroutines, ok := sample.goroutineStacks()
+	idsPresentOnThisRun := make(map[[32]uintptr]bool)
+	if !ok {
+		// Could not get the goroutines
+		gd.logger().Warn("godump could not read the goroutine profile", slog.String("watchdog", WatchdogGoroutinesHanging))
+		return
+	}
+	// Get the current time
+	currentTime := sample.Time
+	// Loop through the goroutines
+	for i := 0; i < len(goroutines); i++ {
+		// Get the goroutine id
+		goid := goroutines[i].Stack0
+		// Get the stack trace
+		stack := goroutines[i]
+		// Check if the goroutine is in the map
+		if _, ok := w.records[goid]; !ok {
+			// The goroutine is not in the map, add it
+			w.records[goid] = &GoStackAnalyzerRecord{
+				LastStacks:    runtime.StackRecord{},
+				CurrentStacks: stack,
+				CurrentMesure: currentTime,
+				LastChange:    currentTime,
 			}
-			stacksRemainedTheSameForTooLong := []GoStackAnalyzerRecord{}
-			// Check if any of the goroutines has the same stack trace for too long
-			for _, record := range GoStackAnalyzerRecords {
-				if compareStacks(record.LastStacks, record.CurrentStacks) {
-					// The stack trace has not changed
-					if currentTime.Sub(record.LastChange) > time.Duration(gd.configs.GoroutineDumpConfigs.GoroutineHangingTimeMs)*time.Millisecond {
-						// The stack trace has not changed for too long
-						stacksRemainedTheSameForTooLong = append(stacksRemainedTheSameForTooLong, *record)
-					}
-				} else {
-					// The stack trace has changed
-					record.LastChange = currentTime
-				}
+		} else {
+			// The goroutine is in the map, update it
+			w.records[goid].LastStacks = w.records[goid].CurrentStacks
+			w.records[goid].CurrentStacks = stack
+			w.records[goid].CurrentMesure = currentTime
+		}
+		idsPresentOnThisRun[goid] = true
+	}
+	// Check if there are goroutines that are not present anymore
+	toDelete := [][32]uintptr{}
+	for goid := range w.records {
+		if _, ok := idsPresentOnThisRun[goid]; !ok {
+			// The goroutine is not present anymore, remove it
+			toDelete = append(toDelete, goid)
+		}
+	}
+	// Remove the goroutines that are not present anymore
+	for _, goid := range toDelete {
+		delete(w.records, goid)
+	}
+	stacksRemainedTheSameForTooLong := []GoStackAnalyzerRecord{}
+	unchanged := []GoStackAnalyzerRecord{} // the stacks the tiers compare to their levels
+	tiers := configs.GoroutineDumpConfigs.GoroutineHangingTiers
+	state := stateReader(gd, sample)
+	// Check if any of the goroutines has the same stack trace for too long
+	for _, record := range w.records {
+		if compareStacks(record.LastStacks, record.CurrentStacks) {
+			// The stack trace has not changed
+			hangingTime := hangingTime(configs.GoroutineDumpConfigs, record, state)
+			if hangingTime > 0 && currentTime.Sub(record.LastChange) > hangingTime {
+				// The stack trace has not changed for too long
+				stacksRemainedTheSameForTooLong = append(stacksRemainedTheSameForTooLong, *record)
 			}
-			if len(stacksRemainedTheSameForTooLong) > 0 {
-				// take a goroutine dump
-				TakeGoroutineDump(gd.configs, stacksRemainedTheSameForTooLong)
+			if tiers != nil && !neverHanging(configs.GoroutineDumpConfigs, record) {
+				unchanged = append(unchanged, *record)
 			}
+		} else {
+			// The stack trace has changed
+			record.LastChange = currentTime
 		}
 	}
+	stacksRemainedTheSameForTooLong = w.withoutIgnored(gd, configs.GoroutineDumpConfigs, sample, stacksRemainedTheSameForTooLong)
+	if len(stacksRemainedTheSameForTooLong) > 0 {
+		gd.logger().Warn("godump hanging goroutines detected, taking a dump",
+			slog.String("watchdog", WatchdogGoroutinesHanging),
+			slog.Int("value", len(stacksRemainedTheSameForTooLong)),
+			slog.Uint64("threshold", configs.GoroutineDumpConfigs.GoroutineHangingTimeMs),
+		)
+		gd.emit(Event{
+			Type:      EventHangDetected,
+			Watchdog:  WatchdogGoroutinesHanging,
+			Value:     float64(len(stacksRemainedTheSameForTooLong)),
+			Threshold: float64(configs.GoroutineDumpConfigs.GoroutineHangingTimeMs),
+		})
+		// take a goroutine dump
+		gd.takeGoroutineDump(WatchdogGoroutinesHanging, stacksRemainedTheSameForTooLong)
+	}
+	if tiers != nil {
+		longest := time.Duration(0)
+		for _, record := range w.withoutIgnored(gd, configs.GoroutineDumpConfigs, sample, unchanged) {
+			longest = max(longest, currentTime.Sub(record.LastChange))
+		}
+		gd.checkTiers(WatchdogGoroutinesHanging, "", tiers, &w.tiers, float64(longest.Milliseconds()), 1, configs, sample)
+	}
+}
+
+// runWatchdog runs a single watchdog on its own sampler until ApplicationStopChannel receives a value
+func runWatchdog(gd GoDumpService, ApplicationStopChannel chan bool, SafeExitWg *sync.WaitGroup, name string, w watchdog, AvailableSystemMemory uint64) {
+	SafeExitWg.Add(1) // add one to the wait group
+	defer SafeExitWg.Done()
+	s := newSampler(AvailableSystemMemory)
+	s.watchdogs = []namedWatchdog{{name: name, watchdog: w}}
+	s.fixed = true
+	gd.runSampler(ApplicationStopChannel, s)
+}
+
+// WatchHeapBytes runs the heap bytes watchdog alone until ApplicationStopChannel receives a value
+//
+// Deprecated: Start runs every enabled watchdog from a single sampler, which is cheaper than one goroutine per watchdog
+func WatchHeapBytes(gd GoDumpService, ApplicationStopChannel chan bool, SafeExitWg *sync.WaitGroup) {
+	runWatchdog(gd, ApplicationStopChannel, SafeExitWg, WatchdogHeapBytes, &heapBytesWatchdog{}, 0)
+}
+
+// WatchHeapPercentage runs the heap percentage watchdog alone until ApplicationStopChannel receives a value
+//
+// Deprecated: Start runs every enabled watchdog from a single sampler, which is cheaper than one goroutine per watchdog
+func WatchHeapPercentage(gd GoDumpService, ApplicationStopChannel chan bool, SafeExitWg *sync.WaitGroup, AvailableSystemMemory uint64) {
+	runWatchdog(gd, ApplicationStopChannel, SafeExitWg, WatchdogHeapPercentage, &heapPercentageWatchdog{}, AvailableSystemMemory)
+}
+
+// WatchGoroutines runs the goroutine count watchdog alone until ApplicationStopChannel receives a value
+//
+// Deprecated: Start runs every enabled watchdog from a single sampler, which is cheaper than one goroutine per watchdog
+func WatchGoroutines(gd GoDumpService, ApplicationStopChannel chan bool, SafeExitWg *sync.WaitGroup) {
+	runWatchdog(gd, ApplicationStopChannel, SafeExitWg, WatchdogGoroutines, &goroutinesWatchdog{}, 0)
+}
+
+// WatchGoroutinesHanging runs the hanging goroutines watchdog alone until ApplicationStopChannel receives a value
+//
+// Deprecated: Start runs every enabled watchdog from a single sampler, which is cheaper than one goroutine per watchdog
+func WatchGoroutinesHanging(gd GoDumpService, ApplicationStopChannel chan bool, SafeExitWg *sync.WaitGroup) {
+	runWatchdog(gd, ApplicationStopChannel, SafeExitWg, WatchdogGoroutinesHanging, &goroutinesHangingWatchdog{}, 0)
 }
 
 type GoDumpService struct {
-	configs *GoDumpConfigs
+	configs    *atomic.Pointer[GoDumpConfigs]
+	log        *atomic.Pointer[slog.Logger] // derived from the configured logger when the configuration is stored
+	events     *eventBus
+	state      *serviceState
+	heartbeats *heartbeatRegistry
+	operations *operationRegistry
+	triggers   *triggerRegistry
 }
 
-func NewGoDumpService(configs *GoDumpConfigs) (*GoDumpService, error) {
-	if configs == nil {
-		return nil, fmt.Errorf("configs cannot be nil")
-	}
-	if configs.GoDumpHeap && configs.HeapDumpConfigs == nil {
-		return nil, fmt.Errorf("the variable 'HeapDumpConfigs' cannot be nil when GoDumpHeap is true")
-	}
-	if configs.GoDumpGoroutine && configs.GoroutineDumpConfigs == nil {
-		return nil, fmt.Errorf("the variable 'GoroutineDumpConfigs' cannot be nil when GoDumpGoroutine is true")
-	}
-	// Check configs
-	if configs.GoDumpHeap {
-		if configs.HeapDumpConfigs.HeapThresholdBytes == 0 && configs.HeapDumpConfigs.HeapThresholdPercentage == 0 {
-			return nil, fmt.Errorf("the variable 'HeapThresholdBytes' and 'HeapThresholdPercentage' cannot be both 0")
-		} else if configs.HeapDumpConfigs.HeapThresholdPercentage > 1 || configs.HeapDumpConfigs.HeapThresholdPercentage < 0 {
-			return nil, fmt.Errorf("the variable 'HeapThresholdPercentage' cannot be greater than 1 or less than 0")
-		}
-	}
-	if configs.GoDumpGoroutine {
-		if configs.GoroutineDumpConfigs.GoroutineThreshold == 0 && configs.GoroutineDumpConfigs.GoroutineHangingTimeMs == 0 {
-			return nil, fmt.Errorf("the variable 'GoroutineThreshold' and GoroutineHangingTimeMs' cannot be both 0")
-		}
+// serviceState is shared by every copy of the service
+type serviceState struct {
+	mu                    sync.Mutex
+	running               bool
+	SafeExitWg            *sync.WaitGroup
+	samplerStop           chan bool // closed to stop the sampler, nil while the sampler is not running
+	samplerDone           chan bool // closed when the last sampler started has exited
+	done                  chan bool // closed when the application stops the service
+	AvailableSystemMemory uint64
+	configFile            *configFileWatch
+	profiling             atomic.Bool // set while a CPU profile runs, see startCPUProfile
+}
+
+// config returns the configuration currently in use, the sampler reads it again on every tick
+func (gd *GoDumpService) config() *GoDumpConfigs {
+	return gd.configs.Load()
+}
+
+// storeConfig switches the service to a configuration and derives its logger once, the sampler logs on every tick
+func (gd *GoDumpService) storeConfig(configs *GoDumpConfigs) {
+	log := discardLogger
+	if configs.Logger != nil {
+		log = configs.Logger.With(slog.String("component", "godump"))
 	}
-	if configs.WatchdogIntervalMs == 0 {
-		return nil, fmt.Errorf("the variable 'WatchdogIntervalMs' cannot be 0")
+	gd.log.Store(log)
+	gd.configs.Store(configs)
+}
+
+func NewGoDumpService(configs *GoDumpConfigs) (*GoDumpService, error) {
+	if err := configs.Validate(); err != nil {
+		return nil, err
 	}
-	if configs.GoDumpPath == "" {
-		return nil, fmt.Errorf("the variable 'GoDumpPath' cannot be empty")
+	gd := &GoDumpService{
+		configs:    &atomic.Pointer[GoDumpConfigs]{},
+		log:        &atomic.Pointer[slog.Logger]{},
+		events:     &eventBus{},
+		state:      &serviceState{},
+		heartbeats: &heartbeatRegistry{},
+		operations: &operationRegistry{},
+		triggers:   &triggerRegistry{},
 	}
-	return &GoDumpService{
-		configs: configs,
-	}, nil
+	gd.storeConfig(configs)
+	return gd, nil
 }
 
 func (gd *GoDumpService) Start(ApplicationStopChannel chan bool, SafeExitWg *sync.WaitGroup) error {
-	// start the watchdogs
+	// start the sampler
 	AvailableSystemMemory, err := getAvailableMemory()
 	if err != nil {
+		gd.logger().Error("godump could not read the available system memory", slog.Any("error", err))
 		return err
 	}
-	if gd.configs.GoDumpHeap {
-		if gd.configs.HeapDumpConfigs.HeapThresholdBytes > 0 {
-			go WatchHeapBytes(*gd, ApplicationStopChannel, SafeExitWg)
-		}
-		if gd.configs.HeapDumpConfigs.HeapThresholdPercentage > 0 {
-			go WatchHeapPercentage(*gd, ApplicationStopChannel, SafeExitWg, AvailableSystemMemory)
-		}
+	gd.state.mu.Lock()
+	defer gd.state.mu.Unlock()
+	if gd.state.running {
+		return fmt.Errorf("the service is already running")
 	}
-	if gd.configs.GoDumpGoroutine {
-		if gd.configs.GoroutineDumpConfigs.GoroutineThreshold > 0 {
-			go WatchGoroutines(*gd, ApplicationStopChannel, SafeExitWg)
-		}
-		if gd.configs.GoroutineDumpConfigs.GoroutineHangingTimeMs > 0 {
-			go WatchGoroutinesHanging(*gd, ApplicationStopChannel, SafeExitWg)
-		}
+	gd.state.running = true
+	gd.state.done = make(chan bool)
+	gd.state.SafeExitWg = SafeExitWg
+	gd.state.AvailableSystemMemory = AvailableSystemMemory
+	gd.logConfigSummary("godump started")
+	gd.updateSampler()
+	if gd.state.configFile != nil {
+		SafeExitWg.Add(1)
+		go gd.pollConfigFile(gd.state.configFile, gd.state.done, SafeExitWg)
+	}
+	// A single value or closing the channel stops the service
+	SafeExitWg.Add(1)
+	go func() {
+		defer SafeExitWg.Done()
+		<-ApplicationStopChannel
+		gd.state.mu.Lock()
+		defer gd.state.mu.Unlock()
+		gd.state.running = false
+		gd.updateSampler()
+		close(gd.state.done)
+	}()
+	return nil
+}
+
+// updateSampler starts the sampler when the service runs with at least one watchdog enabled, heartbeat or trigger registered, or the
+// operations enabled, and stops it otherwise
+// The sampler follows configuration changes by itself, the caller holds gd.state.mu
+func (gd *GoDumpService) updateSampler() {
+	needed := gd.state.running && (len(enabledWatchdogs(gd.config())) > 0 || gd.heartbeats.count() > 0 || gd.operations.enabled.Load() || gd.triggers.count() > 0)
+	if needed && gd.state.samplerStop == nil {
+		previous := gd.state.samplerDone
+		gd.state.samplerStop = make(chan bool)
+		gd.state.samplerDone = make(chan bool)
+		gd.state.SafeExitWg.Add(1)
+		go func(stop chan bool, done chan bool, previous chan bool, s *sampler, SafeExitWg *sync.WaitGroup) {
+			defer SafeExitWg.Done()
+			defer close(done)
+			// A stopped sampler may still be in the middle of a tick, the watchdog state is only used by one sampler at a time
+			// The wait happens here and not in updateSampler, a callback running on the previous sampler may need gd.state.mu
+			if previous != nil {
+				<-previous
+			}
+			gd.runSampler(stop, s)
+		}(gd.state.samplerStop, gd.state.samplerDone, previous, newSampler(gd.state.AvailableSystemMemory), gd.state.SafeExitWg)
+	} else if !needed && gd.state.samplerStop != nil {
+		close(gd.state.samplerStop)
+		gd.state.samplerStop = nil
+	}
+}
+
+// ApplyConfig validates a new configuration and switches the service to it, the sampler picks it up on its next tick
+// An invalid configuration is rejected and the service keeps the configuration it had
+func (gd *GoDumpService) ApplyConfig(configs *GoDumpConfigs) error {
+	if err := configs.Validate(); err != nil {
+		gd.logger().Error("godump rejected the new configuration", slog.Any("error", err))
+		return err
 	}
+	gd.state.mu.Lock()
+	defer gd.state.mu.Unlock()
+	gd.storeConfig(configs)
+	gd.logConfigSummary("godump configuration applied")
+	gd.updateSampler()
 	return nil
 }
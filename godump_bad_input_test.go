@@ -96,6 +96,18 @@ func TestBadInput(t *testing.T) {
 				},
 			},
 		},
+		{
+			name: "Bad goroutine GoroutineHangingTimeMs < WatchdogIntervalMs",
+			config: &GoDumpConfigs{
+				GoDumpHeap:         false,
+				GoDumpGoroutine:    true,
+				GoDumpPath:         "./_test",
+				WatchdogIntervalMs: 1000,
+				GoroutineDumpConfigs: &DumpGoroutineConfigs{
+					GoroutineHangingTimeMs: 500,
+				},
+			},
+		},
 	}
 
 	for _, tc := range testCases {
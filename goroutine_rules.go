@@ -0,0 +1,244 @@
+package godump
+
+import (
+	"fmt"
+	"log/slog"
+	"regexp"
+	"strings"
+)
+
+/* Goroutine rules
+ A global GoroutineThreshold does not fit a service with 10k legitimate workers where 50 stuck HTTP client goroutines are a problem
+ GoroutineRules set a limit on the goroutines matching some selectors, evaluated from the goroutine profile on every sample:
+	- Function: a glob matched against every function of the stack, e.g. "net/http.(*persistConn).*"
+	- CreatedBy: a glob matched against the function that started the goroutine
+	- LabelKey / LabelValue: a pprof label set with pprof.Do or pprof.SetGoroutineLabels, any value when LabelValue is empty
+ A goroutine matches a rule when it matches every selector the rule sets, '*' matches any sequence of characters including '/'
+ In the configuration loaders the rules are written as "<selector>=<pattern>[, ...] > <limit>" separated by ';':
+	function=net/http.(*persistConn).* > 50; label=pool:workers > 10000; created_by=main.spawn > 100
+ Tiers are written after '>' in place of the limit, e.g. "function=net/http.* > warning=50, critical=200/10m"
+*/
+
+// GoroutineRule limits the number of goroutines matching its selectors
+type GoroutineRule struct {
+	Name       string // reported in Event.Detail, built from the selectors when empty
+	Function   string
+	CreatedBy  string
+	LabelKey   string
+	LabelValue string
+	Threshold  uint64 // the rule fires when more goroutines than this match
+	Tiers      *Tiers // warning, critical and emergency levels in matching goroutines, see tiers.go, Threshold is only checked next to them when it is set
+}
+
+const WatchdogGoroutineRules = "goroutine_rules"
+
+// globPattern compiles a glob where '*' matches any sequence of characters and '?' any single character
+func globPattern(glob string) (*regexp.Regexp, error) {
+	pattern := regexp.QuoteMeta(glob)
+	pattern = strings.ReplaceAll(pattern, `\*`, `.*`)
+	pattern = strings.ReplaceAll(pattern, `\?`, `.`)
+	return regexp.Compile("^" + pattern + "$")
+}
+
+// name returns the name of the rule as reported in the events and the dumps
+func (r *GoroutineRule) name() string {
+	if r.Name != "" {
+		return r.Name
+	}
+	selectors := []string{}
+	if r.Function != "" {
+		selectors = append(selectors, "function="+r.Function)
+	}
+	if r.CreatedBy != "" {
+		selectors = append(selectors, "created_by="+r.CreatedBy)
+	}
+	if r.LabelKey != "" {
+		label := "label=" + r.LabelKey
+		if r.LabelValue != "" {
+			label += ":" + r.LabelValue
+		}
+		selectors = append(selectors, label)
+	}
+	return strings.Join(selectors, ", ")
+}
+
+// validate reports the problems of the rule through invalid
+func (r *GoroutineRule) validate(invalid func(field string, reason string, args ...any), field string) {
+	if r.Function == "" && r.CreatedBy == "" && r.LabelKey == "" {
+		invalid(field, "needs at least one of 'Function', 'CreatedBy' or 'LabelKey'")
+	}
+	if r.LabelValue != "" && r.LabelKey == "" {
+		invalid(field+".LabelValue", "cannot be set without 'LabelKey'")
+	}
+	if r.Tiers != nil {
+		r.Tiers.validate(invalid, field+".Tiers", 0)
+	}
+}
+
+// compiledRule is a GoroutineRule with its globs compiled
+type compiledRule struct {
+	GoroutineRule
+	function  *regexp.Regexp
+	createdBy *regexp.Regexp
+}
+
+func compileRule(rule GoroutineRule) compiledRule {
+	compiled := compiledRule{GoroutineRule: rule}
+	// The globs always compile, everything but '*' and '?' is quoted
+	if rule.Function != "" {
+		compiled.function, _ = globPattern(rule.Function)
+	}
+	if rule.CreatedBy != "" {
+		compiled.createdBy, _ = globPattern(rule.CreatedBy)
+	}
+	return compiled
+}
+
+func (r *compiledRule) matchFunctions(functions []string) bool {
+	if r.function == nil {
+		return true
+	}
+	for _, function := range functions {
+		if r.function.MatchString(function) {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *compiledRule) matchLabels(labels map[string]string) bool {
+	if r.LabelKey == "" {
+		return true
+	}
+	value, ok := labels[r.LabelKey]
+	return ok && (r.LabelValue == "" || r.LabelValue == value)
+}
+
+// count returns the number of goroutines matching the rule and the stack of one of them
+// Without CreatedBy the counts come from the goroutine groups, where the labels are always known
+func (r *compiledRule) count(goroutines []goroutineInfo, groups []goroutineGroup) (uint64, string) {
+	count := uint64(0)
+	example := ""
+	if r.createdBy == nil {
+		for _, group := range groups {
+			if r.matchFunctions(group.Functions) && r.matchLabels(group.Labels) {
+				count += uint64(group.Count)
+			}
+		}
+	}
+	for _, g := range goroutines {
+		if !r.matchFunctions(g.Functions) || !r.matchLabels(g.Labels) {
+			continue
+		}
+		if r.createdBy != nil {
+			if !r.createdBy.MatchString(g.CreatedBy) {
+				continue
+			}
+			count++
+		}
+		if example == "" {
+			example = g.Stack
+		}
+	}
+	return count, example
+}
+
+type goroutineRulesWatchdog struct {
+	configs  *GoDumpConfigs // the configuration the rules were compiled from
+	compiled []compiledRule
+	above    map[string]bool
+	tiers    map[string]*tierState
+}
+
+func (w *goroutineRulesWatchdog) check(gd *GoDumpService, configs *GoDumpConfigs, sample *Sample) {
+	goroutines, groups, err := sample.goroutineProfile()
+	if err != nil {
+		gd.logger().Warn("godump could not read the goroutine profile", slog.String("watchdog", WatchdogGoroutineRules), slog.Any("error", err))
+		return
+	}
+	if w.above == nil {
+		w.above = map[string]bool{}
+		w.tiers = map[string]*tierState{}
+	}
+	if configs != w.configs {
+		// The globs are compiled once per configuration, like the sampler syncs its watchdogs
+		w.configs = configs
+		w.compiled = w.compiled[:0]
+		for _, rule := range configs.GoroutineDumpConfigs.GoroutineRules {
+			w.compiled = append(w.compiled, compileRule(rule))
+		}
+	}
+	exceeded := dumpSection{title: "Goroutine Rules Exceeded"}
+	for _, compiled := range w.compiled {
+		rule := compiled.GoroutineRule
+		name := rule.name()
+		count, example := compiled.count(goroutines, groups)
+		if rule.Tiers != nil {
+			if w.tiers[name] == nil {
+				w.tiers[name] = &tierState{}
+			}
+			gd.checkTiers(WatchdogGoroutineRules, name, rule.Tiers, w.tiers[name], float64(count), 1, configs, sample)
+			if rule.Threshold == 0 {
+				// the tiers may be set without the threshold
+				continue
+			}
+		}
+		above := w.above[name]
+		if gd.checkDetailThreshold(WatchdogGoroutineRules, name, &above, float64(count), float64(rule.Threshold)) {
+			exceeded.lines = append(exceeded.lines, fmt.Sprintf("%s: %d goroutines, limit %d", name, count, rule.Threshold))
+			if example != "" {
+				exceeded.lines = append(exceeded.lines, example, "")
+			}
+		}
+		w.above[name] = above
+	}
+	if len(exceeded.lines) > 0 {
+		gd.takeGoroutineDump(WatchdogGoroutineRules, nil, exceeded)
+	}
+}
+
+// parseGoroutineRules parses rules written as "function=net/http.* > 50; label=pool:workers > 10000"
+func parseGoroutineRules(value string) ([]GoroutineRule, error) {
+	rules := []GoroutineRule{}
+	for _, text := range strings.Split(value, ";") {
+		text = strings.TrimSpace(text)
+		if text == "" {
+			continue
+		}
+		end := strings.LastIndex(text, ">")
+		if end < 0 {
+			return nil, fmt.Errorf("invalid goroutine rule %q: expected <selector>=<pattern> > <limit>", text)
+		}
+		rule := GoroutineRule{}
+		var err error
+		if limit := text[end+1:]; strings.Contains(limit, "=") {
+			rule.Tiers, err = parseTiers(limit, parseCountLevel)
+		} else {
+			rule.Threshold, err = parseCount(limit)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid goroutine rule %q: %w", text, err)
+		}
+		for _, selector := range strings.Split(text[:end], ",") {
+			key, pattern, ok := strings.Cut(strings.TrimSpace(selector), "=")
+			pattern = strings.TrimSpace(pattern)
+			if !ok || pattern == "" {
+				return nil, fmt.Errorf("invalid goroutine rule %q: expected <selector>=<pattern>, got %q", text, selector)
+			}
+			switch strings.TrimSpace(key) {
+			case "function":
+				rule.Function = pattern
+			case "created_by":
+				rule.CreatedBy = pattern
+			case "label":
+				rule.LabelKey, rule.LabelValue, _ = strings.Cut(pattern, ":")
+			case "name":
+				rule.Name = pattern
+			default:
+				return nil, fmt.Errorf("invalid goroutine rule %q: unknown selector %q, expected function, created_by, label or name", text, key)
+			}
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
@@ -0,0 +1,134 @@
+package godump
+
+import (
+	"context"
+	"os"
+	"runtime/pprof"
+	"strings"
+	"testing"
+)
+
+func TestParseGoroutineRules(t *testing.T) {
+	rules, err := parseGoroutineRules("function=net/http.(*persistConn).* > 50; label=pool:workers, name=workers > 10k;")
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	if len(rules) != 2 {
+		t.Fatalf("Error: Expected 2 rules, got %+v", rules)
+	}
+	if rules[0].Function != "net/http.(*persistConn).*" || rules[0].Threshold != 50 || rules[0].name() != "function=net/http.(*persistConn).*" {
+		t.Errorf("Error: Unexpected first rule %+v", rules[0])
+	}
+	if rules[1].LabelKey != "pool" || rules[1].LabelValue != "workers" || rules[1].Threshold != 10000 || rules[1].name() != "workers" {
+		t.Errorf("Error: Unexpected second rule %+v", rules[1])
+	}
+	rules, err = parseGoroutineRules("created_by=database/sql.* > warning=100, critical=500/10m")
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	if len(rules) != 1 || rules[0].Threshold != 0 || rules[0].Tiers == nil ||
+		*rules[0].Tiers != (Tiers{Warning: 100, Critical: 500, CriticalCooldownMs: 600000}) {
+		t.Errorf("Error: Expected a rule with tiers, got %+v", rules)
+	}
+	for _, bad := range []string{"function=main.* 50", "stack=main.* > 1", "function= > 1", "function=main.* > many", "function=main.* > severe=1"} {
+		if _, err := parseGoroutineRules(bad); err == nil {
+			t.Errorf("Error: Expected an error for %q", bad)
+		}
+	}
+}
+
+func TestGoroutineRuleMatching(t *testing.T) {
+	goroutines := parseGoroutines(testGoroutinesDebug2)
+	groups := parseGoroutineGroups(testGoroutinesDebug1)
+	assignGroupLabels(goroutines, groups)
+	for _, test := range []struct {
+		rule     GoroutineRule
+		expected uint64
+	}{
+		{GoroutineRule{Function: "main.*"}, 3},
+		{GoroutineRule{Function: "main.(*server).*"}, 1},
+		{GoroutineRule{CreatedBy: "main.main*"}, 1},
+		{GoroutineRule{LabelKey: "op"}, 1},
+		{GoroutineRule{LabelKey: "op", LabelValue: "x"}, 0},
+		{GoroutineRule{Function: "/tmp/*"}, 0},
+	} {
+		compiled := compileRule(test.rule)
+		if count, _ := compiled.count(goroutines, groups); count != test.expected {
+			t.Errorf("Error: Expected %v goroutines for %+v, got %v", test.expected, test.rule, count)
+		}
+	}
+}
+
+func TestGoroutineRulesWatchdog(t *testing.T) {
+	stop := make(chan bool)
+	defer close(stop)
+	pprof.Do(context.Background(), pprof.Labels("pool", "godump_test"), func(context.Context) {
+		leakGoroutines(5, stop)
+	})
+	configs := &GoDumpConfigs{
+		GoDumpGoroutine:    true,
+		GoDumpPath:         t.TempDir(),
+		WatchdogIntervalMs: 1000,
+		GoroutineDumpConfigs: &DumpGoroutineConfigs{
+			GoroutineRules: []GoroutineRule{
+				{LabelKey: "pool", LabelValue: "godump_test", Threshold: 3},
+				{Function: "*leakGoroutines*", Threshold: 100},
+			},
+		},
+	}
+	gds, err := NewGoDumpService(configs)
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	var received []Event
+	gds.OnEvent(func(e Event) { received = append(received, e) })
+	(&goroutineRulesWatchdog{}).check(gds, configs, &Sample{})
+	if len(received) != 2 || received[0].Detail != "label=pool:godump_test" || received[0].Value != 5 || received[1].Type != EventDumpWritten {
+		t.Fatalf("Error: Expected the label rule to fire, got %+v", received)
+	}
+	dump, err := os.ReadFile(received[1].File)
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	if !strings.Contains(string(dump), "label=pool:godump_test: 5 goroutines, limit 3") {
+		t.Errorf("Error: Expected the dump to name the rule, got %s", dump)
+	}
+
+	// The rules are compiled once per configuration
+	w := &goroutineRulesWatchdog{}
+	w.check(gds, configs, &Sample{})
+	compiled := w.compiled[1].function
+	w.check(gds, configs, &Sample{})
+	if w.compiled[1].function != compiled {
+		t.Errorf("Error: Expected the rules to be compiled once for the same configuration")
+	}
+	changed := *configs
+	w.check(gds, &changed, &Sample{})
+	if w.compiled[1].function == compiled {
+		t.Errorf("Error: Expected the rules to be compiled again for a new configuration")
+	}
+}
+
+func TestValidateGoroutineRules(t *testing.T) {
+	configs := &GoDumpConfigs{
+		GoDumpGoroutine:    true,
+		GoDumpPath:         t.TempDir(),
+		WatchdogIntervalMs: 1000,
+		GoroutineDumpConfigs: &DumpGoroutineConfigs{
+			GoroutineRules: []GoroutineRule{{Threshold: 3}, {LabelValue: "x", Function: "main.*"}},
+		},
+	}
+	err := configs.Validate()
+	if err == nil || !strings.Contains(err.Error(), "GoroutineRules[0]") || !strings.Contains(err.Error(), "GoroutineRules[1].LabelValue") {
+		t.Errorf("Error: Expected both rules to be rejected, got %v", err)
+	}
+
+	configs.GoroutineDumpConfigs.GoroutineRules, err = parseGoroutineRules("function=net/http.* > 50; function=net/http.* > warning=100")
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	err = configs.Validate()
+	if err == nil || !strings.Contains(err.Error(), "'GoroutineDumpConfigs.GoroutineRules[1].Name' must be unique") {
+		t.Errorf("Error: Expected rules sharing a name to be rejected, got %v", err)
+	}
+}
@@ -0,0 +1,195 @@
+package godump
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"runtime/pprof"
+	"sort"
+	"strings"
+	"time"
+)
+
+/* Global stall detection
+ The hang detection looks at each goroutine on its own, a deadlock or a stall of the whole program shows as nearly every goroutine
+ blocked at the same time with none of them moving. On every sample the goroutine profile is compared to the previous one:
+	- A goroutine is blocked when it waits on a channel, a select, a lock, a sync.Cond or a WaitGroup, goroutines that are
+	  running, in a syscall, in IO wait or sleeping can still make progress
+	- The goroutines of the hang ignore list (HangIgnore and DefaultHangIgnore) are left out of the counts
+	- The program made progress when a goroutine started, exited or changed its stack since the previous sample
+ When more than GoroutineStallFraction of the goroutines are blocked and no progress was made for GoroutineStallSamples samples in a row,
+ the stall is reported with a dedicated report grouping the blocked goroutines by state and wait site
+*/
+
+const (
+	DefaultGoroutineStallSamples      = 3
+	DefaultGoroutineStallReportPrefix = "stallreport"
+)
+
+const WatchdogGoroutineStall = "goroutine_stall"
+
+// blockedStates are the wait states of the goroutines that cannot make progress by themselves
+var blockedStates = map[string]bool{
+	"chan send":               true,
+	"chan receive":            true,
+	"chan send (nil chan)":    true,
+	"chan receive (nil chan)": true,
+	"select":                  true,
+	"select (no cases)":       true,
+	"semacquire":              true,
+	"sync.Mutex.Lock":         true,
+	"sync.RWMutex.Lock":       true,
+	"sync.RWMutex.RLock":      true,
+	"sync.Cond.Wait":          true,
+	"sync.WaitGroup.Wait":     true,
+}
+
+// waitSite names the first frame of the goroutine outside of the runtime and the sync package, where it waits
+func (g *goroutineInfo) waitSite() string {
+	for i, function := range g.Functions {
+		if !strings.HasPrefix(function, "runtime.") && !strings.HasPrefix(function, "sync.") && !strings.HasPrefix(function, "internal/") {
+			return function + " at " + g.Locations[i]
+		}
+	}
+	if len(g.Functions) > 0 {
+		return g.Functions[0] + " at " + g.Locations[0]
+	}
+	return "unknown"
+}
+
+// stallGroup is the blocked goroutines sharing a state and a wait site
+type stallGroup struct {
+	state   string
+	site    string
+	count   int
+	example string
+}
+
+type goroutineStallWatchdog struct {
+	stacks  map[uint64]string // stack of every counted goroutine on the previous sample
+	samples uint64            // samples in a row without progress with most goroutines blocked
+	above   bool
+}
+
+func (w *goroutineStallWatchdog) check(gd *GoDumpService, configs *GoDumpConfigs, sample *Sample) {
+	goroutineConfigs := configs.GoroutineDumpConfigs
+	goroutines, _, err := sample.goroutineProfile()
+	if err != nil {
+		gd.logger().Warn("godump could not read the goroutine profile", slog.String("watchdog", WatchdogGoroutineStall), slog.Any("error", err))
+		return
+	}
+	ignores := compileHangIgnores(goroutineConfigs)
+	stacks := make(map[uint64]string, len(goroutines))
+	blocked := []*goroutineInfo{}
+	for i := range goroutines {
+		g := &goroutines[i]
+		ignored := false
+		for j := range ignores {
+			if ignores[j].match(g.Functions, []*goroutineInfo{g}) {
+				ignored = true
+				break
+			}
+		}
+		if ignored {
+			continue
+		}
+		// The header holds the minutes spent waiting, only the stack tells if the goroutine moved
+		_, stacks[g.ID], _ = strings.Cut(g.Stack, "\n")
+		if blockedStates[g.State] {
+			blocked = append(blocked, g)
+		}
+	}
+	fraction := 0.0
+	if len(stacks) > 0 {
+		fraction = float64(len(blocked)) / float64(len(stacks))
+	}
+	progressed := w.stacks == nil || len(stacks) != len(w.stacks)
+	for id, stack := range stacks {
+		if progressed {
+			break
+		}
+		if previous, ok := w.stacks[id]; !ok || previous != stack {
+			progressed = true
+		}
+	}
+	w.stacks = stacks
+	if progressed || fraction <= goroutineConfigs.GoroutineStallFraction {
+		w.samples = 0
+	} else {
+		w.samples++
+	}
+	samples := goroutineConfigs.GoroutineStallSamples
+	if samples == 0 {
+		samples = DefaultGoroutineStallSamples
+	}
+	value := 0.0
+	if w.samples >= samples {
+		value = fraction
+	}
+	groups := groupBlocked(blocked)
+	detail := ""
+	if len(groups) > 0 {
+		detail = groups[0].state + " " + groups[0].site
+	}
+	if gd.checkDetailThreshold(WatchdogGoroutineStall, detail, &w.above, value, goroutineConfigs.GoroutineStallFraction) {
+		file, err := writeStallReport(configs, len(stacks), w.samples, groups)
+		gd.emitDump(WatchdogGoroutineStall, file, err)
+	}
+}
+
+// groupBlocked groups the blocked goroutines by state and wait site, the biggest groups first
+func groupBlocked(blocked []*goroutineInfo) []stallGroup {
+	byKey := map[string]*stallGroup{}
+	for _, g := range blocked {
+		site := g.waitSite()
+		key := g.State + "\n" + site
+		group, ok := byKey[key]
+		if !ok {
+			group = &stallGroup{state: g.State, site: site, example: g.Stack}
+			byKey[key] = group
+		}
+		group.count++
+	}
+	groups := make([]stallGroup, 0, len(byKey))
+	for _, group := range byKey {
+		groups = append(groups, *group)
+	}
+	sort.Slice(groups, func(i, j int) bool {
+		if groups[i].count != groups[j].count {
+			return groups[i].count > groups[j].count
+		}
+		return groups[i].state+groups[i].site < groups[j].state+groups[j].site
+	})
+	return groups
+}
+
+// writeStallReport writes the blocked goroutines grouped by wait site and returns the path of the file it created
+func writeStallReport(goDumpConfigs *GoDumpConfigs, total int, samples uint64, groups []stallGroup) (string, error) {
+	var prefix *string
+	if goDumpConfigs.GoroutineDumpConfigs != nil {
+		prefix = goDumpConfigs.GoroutineDumpConfigs.GoroutineStallReportPrefix
+	}
+	return writeDumpFile(dumpFilePath(goDumpConfigs, prefix, DefaultGoroutineStallReportPrefix, ".txt"), func(f *os.File) error {
+		blocked := 0
+		for _, group := range groups {
+			blocked += group.count
+		}
+		f.WriteString("Probable Deadlock or Stall Report\n---\n")
+		f.WriteString("Time: " + time.Now().Format("2006-01-02T15:04:05") + "\n")
+		fmt.Fprintf(f, "Goroutines: %d, blocked: %d (%.0f%%), no progress for %d samples\n", total, blocked, 100*float64(blocked)/float64(max(total, 1)), samples)
+		f.WriteString("---\n\n")
+		f.WriteString("Blocked Goroutines by Wait Site:\n")
+		fmt.Fprintf(f, "%8s  %-24s %s\n", "Count", "State", "Wait Site")
+		for _, group := range groups {
+			fmt.Fprintf(f, "%8d  %-24s %s\n", group.count, group.state, group.site)
+		}
+		for _, group := range groups {
+			f.WriteString("---\n\n")
+			fmt.Fprintf(f, "%d goroutines in %s, %s, for example:\n", group.count, group.state, group.site)
+			f.WriteString(group.example + "\n")
+		}
+		f.WriteString("---\n\n")
+		f.WriteString("Goroutines:\n")
+		return pprof.Lookup("goroutine").WriteTo(f, 2)
+	})
+}
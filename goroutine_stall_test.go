@@ -0,0 +1,113 @@
+package godump
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+const testStalledGoroutines = `goroutine 1 [chan receive, 2 minutes]:
+main.main()
+	/tmp/gp/main.go:22 +0x1a5
+
+goroutine 6 [sync.Mutex.Lock]:
+sync.(*Mutex).Lock(...)
+	/usr/local/go/src/sync/mutex.go:46
+main.transfer(0xc000010000)
+	/tmp/gp/bank.go:10 +0x2c
+created by main.main in goroutine 1
+	/tmp/gp/main.go:15 +0x65
+
+goroutine 7 [sync.Mutex.Lock]:
+sync.(*Mutex).Lock(...)
+	/usr/local/go/src/sync/mutex.go:46
+main.transfer(0xc000010010)
+	/tmp/gp/bank.go:10 +0x2c
+created by main.main in goroutine 1
+	/tmp/gp/main.go:15 +0x65
+
+goroutine 8 [IO wait]:
+main.serve()
+	/tmp/gp/server.go:40 +0x2c
+created by main.main in goroutine 1
+	/tmp/gp/main.go:16 +0x11
+`
+
+func stallSample(profile string) *Sample {
+	return &Sample{goroutines: parseGoroutines(profile), goroutinesRead: true}
+}
+
+func TestGoroutineStallWatchdog(t *testing.T) {
+	configs := &GoDumpConfigs{
+		GoDumpGoroutine:    true,
+		GoDumpPath:         t.TempDir(),
+		WatchdogIntervalMs: 1000,
+		GoroutineDumpConfigs: &DumpGoroutineConfigs{
+			GoroutineStallFraction: 0.7,
+			GoroutineStallSamples:  2,
+		},
+	}
+	gds, err := NewGoDumpService(configs)
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	var received []Event
+	gds.OnEvent(func(e Event) { received = append(received, e) })
+
+	w := &goroutineStallWatchdog{}
+	// 3 of the 4 goroutines are blocked, the first sample is the baseline and a stall needs 2 samples without progress
+	for i := 0; i < 2; i++ {
+		w.check(gds, configs, stallSample(testStalledGoroutines))
+	}
+	if len(received) != 0 {
+		t.Fatalf("Error: Expected no event before GoroutineStallSamples, got %+v", received)
+	}
+	w.check(gds, configs, stallSample(testStalledGoroutines))
+	if len(received) != 2 || received[0].Type != EventThresholdCrossed || received[0].Value != 0.75 ||
+		received[0].Detail != "sync.Mutex.Lock main.transfer at /tmp/gp/bank.go:10" || received[1].Type != EventDumpWritten {
+		t.Fatalf("Error: Expected the stall to be reported, got %+v", received)
+	}
+	report, err := os.ReadFile(received[1].File)
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	for _, expected := range []string{"Goroutines: 4, blocked: 3 (75%), no progress for 2 samples", "2 goroutines in sync.Mutex.Lock, main.transfer at /tmp/gp/bank.go:10"} {
+		if !strings.Contains(string(report), expected) {
+			t.Errorf("Error: Expected %q in the report, got %s", expected, report)
+		}
+	}
+
+	// A goroutine moving is progress
+	received = nil
+	w.check(gds, configs, stallSample(strings.Replace(testStalledGoroutines, "server.go:40", "server.go:41", 1)))
+	if len(received) != 1 || received[0].Type != EventThresholdRecovered {
+		t.Errorf("Error: Expected the stall to recover, got %+v", received)
+	}
+}
+
+func TestGoroutineStallIgnoresHangIgnoreList(t *testing.T) {
+	configs := &GoDumpConfigs{
+		GoDumpGoroutine:    true,
+		GoDumpPath:         t.TempDir(),
+		WatchdogIntervalMs: 1000,
+		GoroutineDumpConfigs: &DumpGoroutineConfigs{
+			GoroutineStallFraction: 0.7,
+			GoroutineStallSamples:  1,
+			HangIgnore:             []HangIgnore{{Function: "main.transfer"}},
+		},
+	}
+	gds, err := NewGoDumpService(configs)
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	var received []Event
+	gds.OnEvent(func(e Event) { received = append(received, e) })
+	w := &goroutineStallWatchdog{}
+	for i := 0; i < 3; i++ {
+		w.check(gds, configs, stallSample(testStalledGoroutines))
+	}
+	// Without the ignored goroutines only 1 of 2 is blocked
+	if len(received) != 0 {
+		t.Errorf("Error: Expected the ignored goroutines to be left out, got %+v", received)
+	}
+}
@@ -0,0 +1,264 @@
+package godump
+
+import (
+	"bytes"
+	"encoding/json"
+	"runtime/pprof"
+	"strconv"
+	"strings"
+	"time"
+)
+
+/* Goroutine profile parsing
+ Some watchdogs need more than the stacks of runtime.GoroutineProfile: the state of each goroutine, the function that created it
+ and its pprof labels, they are read from the text goroutine profile:
+	- debug=2 lists every goroutine with its state, how long it has been waiting, its stack and its "created by" site
+	- debug=1 groups the goroutines with the same stack and labels, with their count
+ Tracebacks only print the labels from Go 1.27 (GODEBUG tracebacklabels=1), on older runtimes the labels of a goroutine are taken
+ from the debug=1 groups with the same stack, and stay unknown when the goroutines with that stack do not all carry the same labels
+*/
+
+// goroutineInfo is one goroutine of the debug=2 goroutine profile
+type goroutineInfo struct {
+	ID        uint64
+	State     string            // e.g. "chan receive", "IO wait", "running"
+	Waiting   time.Duration     // how long the goroutine has been blocked, the runtime only reports whole minutes
+	Functions []string          // functions of the stack, innermost first
+	Locations []string          // file:line of each function
+	CreatedBy string            // function that started the goroutine, empty for the main goroutine
+	CreatedAt string            // file:line of the go statement
+	Labels    map[string]string // nil when unknown
+	Stack     string            // the goroutine as printed by the runtime
+}
+
+// creationSite names the go statement that started the goroutine, empty for the main goroutine
+func (g *goroutineInfo) creationSite() string {
+	if g.CreatedBy == "" {
+		return ""
+	}
+	return g.CreatedBy + " at " + g.CreatedAt
+}
+
+// goroutineGroup is one entry of the debug=1 goroutine profile
+type goroutineGroup struct {
+	Count     int
+	Labels    map[string]string
+	Functions []string
+	Locations []string
+}
+
+// readGoroutines reads the goroutine profile with both levels of detail
+func readGoroutines() ([]goroutineInfo, []goroutineGroup, error) {
+	var buf bytes.Buffer
+	if err := pprof.Lookup("goroutine").WriteTo(&buf, 1); err != nil {
+		return nil, nil, err
+	}
+	groups := parseGoroutineGroups(buf.String())
+	buf.Reset()
+	if err := pprof.Lookup("goroutine").WriteTo(&buf, 2); err != nil {
+		return nil, nil, err
+	}
+	goroutines := parseGoroutines(buf.String())
+	assignGroupLabels(goroutines, groups)
+	return goroutines, groups, nil
+}
+
+// parseGoroutines parses a debug=2 goroutine profile, the format of runtime.Stack for every goroutine
+func parseGoroutines(profile string) []goroutineInfo {
+	goroutines := []goroutineInfo{}
+	for _, block := range strings.Split(strings.TrimSpace(profile), "\n\n") {
+		lines := strings.Split(block, "\n")
+		g, ok := parseGoroutineHeader(lines[0])
+		if !ok {
+			continue
+		}
+		g.Stack = block
+		for i := 1; i < len(lines); i++ {
+			line := lines[i]
+			if strings.HasPrefix(line, "\t") || strings.HasPrefix(line, "...") {
+				continue
+			}
+			location := ""
+			if i+1 < len(lines) && strings.HasPrefix(lines[i+1], "\t") {
+				location = strings.TrimSpace(lines[i+1])
+				// Drop the program counter offset, e.g. "/src/main.go:12 +0x2c"
+				if space := strings.LastIndex(location, " +0x"); space >= 0 {
+					location = location[:space]
+				}
+			}
+			if creator, ok := strings.CutPrefix(line, "created by "); ok {
+				if in := strings.Index(creator, " in goroutine "); in >= 0 {
+					creator = creator[:in]
+				}
+				g.CreatedBy, g.CreatedAt = creator, location
+				continue
+			}
+			function := line
+			if strings.HasSuffix(line, ")") {
+				if open := strings.LastIndex(line, "("); open > 0 {
+					function = line[:open]
+				}
+			}
+			g.Functions = append(g.Functions, function)
+			g.Locations = append(g.Locations, location)
+		}
+		goroutines = append(goroutines, g)
+	}
+	return goroutines
+}
+
+// parseGoroutineHeader parses a line such as "goroutine 7 [chan receive, 3 minutes, locked to thread] {op: x}:"
+func parseGoroutineHeader(line string) (goroutineInfo, bool) {
+	g := goroutineInfo{}
+	rest, ok := strings.CutPrefix(line, "goroutine ")
+	if !ok {
+		return g, false
+	}
+	id, rest, _ := strings.Cut(rest, " ")
+	var err error
+	if g.ID, err = strconv.ParseUint(id, 10, 64); err != nil {
+		return g, false
+	}
+	open, end := strings.Index(rest, "["), strings.Index(rest, "]")
+	if open < 0 || end < open {
+		return g, false
+	}
+	for i, part := range strings.Split(rest[open+1:end], ", ") {
+		if i == 0 {
+			g.State = part
+		} else if minutes, ok := strings.CutSuffix(part, " minutes"); ok {
+			if n, err := strconv.Atoi(minutes); err == nil {
+				g.Waiting = time.Duration(n) * time.Minute
+			}
+		}
+	}
+	labels := strings.TrimSuffix(strings.TrimSpace(rest[end+1:]), ":")
+	if strings.HasPrefix(labels, "{") && strings.HasSuffix(labels, "}") {
+		g.Labels = parseTracebackLabels(labels[1 : len(labels)-1])
+	}
+	return g, true
+}
+
+// parseTracebackLabels parses the labels of a traceback header, "key: value, key2: value2" where the keys and values
+// are quoted when they contain special characters
+func parseTracebackLabels(text string) map[string]string {
+	labels := map[string]string{}
+	token := func() string {
+		text = strings.TrimLeft(text, " ")
+		if strings.HasPrefix(text, `"`) {
+			if quoted, err := strconv.QuotedPrefix(text); err == nil {
+				text = text[len(quoted):]
+				value, _ := strconv.Unquote(quoted)
+				return value
+			}
+		}
+		end := strings.IndexAny(text, ":,")
+		if end < 0 {
+			end = len(text)
+		}
+		value := text[:end]
+		text = text[end:]
+		return strings.TrimSpace(value)
+	}
+	for text != "" {
+		key := token()
+		text = strings.TrimPrefix(text, ":")
+		value := token()
+		text = strings.TrimPrefix(text, ",")
+		labels[key] = value
+	}
+	return labels
+}
+
+// parseGoroutineGroups parses a debug=1 goroutine profile
+func parseGoroutineGroups(profile string) []goroutineGroup {
+	groups := []goroutineGroup{}
+	for _, block := range strings.Split(strings.TrimSpace(profile), "\n\n") {
+		group := goroutineGroup{}
+		for _, line := range strings.Split(block, "\n") {
+			switch {
+			case strings.HasPrefix(line, "goroutine profile:"):
+			case strings.HasPrefix(line, "# labels: "):
+				json.Unmarshal([]byte(strings.TrimPrefix(line, "# labels: ")), &group.Labels)
+			case strings.HasPrefix(line, "#"):
+				// "#	0x4e14b8	main.worker+0x18	/src/main.go:10"
+				fields := strings.Fields(line)
+				if len(fields) < 4 {
+					continue
+				}
+				function := fields[2]
+				if plus := strings.LastIndex(function, "+0x"); plus >= 0 {
+					function = function[:plus]
+				}
+				group.Functions = append(group.Functions, function)
+				group.Locations = append(group.Locations, fields[len(fields)-1])
+			default:
+				// "2 @ 0x47d82a 0x41512e"
+				count, _, _ := strings.Cut(line, " @ ")
+				group.Count, _ = strconv.Atoi(count)
+			}
+		}
+		if group.Count > 0 {
+			groups = append(groups, group)
+		}
+	}
+	return groups
+}
+
+// stackSignature identifies a stack by its non-runtime frames, which both levels of detail print the same way
+func stackSignature(functions, locations []string) string {
+	var signature strings.Builder
+	for i, function := range functions {
+		if strings.HasPrefix(function, "runtime.") {
+			continue
+		}
+		signature.WriteString(function + " " + locations[i] + "\n")
+	}
+	return signature.String()
+}
+
+// assignGroupLabels gives their labels to the goroutines whose traceback does not print them
+// A goroutine is only labeled when every group with its stack carries the same labels
+func assignGroupLabels(goroutines []goroutineInfo, groups []goroutineGroup) {
+	type candidate struct {
+		labels    map[string]string
+		ambiguous bool
+	}
+	bySignature := map[string]*candidate{}
+	for _, group := range groups {
+		signature := stackSignature(group.Functions, group.Locations)
+		c, ok := bySignature[signature]
+		if !ok {
+			bySignature[signature] = &candidate{labels: group.Labels}
+			continue
+		}
+		if !sameLabels(c.labels, group.Labels) {
+			c.ambiguous = true
+		}
+	}
+	for i := range goroutines {
+		if goroutines[i].Labels != nil {
+			continue
+		}
+		c, ok := bySignature[stackSignature(goroutines[i].Functions, goroutines[i].Locations)]
+		if !ok || c.ambiguous {
+			continue
+		}
+		goroutines[i].Labels = c.labels
+		if goroutines[i].Labels == nil {
+			goroutines[i].Labels = map[string]string{}
+		}
+	}
+}
+
+func sameLabels(a, b map[string]string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for key, value := range a {
+		if other, ok := b[key]; !ok || other != value {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,107 @@
+package godump
+
+import (
+	"context"
+	"runtime/pprof"
+	"testing"
+	"time"
+)
+
+const testGoroutinesDebug2 = `goroutine 1 [running]:
+main.main()
+	/tmp/gp/main.go:22 +0x1a5
+
+goroutine 6 [chan receive, 3 minutes]:
+main.worker(...)
+	/tmp/gp/main.go:10
+created by main.main.func1 in goroutine 1
+	/tmp/gp/main.go:15 +0x65
+
+goroutine 7 [select, locked to thread] {op: x, "route": "/a b"}:
+main.(*server).loop(0xc000010000)
+	/tmp/gp/server.go:40 +0x2c
+created by main.start
+	/tmp/gp/main.go:30 +0x11
+`
+
+const testGoroutinesDebug1 = `goroutine profile: total 3
+1 @ 0x440e11 0x47cb9d
+#	0x4e142d	main.main+0x14d				/tmp/gp/main.go:22
+
+1 @ 0x47d82a 0x41512e
+# labels: {"op":"y"}
+#	0x4e14b8	main.worker+0x18	/tmp/gp/main.go:10
+
+1 @ 0x47d82a 0x41512f
+#	0x4e15f8	main.(*server).loop+0x2c	/tmp/gp/server.go:40
+`
+
+func TestParseGoroutines(t *testing.T) {
+	goroutines := parseGoroutines(testGoroutinesDebug2)
+	if len(goroutines) != 3 {
+		t.Fatalf("Error: Expected 3 goroutines, got %+v", goroutines)
+	}
+	main, worker, loop := goroutines[0], goroutines[1], goroutines[2]
+	if main.ID != 1 || main.State != "running" || main.creationSite() != "" || main.Functions[0] != "main.main" {
+		t.Errorf("Error: Unexpected main goroutine %+v", main)
+	}
+	if worker.State != "chan receive" || worker.Waiting != 3*time.Minute || worker.Locations[0] != "/tmp/gp/main.go:10" {
+		t.Errorf("Error: Unexpected worker goroutine %+v", worker)
+	}
+	if worker.creationSite() != "main.main.func1 at /tmp/gp/main.go:15" {
+		t.Errorf("Error: Unexpected creation site %q", worker.creationSite())
+	}
+	if loop.State != "select" || loop.Functions[0] != "main.(*server).loop" || loop.CreatedBy != "main.start" {
+		t.Errorf("Error: Unexpected loop goroutine %+v", loop)
+	}
+	if loop.Labels["op"] != "x" || loop.Labels["route"] != "/a b" {
+		t.Errorf("Error: Expected the traceback labels, got %v", loop.Labels)
+	}
+
+	groups := parseGoroutineGroups(testGoroutinesDebug1)
+	if len(groups) != 3 || groups[1].Count != 1 || groups[1].Labels["op"] != "y" || groups[2].Functions[0] != "main.(*server).loop" {
+		t.Fatalf("Error: Unexpected groups %+v", groups)
+	}
+	assignGroupLabels(goroutines, groups)
+	if goroutines[1].Labels["op"] != "y" {
+		t.Errorf("Error: Expected the worker to get the labels of its group, got %v", goroutines[1].Labels)
+	}
+	if goroutines[2].Labels["op"] != "x" {
+		t.Errorf("Error: Expected the traceback labels to be kept, got %v", goroutines[2].Labels)
+	}
+	if goroutines[0].Labels == nil || len(goroutines[0].Labels) != 0 {
+		t.Errorf("Error: Expected the main goroutine to be known as unlabeled, got %v", goroutines[0].Labels)
+	}
+}
+
+func TestReadGoroutinesLabels(t *testing.T) {
+	stop := make(chan bool)
+	defer close(stop)
+	started := make(chan bool)
+	pprof.Do(context.Background(), pprof.Labels("godump_test", "labeled"), func(context.Context) {
+		go func() {
+			started <- true
+			<-stop
+		}()
+	})
+	<-started
+	goroutines, groups, err := readGoroutines()
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	grouped := 0
+	for _, group := range groups {
+		if group.Labels["godump_test"] == "labeled" {
+			grouped += group.Count
+		}
+	}
+	labeled := 0
+	for _, g := range goroutines {
+		if g.Labels["godump_test"] == "labeled" {
+			labeled++
+		}
+	}
+	if grouped != 1 || labeled != 1 {
+		t.Errorf("Error: Expected one labeled goroutine, got %v in the groups and %v in the goroutines", grouped, labeled)
+	}
+}
@@ -0,0 +1,223 @@
+package godump
+
+import (
+	"fmt"
+	"log/slog"
+	"regexp"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+/* Hang detection ignore list
+ Many goroutines keep the same stack for the whole life of the program without being stuck: servers waiting in Accept,
+ os/signal, idle worker pools or godump's own goroutines. HangIgnore entries keep them out of the hang detection,
+ a goroutine is ignored when it matches every selector of one entry:
+	- Function: a glob matched against every function of the stack, or a regular expression when written "re:<expression>"
+	- State: the wait state printed by the runtime, e.g. "IO wait", "select", "chan receive", "sync.Mutex.Lock"
+	- LabelKey / LabelValue: a pprof label set with pprof.Do or pprof.SetGoroutineLabels, any value when LabelValue is empty
+ DefaultHangIgnore is always added to the entries unless HangIgnoreNoDefaults is set
+ In the configuration loaders the entries are written as "<selector>=<pattern>[, ...]" separated by ';':
+	function=main.(*pool).worker; state=IO wait; label=role:listener
+*/
+
+// HangIgnore selects goroutines the hang detection never reports
+type HangIgnore struct {
+	Function   string
+	State      string
+	LabelKey   string
+	LabelValue string
+}
+
+// DefaultHangIgnore returns the long-lived goroutines of the standard library and of godump, a new slice on every call
+func DefaultHangIgnore() []HangIgnore {
+	return []HangIgnore{
+		{Function: "os/signal.loop"},
+		{Function: "net/http.(*Server).Serve"},
+		{Function: "database/sql.(*DB).connectionOpener"},
+		{Function: "github.com/ghhwer/godump.(*GoDumpService).*"},
+		{Function: "github.com/ghhwer/godump.runWatchdog"},
+	}
+}
+
+// functionPattern compiles a function selector, a glob or a regular expression prefixed by "re:"
+func functionPattern(pattern string) (*regexp.Regexp, error) {
+	if expression, ok := strings.CutPrefix(pattern, "re:"); ok {
+		return regexp.Compile(expression)
+	}
+	return globPattern(pattern)
+}
+
+// validate reports the problems of the entry through invalid
+func (h *HangIgnore) validate(invalid func(field string, reason string, args ...any), field string) {
+	if h.Function == "" && h.State == "" && h.LabelKey == "" {
+		invalid(field, "needs at least one of 'Function', 'State' or 'LabelKey'")
+	}
+	if h.LabelValue != "" && h.LabelKey == "" {
+		invalid(field+".LabelValue", "cannot be set without 'LabelKey'")
+	}
+	if _, err := functionPattern(h.Function); h.Function != "" && err != nil {
+		invalid(field+".Function", "is not a valid regular expression: %v", err)
+	}
+}
+
+// compiledHangIgnore is a HangIgnore with its function selector compiled
+type compiledHangIgnore struct {
+	HangIgnore
+	function *regexp.Regexp
+}
+
+// compileHangIgnores compiles the entries of the configuration and the default ones, entries that do not compile are
+// skipped, Validate rejects them
+func compileHangIgnores(configs *DumpGoroutineConfigs) []compiledHangIgnore {
+	entries := configs.HangIgnore
+	if !configs.HangIgnoreNoDefaults {
+		entries = append(DefaultHangIgnore(), entries...)
+	}
+	compiled := make([]compiledHangIgnore, 0, len(entries))
+	for _, entry := range entries {
+		c := compiledHangIgnore{HangIgnore: entry}
+		if entry.Function != "" {
+			var err error
+			if c.function, err = functionPattern(entry.Function); err != nil {
+				continue
+			}
+		}
+		compiled = append(compiled, c)
+	}
+	return compiled
+}
+
+// needsProfile tells if the entry selects on what only the goroutine profile knows
+func (h *compiledHangIgnore) needsProfile() bool {
+	return h.State != "" || h.LabelKey != ""
+}
+
+// match tells if a stack is ignored, goroutines are the goroutines of the profile with that stack
+// An entry with a state or a label only matches when the stack was found in the profile and every goroutine with it matches
+func (h *compiledHangIgnore) match(functions []string, goroutines []*goroutineInfo) bool {
+	if h.function != nil {
+		found := false
+		for _, function := range functions {
+			if h.function.MatchString(function) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if !h.needsProfile() {
+		return true
+	}
+	if len(goroutines) == 0 {
+		return false
+	}
+	for _, g := range goroutines {
+		if h.State != "" && g.State != h.State {
+			return false
+		}
+		if h.LabelKey != "" {
+			value, ok := g.Labels[h.LabelKey]
+			if !ok || (h.LabelValue != "" && h.LabelValue != value) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// stackFrames returns the functions and the file:line locations of a stack record, innermost first
+func stackFrames(record runtime.StackRecord) ([]string, []string) {
+	functions, locations := []string{}, []string{}
+	frames := runtime.CallersFrames(record.Stack())
+	for {
+		frame, more := frames.Next()
+		if frame.Function != "" {
+			functions = append(functions, frame.Function)
+			locations = append(locations, frame.File+":"+strconv.Itoa(frame.Line))
+		}
+		if !more {
+			break
+		}
+	}
+	return functions, locations
+}
+
+// goroutinesBySignature indexes the goroutines of the profile by their stack signature
+func goroutinesBySignature(goroutines []goroutineInfo) map[string][]*goroutineInfo {
+	bySignature := map[string][]*goroutineInfo{}
+	for i := range goroutines {
+		signature := stackSignature(goroutines[i].Functions, goroutines[i].Locations)
+		bySignature[signature] = append(bySignature[signature], &goroutines[i])
+	}
+	return bySignature
+}
+
+// parseHangIgnore parses entries written as "function=main.(*pool).worker; state=IO wait, label=role:listener"
+func parseHangIgnore(value string) ([]HangIgnore, error) {
+	entries := []HangIgnore{}
+	for _, text := range strings.Split(value, ";") {
+		text = strings.TrimSpace(text)
+		if text == "" {
+			continue
+		}
+		entry := HangIgnore{}
+		for _, selector := range strings.Split(text, ",") {
+			key, pattern, ok := strings.Cut(strings.TrimSpace(selector), "=")
+			pattern = strings.TrimSpace(pattern)
+			if !ok || pattern == "" {
+				return nil, fmt.Errorf("invalid hang ignore entry %q: expected <selector>=<pattern>, got %q", text, selector)
+			}
+			switch strings.TrimSpace(key) {
+			case "function":
+				entry.Function = pattern
+			case "state":
+				entry.State = pattern
+			case "label":
+				entry.LabelKey, entry.LabelValue, _ = strings.Cut(pattern, ":")
+			default:
+				return nil, fmt.Errorf("invalid hang ignore entry %q: unknown selector %q, expected function, state or label", text, key)
+			}
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// withoutIgnored removes the stacks matching the ignore list from the hanging stacks
+func (w *goroutinesHangingWatchdog) withoutIgnored(gd *GoDumpService, configs *DumpGoroutineConfigs, sample *Sample, hanging []GoStackAnalyzerRecord) []GoStackAnalyzerRecord {
+	if len(hanging) == 0 {
+		return hanging
+	}
+	ignores := compileHangIgnores(configs)
+	var bySignature map[string][]*goroutineInfo
+	for i := range ignores {
+		if !ignores[i].needsProfile() {
+			continue
+		}
+		goroutines, _, err := sample.goroutineProfile()
+		if err != nil {
+			gd.logger().Warn("godump could not read the goroutine profile", slog.String("watchdog", WatchdogGoroutinesHanging), slog.Any("error", err))
+		}
+		bySignature = goroutinesBySignature(goroutines)
+		break
+	}
+	kept := hanging[:0]
+	for _, record := range hanging {
+		functions, locations := stackFrames(record.CurrentStacks)
+		goroutines := bySignature[stackSignature(functions, locations)]
+		ignored := false
+		for i := range ignores {
+			if ignores[i].match(functions, goroutines) {
+				ignored = true
+				break
+			}
+		}
+		if !ignored {
+			kept = append(kept, record)
+		}
+	}
+	return kept
+}
@@ -0,0 +1,128 @@
+package godump
+
+import (
+	"context"
+	"runtime/pprof"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseHangIgnore(t *testing.T) {
+	entries, err := parseHangIgnore("function=re:^main\\.worker$; state=IO wait, label=role:listener;")
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	if len(entries) != 2 || entries[0].Function != `re:^main\.worker$` || entries[1].State != "IO wait" || entries[1].LabelKey != "role" || entries[1].LabelValue != "listener" {
+		t.Fatalf("Error: Unexpected entries %+v", entries)
+	}
+	for _, bad := range []string{"stack=main.*", "state=", "function"} {
+		if _, err := parseHangIgnore(bad); err == nil {
+			t.Errorf("Error: Expected an error for %q", bad)
+		}
+	}
+}
+
+func TestHangIgnoreDefaults(t *testing.T) {
+	ignores := compileHangIgnores(&DumpGoroutineConfigs{})
+	ignored := func(functions ...string) bool {
+		for i := range ignores {
+			if ignores[i].match(functions, nil) {
+				return true
+			}
+		}
+		return false
+	}
+	if !ignored("runtime.gopark", "github.com/ghhwer/godump.(*GoDumpService).runSampler") || !ignored("os/signal.signal_recv", "os/signal.loop") {
+		t.Errorf("Error: Expected the default entries to ignore godump and os/signal")
+	}
+	if ignored("runtime.gopark", "main.worker") {
+		t.Errorf("Error: Expected main.worker not to be ignored")
+	}
+	if len(compileHangIgnores(&DumpGoroutineConfigs{HangIgnoreNoDefaults: true})) != 0 {
+		t.Errorf("Error: Expected no entries without the defaults")
+	}
+}
+
+func TestHangIgnoreWatchdog(t *testing.T) {
+	stop := make(chan bool)
+	defer close(stop)
+	pprof.Do(context.Background(), pprof.Labels("pool", "hang_test"), func(context.Context) {
+		leakGoroutines(3, stop)
+	})
+	time.Sleep(10 * time.Millisecond)
+	gds, err := NewGoDumpService(&GoDumpConfigs{
+		GoDumpGoroutine:      true,
+		GoDumpPath:           t.TempDir(),
+		WatchdogIntervalMs:   1000,
+		GoroutineDumpConfigs: &DumpGoroutineConfigs{GoroutineHangingTimeMs: 1000},
+	})
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	sample := &Sample{}
+	stacks, ok := sample.goroutineStacks()
+	if !ok {
+		t.Fatalf("Error: Could not read the goroutine profile")
+	}
+	leaking := func(ignore ...HangIgnore) int {
+		records := []GoStackAnalyzerRecord{}
+		for _, stack := range stacks {
+			records = append(records, GoStackAnalyzerRecord{CurrentStacks: stack})
+		}
+		count := 0
+		for _, record := range (&goroutinesHangingWatchdog{}).withoutIgnored(gds, &DumpGoroutineConfigs{HangIgnore: ignore}, sample, records) {
+			functions, _ := stackFrames(record.CurrentStacks)
+			if strings.Contains(strings.Join(functions, " "), "leakGoroutines") {
+				count++
+			}
+		}
+		return count
+	}
+	if count := leaking(); count != 3 {
+		t.Fatalf("Error: Expected 3 hanging goroutines without an ignore list, got %v", count)
+	}
+	for _, test := range []struct {
+		ignore   HangIgnore
+		expected int
+	}{
+		{HangIgnore{Function: "*leakGoroutines*"}, 0},
+		{HangIgnore{Function: `re:leakGoroutines\.func`}, 0},
+		{HangIgnore{State: "chan receive", LabelKey: "pool", LabelValue: "hang_test"}, 0},
+		{HangIgnore{State: "select"}, 3},
+		{HangIgnore{LabelKey: "pool", LabelValue: "other"}, 3},
+	} {
+		if count := leaking(test.ignore); count != test.expected {
+			t.Errorf("Error: Expected %v hanging goroutines with %+v, got %v", test.expected, test.ignore, count)
+		}
+	}
+}
+
+func TestValidateHangIgnore(t *testing.T) {
+	configs := &GoDumpConfigs{
+		GoDumpGoroutine:    true,
+		GoDumpPath:         t.TempDir(),
+		WatchdogIntervalMs: 1000,
+		GoroutineDumpConfigs: &DumpGoroutineConfigs{
+			GoroutineHangingTimeMs: 1000,
+			HangIgnore:             []HangIgnore{{}, {Function: "re:(main"}},
+		},
+	}
+	err := configs.Validate()
+	if err == nil || !strings.Contains(err.Error(), "HangIgnore[0]") || !strings.Contains(err.Error(), "HangIgnore[1].Function") {
+		t.Errorf("Error: Expected both entries to be rejected, got %v", err)
+	}
+}
+
+func TestDefaultsAreCopies(t *testing.T) {
+	ignore := DefaultHangIgnore()
+	ignore[0].Function = "main.*"
+	if DefaultHangIgnore()[0].Function != "os/signal.loop" {
+		t.Errorf("Error: Expected DefaultHangIgnore to return a new slice on every call")
+	}
+	actions := DefaultTriggerActions()
+	actions[0] = ActionHeapDump
+	if DefaultTriggerActions()[0] != ActionGoroutineDump {
+		t.Errorf("Error: Expected DefaultTriggerActions to return a new slice on every call")
+	}
+}
@@ -0,0 +1,102 @@
+package godump
+
+import (
+	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
+	"time"
+)
+
+/* State-aware hang detection
+ A stack that did not change for minutes means different things depending on what the goroutine waits for:
+	- sync.Mutex.Lock, sync.RWMutex.Lock or semacquire for 10s is most likely a deadlock
+	- chan receive or select for minutes is a consumer without work
+	- IO wait is a connection without traffic and is rarely worth a dump
+ GoroutineHangingTimeByState sets the hanging time of the goroutines in a wait state, the state as printed by the runtime in the
+ goroutine profile. A time of 0 never reports the state, the other states use GoroutineHangingTimeMs, and are never reported
+ when it is 0. In the configuration loaders the times are written as "<state>=<duration>" separated by ';':
+	sync.Mutex.Lock=10s; chan receive=5m; IO wait=never
+*/
+
+// hangingTime returns how long the record may keep its stack before it is reported, 0 when it is never reported
+// state reads the wait state of the record when GoroutineHangingTimeByState is set
+func hangingTime(configs *DumpGoroutineConfigs, record *GoStackAnalyzerRecord, state func(record *GoStackAnalyzerRecord) string) time.Duration {
+	if len(configs.GoroutineHangingTimeByState) > 0 {
+		record.State = state(record)
+		if ms, ok := configs.GoroutineHangingTimeByState[record.State]; ok {
+			return time.Duration(ms) * time.Millisecond
+		}
+	}
+	return time.Duration(configs.GoroutineHangingTimeMs) * time.Millisecond
+}
+
+// neverHanging reports whether the state of a record is never reported, hangingTime has to be called first to read the state
+func neverHanging(configs *DumpGoroutineConfigs, record *GoStackAnalyzerRecord) bool {
+	ms, ok := configs.GoroutineHangingTimeByState[record.State]
+	return ok && ms == 0
+}
+
+// stateReader returns a function giving the wait state of a record from the goroutine profile of the sample, read on the first call
+// The state is empty when the stack is not in the profile anymore
+func stateReader(gd *GoDumpService, sample *Sample) func(record *GoStackAnalyzerRecord) string {
+	var bySignature map[string][]*goroutineInfo
+	return func(record *GoStackAnalyzerRecord) string {
+		if bySignature == nil {
+			goroutines, _, err := sample.goroutineProfile()
+			if err != nil {
+				gd.logger().Warn("godump could not read the goroutine profile", slog.String("watchdog", WatchdogGoroutinesHanging), slog.Any("error", err))
+			}
+			bySignature = goroutinesBySignature(goroutines)
+		}
+		functions, locations := stackFrames(record.CurrentStacks)
+		if goroutines := bySignature[stackSignature(functions, locations)]; len(goroutines) > 0 {
+			return goroutines[0].State
+		}
+		return ""
+	}
+}
+
+// formatHangingTimes writes the hanging times per state in the order of the states, for the logs and the dumps
+func formatHangingTimes(times map[string]uint64) string {
+	states := make([]string, 0, len(times))
+	for state := range times {
+		states = append(states, state)
+	}
+	sort.Strings(states)
+	parts := make([]string, 0, len(states))
+	for _, state := range states {
+		if times[state] == 0 {
+			parts = append(parts, state+"=never")
+		} else {
+			parts = append(parts, fmt.Sprintf("%s=%dms", state, times[state]))
+		}
+	}
+	return strings.Join(parts, "; ")
+}
+
+// parseHangingTimes parses hanging times written as "sync.Mutex.Lock=10s; chan receive=5m; IO wait=never"
+func parseHangingTimes(value string) (map[string]uint64, error) {
+	times := map[string]uint64{}
+	for _, text := range strings.Split(value, ";") {
+		text = strings.TrimSpace(text)
+		if text == "" {
+			continue
+		}
+		state, duration, ok := strings.Cut(text, "=")
+		state, duration = strings.TrimSpace(state), strings.TrimSpace(duration)
+		if !ok || state == "" {
+			return nil, fmt.Errorf("invalid hanging time %q: expected <state>=<duration>", text)
+		}
+		if strings.EqualFold(duration, "never") {
+			times[state] = 0
+			continue
+		}
+		ms, err := parseDurationMs(duration)
+		if err != nil {
+			return nil, fmt.Errorf("invalid hanging time %q: %w", text, err)
+		}
+		times[state] = ms
+	}
+	return times, nil
+}
@@ -0,0 +1,103 @@
+package godump
+
+import (
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestParseHangingTimes(t *testing.T) {
+	times, err := parseHangingTimes("sync.Mutex.Lock=10s; chan receive=5m; IO wait=never;")
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	if len(times) != 3 || times["sync.Mutex.Lock"] != 10000 || times["chan receive"] != 300000 || times["IO wait"] != 0 {
+		t.Fatalf("Error: Unexpected hanging times %v", times)
+	}
+	if formatted := formatHangingTimes(times); formatted != "IO wait=never; chan receive=300000ms; sync.Mutex.Lock=10000ms" {
+		t.Errorf("Error: Unexpected formatted hanging times %q", formatted)
+	}
+	for _, bad := range []string{"sync.Mutex.Lock", "=10s", "select=soon"} {
+		if _, err := parseHangingTimes(bad); err == nil {
+			t.Errorf("Error: Expected an error for %q", bad)
+		}
+	}
+}
+
+// hangingDump runs the hanging watchdog on two samples two seconds apart and returns the dump it wrote
+func hangingDump(t *testing.T, goroutineConfigs *DumpGoroutineConfigs) string {
+	configs := &GoDumpConfigs{
+		GoDumpGoroutine:      true,
+		GoDumpPath:           t.TempDir(),
+		WatchdogIntervalMs:   1000,
+		GoroutineDumpConfigs: goroutineConfigs,
+	}
+	gds, err := NewGoDumpService(configs)
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	var written *Event
+	gds.OnEvent(func(e Event) {
+		if e.Type == EventDumpWritten {
+			written = &e
+		}
+	})
+	w := &goroutinesHangingWatchdog{}
+	now := time.Now()
+	w.check(gds, configs, &Sample{Time: now})
+	w.check(gds, configs, &Sample{Time: now.Add(2 * time.Second)})
+	if written == nil {
+		return ""
+	}
+	dump, err := os.ReadFile(written.File)
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	return string(dump)
+}
+
+func TestHangingTimeByState(t *testing.T) {
+	stop := make(chan bool)
+	defer close(stop)
+	leakGoroutines(3, stop)
+	var mu sync.Mutex
+	mu.Lock()
+	defer mu.Unlock()
+	go func() {
+		mu.Lock()
+		mu.Unlock()
+	}()
+	time.Sleep(10 * time.Millisecond)
+
+	// Only the goroutine waiting for the mutex is reported
+	dump := hangingDump(t, &DumpGoroutineConfigs{GoroutineHangingTimeByState: map[string]uint64{"sync.Mutex.Lock": 1000}})
+	if !strings.Contains(dump, "Number of Hanging Goroutines: 1\n") || !strings.Contains(dump, "State: sync.Mutex.Lock") {
+		t.Errorf("Error: Expected the goroutine waiting for the mutex to be reported, got %s", dump)
+	}
+	if !strings.Contains(dump, "Hanging time per state: sync.Mutex.Lock=1000ms") {
+		t.Errorf("Error: Expected the hanging times in the dump, got %s", dump)
+	}
+
+	// Goroutines waiting on a channel are never reported, the others use GoroutineHangingTimeMs
+	dump = hangingDump(t, &DumpGoroutineConfigs{GoroutineHangingTimeMs: 1000, GoroutineHangingTimeByState: map[string]uint64{"chan receive": 0}})
+	if strings.Contains(dump, "State: chan receive") || !strings.Contains(dump, "State: sync.Mutex.Lock") {
+		t.Errorf("Error: Expected only the goroutines outside chan receive to be reported, got %s", dump)
+	}
+}
+
+func TestValidateHangingTimeByState(t *testing.T) {
+	configs := &GoDumpConfigs{
+		GoDumpGoroutine:    true,
+		GoDumpPath:         t.TempDir(),
+		WatchdogIntervalMs: 1000,
+		GoroutineDumpConfigs: &DumpGoroutineConfigs{
+			GoroutineHangingTimeByState: map[string]uint64{"select": 500, "IO wait": 0},
+		},
+	}
+	err := configs.Validate()
+	if err == nil || !strings.Contains(err.Error(), `GoroutineHangingTimeByState["select"]`) || strings.Contains(err.Error(), "IO wait") {
+		t.Errorf("Error: Expected only the select hanging time to be rejected, got %v", err)
+	}
+}
@@ -0,0 +1,160 @@
+package godump
+
+import (
+	"fmt"
+	"log/slog"
+	"regexp"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+/* Heartbeats
+ Stack-based heuristics cannot know that a loop is expected to iterate every few seconds, a heartbeat tells godump explicitly:
+	hb := service.RegisterHeartbeat("kafka-consumer", 5*time.Second)
+	defer hb.Unregister()
+	for message := range messages {
+		hb.Beat()
+		...
+	}
+ The heartbeats are checked by the sampler on every sample, they keep the sampler running even when no watchdog is enabled:
+	- A heartbeat is stale when it did not beat for longer than its max interval, the time of its registration counts as a beat
+	- A heartbeat going stale writes a single goroutine dump named after it, with an event whose Detail is its name, the next one
+	  is written when it goes stale again after a beat
+	- The age of every heartbeat is reported by Status
+ A heartbeat registered with a max interval of 0 or less is disabled, it is never watched and can still Beat and Unregister
+*/
+
+const WatchdogHeartbeat = "heartbeat"
+
+// Heartbeat is a loop godump expects to beat at least every max interval
+type Heartbeat struct {
+	name        string
+	maxInterval time.Duration
+	last        atomic.Int64 // time of the last beat in Unix nanoseconds
+	above       bool         // only used by the sampler
+	gd          *GoDumpService
+}
+
+// Beat records an iteration of the loop, it is cheap enough to be called on every iteration
+func (h *Heartbeat) Beat() {
+	h.last.Store(time.Now().UnixNano())
+}
+
+// Name returns the name the heartbeat was registered with
+func (h *Heartbeat) Name() string {
+	return h.name
+}
+
+// LastBeat returns the time of the last beat, or of the registration when the heartbeat never beat
+func (h *Heartbeat) LastBeat() time.Time {
+	return time.Unix(0, h.last.Load())
+}
+
+// Unregister stops watching the heartbeat, e.g. when its loop returns
+func (h *Heartbeat) Unregister() {
+	h.gd.state.mu.Lock()
+	defer h.gd.state.mu.Unlock()
+	h.gd.heartbeats.mu.Lock()
+	if h.gd.heartbeats.byName[h.name] == h {
+		delete(h.gd.heartbeats.byName, h.name)
+	}
+	h.gd.heartbeats.mu.Unlock()
+	h.gd.updateSampler()
+}
+
+// heartbeatRegistry holds the heartbeats of a service, it is shared by every copy of the service
+type heartbeatRegistry struct {
+	mu     sync.Mutex
+	byName map[string]*Heartbeat
+}
+
+// RegisterHeartbeat starts watching a heartbeat, registering a name again replaces the previous heartbeat
+// a maxInterval of 0 or less returns a disabled heartbeat, it would be stale on every sample
+func (gd *GoDumpService) RegisterHeartbeat(name string, maxInterval time.Duration) *Heartbeat {
+	h := &Heartbeat{name: name, maxInterval: maxInterval, gd: gd}
+	h.Beat()
+	if maxInterval <= 0 {
+		gd.logger().Warn("godump heartbeat disabled, its max interval must be positive", slog.String("heartbeat", name), slog.Duration("max_interval", maxInterval))
+	}
+	gd.state.mu.Lock()
+	defer gd.state.mu.Unlock()
+	gd.heartbeats.mu.Lock()
+	if gd.heartbeats.byName == nil {
+		gd.heartbeats.byName = map[string]*Heartbeat{}
+	}
+	if maxInterval > 0 {
+		gd.heartbeats.byName[name] = h
+	} else {
+		delete(gd.heartbeats.byName, name)
+	}
+	gd.heartbeats.mu.Unlock()
+	gd.updateSampler()
+	return h
+}
+
+// list returns the heartbeats sorted by name
+func (r *heartbeatRegistry) list() []*Heartbeat {
+	if r == nil {
+		return nil
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	heartbeats := make([]*Heartbeat, 0, len(r.byName))
+	for _, h := range r.byName {
+		heartbeats = append(heartbeats, h)
+	}
+	sort.Slice(heartbeats, func(i, j int) bool { return heartbeats[i].name < heartbeats[j].name })
+	return heartbeats
+}
+
+func (r *heartbeatRegistry) count() int {
+	if r == nil {
+		return 0
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.byName)
+}
+
+// check writes a goroutine dump for every heartbeat that went stale since the previous sample, it runs on the sampler after the watchdogs
+func (r *heartbeatRegistry) check(gd *GoDumpService, configs *GoDumpConfigs, sample *Sample) {
+	for _, h := range r.list() {
+		age := sample.Time.Sub(h.LastBeat())
+		wasStale := h.above
+		if gd.checkDetailThreshold(WatchdogHeartbeat, h.name, &h.above, float64(age.Milliseconds()), float64(h.maxInterval.Milliseconds())) && !wasStale {
+			stale := dumpSection{
+				title: "Stale Heartbeat",
+				lines: []string{fmt.Sprintf("%s: last beat %v ago, max interval %v", h.name, age.Round(time.Millisecond), h.maxInterval)},
+			}
+			file, err := writeGoroutineDump(heartbeatDumpConfigs(configs, h.name), nil, stale)
+			gd.emitDump(WatchdogHeartbeat, file, err)
+		}
+	}
+}
+
+// unsafeFileCharacters are replaced in the heartbeat and operation names used in file names
+var unsafeFileCharacters = regexp.MustCompile(`[^A-Za-z0-9_.-]`)
+
+// heartbeatDumpConfigs returns a copy of the configuration whose goroutine dump prefix carries the heartbeat name
+func heartbeatDumpConfigs(configs *GoDumpConfigs, name string) *GoDumpConfigs {
+	goroutineConfigs := DumpGoroutineConfigs{}
+	if configs.GoroutineDumpConfigs != nil {
+		goroutineConfigs = *configs.GoroutineDumpConfigs
+	}
+	goroutineConfigs.GoroutineDumpPrefix = taggedGoroutineDumpPrefix(configs, name)
+	tagged := *configs
+	tagged.GoroutineDumpConfigs = &goroutineConfigs
+	return &tagged
+}
+
+// taggedGoroutineDumpPrefix returns the goroutine dump prefix followed by the name, made safe for file names
+func taggedGoroutineDumpPrefix(configs *GoDumpConfigs, name string) *string {
+	prefix := DefaultGoroutineDumpPrefix
+	if configs.GoroutineDumpConfigs != nil && configs.GoroutineDumpConfigs.GoroutineDumpPrefix != nil {
+		prefix = *configs.GoroutineDumpConfigs.GoroutineDumpPrefix
+	}
+	prefix += "-" + unsafeFileCharacters.ReplaceAllString(name, "_") + "-"
+	return &prefix
+}
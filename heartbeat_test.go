@@ -0,0 +1,124 @@
+package godump
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestHeartbeatWatchdog(t *testing.T) {
+	gds, err := NewGoDumpService(&GoDumpConfigs{GoDumpPath: t.TempDir(), WatchdogIntervalMs: 1000})
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	var received []Event
+	gds.OnEvent(func(e Event) { received = append(received, e) })
+	hb := gds.RegisterHeartbeat("kafka/consumer", 5*time.Second)
+	gds.RegisterHeartbeat("ticker", time.Minute)
+
+	gds.heartbeats.check(gds, gds.config(), &Sample{Time: time.Now().Add(time.Second)})
+	if len(received) != 0 {
+		t.Fatalf("Error: Expected no event for fresh heartbeats, got %+v", received)
+	}
+	gds.heartbeats.check(gds, gds.config(), &Sample{Time: time.Now().Add(10 * time.Second)})
+	if len(received) != 2 || received[0].Type != EventThresholdCrossed || received[0].Watchdog != WatchdogHeartbeat ||
+		received[0].Detail != "kafka/consumer" || received[1].Type != EventDumpWritten {
+		t.Fatalf("Error: Expected the stale heartbeat to fire with a dump, got %+v", received)
+	}
+	if !strings.HasPrefix(filepath.Base(received[1].File), "goroutinedump-kafka_consumer-") {
+		t.Errorf("Error: Expected the dump to be named after the heartbeat, got %v", received[1].File)
+	}
+	dump, err := os.ReadFile(received[1].File)
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	if !strings.Contains(string(dump), "Stale Heartbeat:\nkafka/consumer: last beat") {
+		t.Errorf("Error: Expected the heartbeat in the dump, got %s", dump)
+	}
+
+	received = nil
+	gds.heartbeats.check(gds, gds.config(), &Sample{Time: time.Now().Add(11 * time.Second)})
+	if len(received) != 0 {
+		t.Errorf("Error: Expected a single dump while the heartbeat stays stale, got %+v", received)
+	}
+
+	hb.Beat()
+	gds.heartbeats.check(gds, gds.config(), &Sample{Time: time.Now()})
+	if len(received) != 1 || received[0].Type != EventThresholdRecovered {
+		t.Errorf("Error: Expected the heartbeat to recover, got %+v", received)
+	}
+
+	received = nil
+	gds.heartbeats.check(gds, gds.config(), &Sample{Time: time.Now().Add(10 * time.Second)})
+	if len(received) != 2 || received[1].Type != EventDumpWritten {
+		t.Errorf("Error: Expected a new dump when the heartbeat goes stale again, got %+v", received)
+	}
+}
+
+func TestHeartbeatStatus(t *testing.T) {
+	gds, err := NewGoDumpService(&GoDumpConfigs{GoDumpPath: t.TempDir(), WatchdogIntervalMs: 1000})
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	gds.RegisterHeartbeat("stale", time.Nanosecond)
+	fresh := gds.RegisterHeartbeat("fresh", time.Hour)
+	time.Sleep(time.Millisecond)
+	status := gds.Status()
+	if status.Running || len(status.Heartbeats) != 2 || status.Heartbeats[0].Name != "fresh" || status.Heartbeats[0].Stale || !status.Heartbeats[1].Stale {
+		t.Fatalf("Error: Unexpected status %+v", status)
+	}
+	if text := status.String(); !strings.Contains(text, "Heartbeats:") || !strings.Contains(text, "stale") {
+		t.Errorf("Error: Expected the heartbeats in the status text, got %s", text)
+	}
+	fresh.Unregister()
+	if status := gds.Status(); len(status.Heartbeats) != 1 {
+		t.Errorf("Error: Expected the unregistered heartbeat to be gone, got %+v", status.Heartbeats)
+	}
+}
+
+func TestHeartbeatStartsSampler(t *testing.T) {
+	gds, err := NewGoDumpService(&GoDumpConfigs{GoDumpPath: t.TempDir(), WatchdogIntervalMs: 50})
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	events := gds.Subscribe()
+	stop := make(chan bool)
+	wg := sync.WaitGroup{}
+	if err := gds.Start(stop, &wg); err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	defer func() {
+		close(stop)
+		wg.Wait()
+	}()
+	hb := gds.RegisterHeartbeat("loop", 10*time.Millisecond)
+	defer hb.Unregister()
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case e := <-events:
+			if e.Type == EventDumpWritten && e.Watchdog == WatchdogHeartbeat {
+				return
+			}
+		case <-timeout:
+			t.Fatalf("Error: Expected the sampler to report the stale heartbeat")
+		}
+	}
+}
+
+func TestHeartbeatDisabled(t *testing.T) {
+	gds, err := NewGoDumpService(&GoDumpConfigs{GoDumpPath: t.TempDir(), WatchdogIntervalMs: 1000})
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	gds.RegisterHeartbeat("loop", time.Minute)
+	hb := gds.RegisterHeartbeat("loop", 0)
+	hb.Beat()
+	if gds.heartbeats.count() != 0 {
+		t.Errorf("Error: Expected a heartbeat without max interval to replace the previous one and not be watched")
+	}
+	hb.Unregister()
+}
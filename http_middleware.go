@@ -0,0 +1,109 @@
+package godump
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+/* HTTP middleware
+ Middleware tracks every request as an operation (see Track) named "METHOD route" whose budget is the timeout:
+	handler := gds.Middleware(&godump.MiddlewareConfigs{Timeout: 10 * time.Second, Mux: mux})(mux)
+	http.ListenAndServe(":8080", handler)
+ The route is a pattern of the ServeMux, never the path, so that the IDs and tokens of the paths do not end up in the operation names
+ and dump file names. A request without a known route is named after its method only, its path is the LabelHTTPPath label
+ The request goroutine gets the labels of Track and LabelHTTPMethod, LabelHTTPRoute, LabelHTTPPath and LabelHTTPRequestID, the goroutines
+ started by the handler inherit them
+ A request running longer than the timeout writes an operation dump with the in-flight request table, the dumps of the requests
+ of one middleware are rate limited to one every DumpInterval so that a slow dependency does not write a dump per request
+*/
+
+// Defaults of MiddlewareConfigs
+const (
+	DefaultMiddlewareTimeout      = 30 * time.Second
+	DefaultMiddlewareDumpInterval = time.Minute
+	DefaultRequestIDHeader        = "X-Request-Id"
+)
+
+// The pprof labels set by Middleware, next to the labels of Track
+const (
+	LabelHTTPMethod    = "http_method"
+	LabelHTTPRoute     = "http_route" // only set when the route is known
+	LabelHTTPPath      = "http_path"
+	LabelHTTPRequestID = "http_request_id"
+)
+
+// MiddlewareConfigs configures Middleware, a nil configuration or a field left at its zero value uses the defaults
+type MiddlewareConfigs struct {
+	Timeout         time.Duration                // a request running longer is slow, DefaultMiddlewareTimeout by default
+	DumpInterval    time.Duration                // minimum time between two dumps of slow requests, DefaultMiddlewareDumpInterval by default
+	RequestIDHeader string                       // header holding the request ID, DefaultRequestIDHeader by default, the operation ID is used when it is missing
+	Mux             *http.ServeMux               // the mux the middleware wraps, its patterns name the routes before it routed the request
+	Route           func(r *http.Request) string // names the route of a request, empty when unknown, the pattern of Mux or of the ServeMux that routed it by default
+}
+
+// Middleware returns a middleware tracking every request and dumping the goroutines of the requests running longer than the timeout
+// The sampler runs from its creation on, see enableOperations
+func (gd *GoDumpService) Middleware(configs *MiddlewareConfigs) func(next http.Handler) http.Handler {
+	c := MiddlewareConfigs{}
+	if configs != nil {
+		c = *configs
+	}
+	if c.Timeout <= 0 {
+		c.Timeout = DefaultMiddlewareTimeout
+	}
+	if c.DumpInterval <= 0 {
+		c.DumpInterval = DefaultMiddlewareDumpInterval
+	}
+	if c.RequestIDHeader == "" {
+		c.RequestIDHeader = DefaultRequestIDHeader
+	}
+	if c.Route == nil {
+		mux := c.Mux
+		c.Route = func(r *http.Request) string {
+			return requestRoute(mux, r)
+		}
+	}
+	limiter := &dumpLimiter{interval: c.DumpInterval}
+	gd.enableOperations()
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			route := c.Route(r)
+			name := r.Method
+			if strings.HasPrefix(route, r.Method+" ") {
+				// The patterns of a ServeMux can start with the method
+				name = route
+			} else if route != "" {
+				name = r.Method + " " + route
+			}
+			op := gd.newOperation(name, c.Timeout)
+			requestID := r.Header.Get(c.RequestIDHeader)
+			if requestID == "" {
+				requestID = strconv.FormatUint(op.id, 10)
+			}
+			op.labels = []string{LabelHTTPMethod, r.Method}
+			if route != "" {
+				op.labels = append(op.labels, LabelHTTPRoute, route)
+			}
+			op.labels = append(op.labels, LabelHTTPPath, r.URL.Path, LabelHTTPRequestID, requestID)
+			op.limiter = limiter
+			ctx, done := gd.startOperation(r.Context(), op)
+			defer done()
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// requestRoute returns the pattern that routed the request or the pattern mux would route it to, empty when neither is known
+// a middleware wrapping a ServeMux runs before the routing and needs the mux
+func requestRoute(mux *http.ServeMux, r *http.Request) string {
+	if r.Pattern != "" {
+		return r.Pattern
+	}
+	if mux != nil {
+		_, pattern := mux.Handler(r)
+		return pattern
+	}
+	return ""
+}
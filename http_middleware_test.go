@@ -0,0 +1,120 @@
+package godump
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestMiddlewareSlowRequests(t *testing.T) {
+	gds, err := NewGoDumpService(&GoDumpConfigs{GoDumpPath: t.TempDir(), WatchdogIntervalMs: 1000})
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	var received []Event
+	gds.OnEvent(func(e Event) { received = append(received, e) })
+	started := make(chan bool)
+	release := make(chan bool)
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /checkout/{id}", func(w http.ResponseWriter, r *http.Request) {
+		started <- true
+		<-release
+	})
+	// The middleware wraps the mux and runs before the routing
+	server := httptest.NewServer(gds.Middleware(&MiddlewareConfigs{Timeout: time.Second, Mux: mux})(mux))
+	defer server.Close()
+
+	wg := sync.WaitGroup{}
+	for i, requestID := range []string{"abc", ""} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			request, _ := http.NewRequest(http.MethodGet, server.URL+"/checkout/"+strconv.Itoa(i), nil)
+			if requestID != "" {
+				request.Header.Set(DefaultRequestIDHeader, requestID)
+			}
+			if response, err := http.DefaultClient.Do(request); err == nil {
+				response.Body.Close()
+			}
+		}()
+		<-started
+	}
+
+	status := gds.Status()
+	if len(status.Operations) != 2 || status.Operations[0].Name != "GET /checkout/{id}" || status.Operations[1].Name != "GET /checkout/{id}" ||
+		status.Operations[0].Labels[LabelHTTPRequestID] != "abc" || status.Operations[1].Labels[LabelHTTPRequestID] != "2" ||
+		status.Operations[0].Labels[LabelHTTPRoute] != "GET /checkout/{id}" || status.Operations[1].Labels[LabelHTTPPath] != "/checkout/1" {
+		t.Fatalf("Error: Expected the two requests in flight, got %+v", status.Operations)
+	}
+
+	gds.operations.check(gds, gds.config(), &Sample{Time: time.Now().Add(2 * time.Second)})
+	dumps := []string{}
+	for _, e := range received {
+		if e.Type == EventDumpWritten {
+			dumps = append(dumps, e.File)
+		}
+	}
+	if len(dumps) != 1 {
+		t.Fatalf("Error: Expected a single dump for the two slow requests, got %+v", received)
+	}
+	dump, err := os.ReadFile(dumps[0])
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	if !strings.Contains(string(dump), "Labels: http_method=GET http_route=GET /checkout/{id} http_path=/checkout/0 http_request_id=abc") ||
+		!strings.Contains(string(dump), "http_request_id=2") || !strings.Contains(string(dump), "In-flight Operations:") {
+		t.Errorf("Error: Expected the request and the in-flight requests in the dump, got %s", dump)
+	}
+
+	received = nil
+	gds.operations.check(gds, gds.config(), &Sample{Time: time.Now().Add(3 * time.Second)})
+	if len(received) != 0 {
+		t.Errorf("Error: Expected the dumps to be rate limited, got %+v", received)
+	}
+	gds.operations.check(gds, gds.config(), &Sample{Time: time.Now().Add(2 * time.Minute)})
+	if len(received) != 1 || received[0].Type != EventDumpWritten {
+		t.Errorf("Error: Expected the dump of the other request after the dump interval, got %+v", received)
+	}
+	received = nil
+	gds.operations.check(gds, gds.config(), &Sample{Time: time.Now().Add(5 * time.Minute)})
+	if len(received) != 0 {
+		t.Errorf("Error: Expected each request to be dumped once, got %+v", received)
+	}
+
+	close(release)
+	wg.Wait()
+	if count := gds.operations.count(); count != 0 {
+		t.Errorf("Error: Expected no request in flight, got %d", count)
+	}
+}
+
+func TestMiddlewareUnknownRoute(t *testing.T) {
+	gds, err := NewGoDumpService(&GoDumpConfigs{GoDumpPath: t.TempDir(), WatchdogIntervalMs: 1000})
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	var status Status
+	handler := gds.Middleware(nil)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		status = gds.Status()
+	}))
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/users/42/token/secret", nil))
+	if len(status.Operations) != 1 || status.Operations[0].Name != "POST" || status.Operations[0].Labels[LabelHTTPPath] != "/users/42/token/secret" {
+		t.Fatalf("Error: Expected the request to be named after its method with the path as a label, got %+v", status.Operations)
+	}
+	if _, ok := status.Operations[0].Labels[LabelHTTPRoute]; ok {
+		t.Errorf("Error: Expected no route label for an unknown route, got %+v", status.Operations[0].Labels)
+	}
+}
+
+func TestDumpLimiter(t *testing.T) {
+	limiter := &dumpLimiter{interval: time.Minute}
+	now := time.Now()
+	if !limiter.allow(now) || limiter.allow(now.Add(time.Second)) || !limiter.allow(now.Add(time.Minute)) {
+		t.Errorf("Error: Expected a dump per interval")
+	}
+}
@@ -0,0 +1,121 @@
+package godump
+
+import (
+	"context"
+	"log/slog"
+)
+
+/* Logging
+ godump logs through the *slog.Logger set in GoDumpConfigs.Logger, when no logger is set it stays silent
+ Every record carries the "component"="godump" attribute, the other attributes are:
+	- "watchdog": the watchdog that produced the record
+	- "value" and "threshold": the measured value and the threshold it was compared against
+	- "file": the dump file that was written or could not be written
+	- "error": the error that occurred
+*/
+
+// discardHandler drops every record, it is used when no logger is configured
+type discardHandler struct{}
+
+func (discardHandler) Enabled(context.Context, slog.Level) bool  { return false }
+func (discardHandler) Handle(context.Context, slog.Record) error { return nil }
+func (h discardHandler) WithAttrs([]slog.Attr) slog.Handler      { return h }
+func (h discardHandler) WithGroup(string) slog.Handler           { return h }
+
+var discardLogger = slog.New(discardHandler{})
+
+// logger returns the configured logger or a logger that discards everything
+func (gd *GoDumpService) logger() *slog.Logger {
+	if gd.log == nil {
+		// The service was not created through NewGoDumpService
+		return discardLogger
+	}
+	if log := gd.log.Load(); log != nil {
+		return log
+	}
+	return discardLogger
+}
+
+// logConfigSummary logs the configuration the service is using
+func (gd *GoDumpService) logConfigSummary(message string) {
+	configs := gd.config()
+	attrs := []any{
+		slog.Bool("heap", configs.GoDumpHeap),
+		slog.Bool("goroutine", configs.GoDumpGoroutine),
+		slog.Bool("gc", configs.GoDumpGC),
+		slog.Bool("sched", configs.GoDumpSched),
+		slog.Bool("os", configs.GoDumpOS),
+		slog.Bool("cpu", configs.GoDumpCPU),
+		slog.Bool("native_memory", configs.GoDumpNativeMemory),
+		slog.Bool("contention", configs.GoDumpContention),
+		slog.Int("trigger_rules", len(configs.TriggerRules)),
+		slog.String("path", configs.GoDumpPath),
+		slog.Uint64("watchdog_interval_ms", configs.WatchdogIntervalMs),
+		slog.Uint64("available_memory_bytes", gd.state.AvailableSystemMemory),
+	}
+	if configs.GoDumpHeap {
+		attrs = append(attrs,
+			slog.Uint64("heap_threshold_bytes", configs.HeapDumpConfigs.HeapThresholdBytes),
+			slog.Float64("heap_threshold_percentage", configs.HeapDumpConfigs.HeapThresholdPercentage),
+			slog.String("heap_metric", heapMetric(configs)),
+			slog.String("heap_bytes_tiers", formatTiers(configs.HeapDumpConfigs.HeapBytesTiers)),
+			slog.String("heap_percentage_tiers", formatTiers(configs.HeapDumpConfigs.HeapPercentageTiers)),
+		)
+	}
+	if configs.GoDumpGoroutine {
+		attrs = append(attrs,
+			slog.Uint64("goroutine_threshold", configs.GoroutineDumpConfigs.GoroutineThreshold),
+			slog.String("goroutine_tiers", formatTiers(configs.GoroutineDumpConfigs.GoroutineTiers)),
+			slog.Uint64("goroutine_hanging_time_ms", configs.GoroutineDumpConfigs.GoroutineHangingTimeMs),
+			slog.String("goroutine_hanging_time_by_state", formatHangingTimes(configs.GoroutineDumpConfigs.GoroutineHangingTimeByState)),
+			slog.String("goroutine_hanging_tiers", formatTiers(configs.GoroutineDumpConfigs.GoroutineHangingTiers)),
+			slog.Int("goroutine_hang_ignore", len(configs.GoroutineDumpConfigs.HangIgnore)),
+			slog.Uint64("goroutine_growth_window_ms", configs.GoroutineDumpConfigs.GoroutineGrowthWindowMs),
+			slog.String("goroutine_growth_tiers", formatTiers(configs.GoroutineDumpConfigs.GoroutineGrowthTiers)),
+			slog.Int("goroutine_rules", len(configs.GoroutineDumpConfigs.GoroutineRules)),
+			slog.Float64("goroutine_stall_fraction", configs.GoroutineDumpConfigs.GoroutineStallFraction),
+		)
+	}
+	if configs.GoDumpGC {
+		attrs = append(attrs,
+			slog.Float64("gc_cpu_fraction_threshold", configs.GCDumpConfigs.GCCPUFractionThreshold),
+			slog.Float64("gc_cycles_per_minute_threshold", configs.GCDumpConfigs.GCCyclesPerMinuteThreshold),
+			slog.Float64("gc_pause_p99_threshold_ms", configs.GCDumpConfigs.GCPauseP99ThresholdMs),
+		)
+	}
+	if configs.GoDumpSched {
+		attrs = append(attrs,
+			slog.Float64("sched_latency_threshold_ms", configs.SchedDumpConfigs.SchedLatencyThresholdMs),
+			slog.Float64("ticker_lag_threshold_ms", configs.SchedDumpConfigs.TickerLagThresholdMs),
+			slog.Uint64("sched_sustained_ms", configs.SchedDumpConfigs.SchedSustainedMs),
+		)
+	}
+	if configs.GoDumpOS {
+		attrs = append(attrs,
+			slog.Uint64("thread_threshold", configs.OSDumpConfigs.ThreadThreshold),
+			slog.Float64("thread_growth_per_minute", configs.OSDumpConfigs.ThreadGrowthPerMinute),
+			slog.Uint64("threadcreate_threshold", configs.OSDumpConfigs.ThreadCreateThreshold),
+			slog.Uint64("fd_threshold", configs.OSDumpConfigs.FDThreshold),
+			slog.Float64("fd_growth_per_minute", configs.OSDumpConfigs.FDGrowthPerMinute),
+		)
+	}
+	if configs.GoDumpCPU {
+		attrs = append(attrs,
+			slog.Float64("cpu_threshold_percentage", configs.CPUDumpConfigs.CPUThresholdPercentage),
+			slog.Uint64("cpu_sustained_intervals", configs.CPUDumpConfigs.CPUSustainedIntervals),
+			slog.Uint64("cpu_profile_duration_ms", configs.CPUDumpConfigs.CPUProfileDurationMs),
+		)
+	}
+	if configs.GoDumpNativeMemory {
+		attrs = append(attrs, slog.Uint64("native_memory_threshold_bytes", configs.NativeMemoryDumpConfigs.NativeMemoryThresholdBytes))
+	}
+	if configs.GoDumpContention {
+		attrs = append(attrs,
+			slog.Float64("mutex_wait_threshold_ms", configs.ContentionDumpConfigs.MutexWaitThresholdMs),
+			slog.Float64("block_wait_threshold_ms", configs.ContentionDumpConfigs.BlockWaitThresholdMs),
+			slog.Uint64("mutex_profile_fraction", configs.ContentionDumpConfigs.MutexProfileFraction),
+			slog.Uint64("block_profile_rate", configs.ContentionDumpConfigs.BlockProfileRate),
+		)
+	}
+	gd.logger().Info(message, attrs...)
+}
@@ -0,0 +1,74 @@
+package godump
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestLoggingRecordsTriggersAndDumps(t *testing.T) {
+	buf := &bytes.Buffer{}
+	gds, err := NewGoDumpService(&GoDumpConfigs{
+		GoDumpHeap:         true,
+		GoDumpPath:         t.TempDir(),
+		WatchdogIntervalMs: 1000,
+		HeapDumpConfigs:    &DumpHeapConfigs{HeapThresholdBytes: 100},
+		Logger:             slog.New(slog.NewTextHandler(buf, &slog.HandlerOptions{Level: slog.LevelDebug})),
+	})
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	gds.logConfigSummary("godump started")
+	above := false
+	gds.checkThreshold(WatchdogHeapBytes, &above, 150, 100)
+	gds.takeHeapDump(WatchdogHeapBytes)
+	gds.checkThreshold(WatchdogHeapBytes, &above, 160, 100)
+	gds.checkThreshold(WatchdogHeapBytes, &above, 50, 100)
+
+	output := buf.String()
+	for _, expected := range []string{
+		`msg="godump started"`,
+		"heap_threshold_bytes=100",
+		`msg="godump threshold exceeded"`,
+		"watchdog=heap_bytes value=150 threshold=100",
+		`msg="godump dump written"`,
+		"file=" + gds.config().GoDumpPath,
+		`msg="godump threshold recovered"`,
+		"component=godump",
+	} {
+		if !strings.Contains(output, expected) {
+			t.Errorf("Error: Expected the logs to contain %q, got:\n%s", expected, output)
+		}
+	}
+	if count := strings.Count(output, `msg="godump threshold exceeded"`); count != 1 {
+		t.Errorf("Error: Expected the threshold to be logged once when it is crossed, got %d times:\n%s", count, output)
+	}
+}
+
+func TestLoggingSilentWithoutLogger(t *testing.T) {
+	gds := &GoDumpService{}
+	if gds.logger().Enabled(context.Background(), slog.LevelError) {
+		t.Errorf("Error: Expected the default logger to discard everything")
+	}
+}
+
+func TestLoggingDerivedOncePerConfiguration(t *testing.T) {
+	configs := &GoDumpConfigs{GoDumpPath: t.TempDir(), WatchdogIntervalMs: 1000, Logger: slog.New(slog.NewTextHandler(&bytes.Buffer{}, nil))}
+	gds, err := NewGoDumpService(configs)
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	if gds.logger() != gds.logger() {
+		t.Errorf("Error: Expected the logger to be derived once")
+	}
+	reloaded := *configs
+	reloaded.Logger = nil
+	if err := gds.ApplyConfig(&reloaded); err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	if gds.logger() != discardLogger {
+		t.Errorf("Error: Expected the logger to follow the applied configuration")
+	}
+}
@@ -0,0 +1,265 @@
+package godump
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"runtime"
+	"runtime/pprof"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+/* Tracked operations
+ An operation such as a request has a time budget, Track labels the goroutine running it and godump reports the operations that run over:
+	ctx, done := service.Track(ctx, "checkout-request", 30*time.Second)
+	defer done()
+ The goroutine gets the pprof labels LabelOperation (the name) and LabelOperationID (unique per call), the goroutines it starts inherit them
+ The operations are checked by the sampler on every sample. From the first Track, or the creation of a middleware, on the sampler keeps
+ running even when no watchdog is enabled, so starting and ending operations never takes the service lock or restarts the sampler
+ When an operation runs longer than its budget a single dump named after it is written with:
+	- The stack of the goroutine that called Track
+	- The goroutines carrying the labels of the operation, from the goroutine profile
+	- Every operation in flight with its age
+*/
+
+// The pprof labels set by Track
+const (
+	LabelOperation   = "godump_operation"
+	LabelOperationID = "godump_operation_id"
+)
+
+const WatchdogOperationBudget = "operation_budget"
+
+// operation is a call to Track that did not end yet
+type operation struct {
+	id          uint64
+	name        string
+	started     time.Time
+	budget      time.Duration
+	goroutineID uint64       // the goroutine that called Track
+	labels      []string     // more pprof labels as key, value pairs
+	limiter     *dumpLimiter // limits the dumps of a group of operations, nil writes every dump
+	above       bool         // only used by the sampler
+	dumped      bool         // the dump of the operation was written, only used by the sampler
+}
+
+// dumpLimiter allows a dump every interval
+type dumpLimiter struct {
+	interval time.Duration
+	last     atomic.Int64 // time of the last dump in Unix nanoseconds
+}
+
+// allow returns whether a dump can be written now and records it when it can
+func (l *dumpLimiter) allow(now time.Time) bool {
+	last := l.last.Load()
+	if last != 0 && now.Sub(time.Unix(0, last)) < l.interval {
+		return false
+	}
+	return l.last.CompareAndSwap(last, now.UnixNano())
+}
+
+// operationRegistry holds the operations in flight, it is shared by every copy of the service
+type operationRegistry struct {
+	mu      sync.Mutex
+	nextID  atomic.Uint64
+	byID    map[uint64]*operation
+	enabled atomic.Bool // set by enableOperations, keeps the sampler running
+}
+
+// Track starts an operation that should end within budget and labels the calling goroutine with it
+// done ends the operation and restores the labels the goroutine had, it must be called on the goroutine that called Track
+func (gd *GoDumpService) Track(ctx context.Context, name string, budget time.Duration) (context.Context, func()) {
+	return gd.startOperation(ctx, gd.newOperation(name, budget))
+}
+
+func (gd *GoDumpService) newOperation(name string, budget time.Duration) *operation {
+	return &operation{
+		id:          gd.operations.nextID.Add(1),
+		name:        name,
+		started:     time.Now(),
+		budget:      budget,
+		goroutineID: currentGoroutineID(),
+	}
+}
+
+// startOperation labels the calling goroutine with the operation and its labels, then registers it
+func (gd *GoDumpService) startOperation(ctx context.Context, op *operation) (context.Context, func()) {
+	labels := append([]string{LabelOperation, op.name, LabelOperationID, strconv.FormatUint(op.id, 10)}, op.labels...)
+	labeled := pprof.WithLabels(ctx, pprof.Labels(labels...))
+	pprof.SetGoroutineLabels(labeled)
+	gd.enableOperations()
+	gd.operations.add(op)
+	var once sync.Once
+	return labeled, func() {
+		once.Do(func() {
+			pprof.SetGoroutineLabels(ctx)
+			gd.operations.remove(op)
+		})
+	}
+}
+
+// enableOperations keeps the sampler running for the operations, only the first call takes the service lock
+func (gd *GoDumpService) enableOperations() {
+	if gd.operations.enabled.Load() {
+		return
+	}
+	gd.state.mu.Lock()
+	defer gd.state.mu.Unlock()
+	gd.operations.enabled.Store(true)
+	gd.updateSampler()
+}
+
+// currentGoroutineID reads the ID of the calling goroutine from the first line of its stack, "goroutine 7 [running]:"
+func currentGoroutineID() uint64 {
+	buf := make([]byte, 64)
+	buf = buf[:runtime.Stack(buf, false)]
+	id, _, _ := strings.Cut(strings.TrimPrefix(string(buf), "goroutine "), " ")
+	n, _ := strconv.ParseUint(id, 10, 64)
+	return n
+}
+
+// add registers the operation
+func (r *operationRegistry) add(op *operation) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.byID == nil {
+		r.byID = map[uint64]*operation{}
+	}
+	r.byID[op.id] = op
+}
+
+// remove forgets the operation
+func (r *operationRegistry) remove(op *operation) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.byID, op.id)
+}
+
+func (r *operationRegistry) count() int {
+	if r == nil {
+		return 0
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.byID)
+}
+
+// list returns the operations in flight, the oldest first
+func (r *operationRegistry) list() []*operation {
+	if r == nil {
+		return nil
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	operations := make([]*operation, 0, len(r.byID))
+	for _, op := range r.byID {
+		operations = append(operations, op)
+	}
+	sort.Slice(operations, func(i, j int) bool { return operations[i].id < operations[j].id })
+	return operations
+}
+
+// check writes a dump for every operation over its budget, once per operation, it runs on the sampler after the watchdogs
+// an operation whose dump was denied by its limiter tries again on the next samples
+func (r *operationRegistry) check(gd *GoDumpService, configs *GoDumpConfigs, sample *Sample) {
+	operations := r.list()
+	for _, op := range operations {
+		age := sample.Time.Sub(op.started)
+		if gd.checkDetailThreshold(WatchdogOperationBudget, op.name, &op.above, float64(age.Milliseconds()), float64(op.budget.Milliseconds())) {
+			if op.dumped {
+				continue
+			}
+			if op.limiter != nil && !op.limiter.allow(sample.Time) {
+				gd.logger().Debug("godump skipped the dump of an operation over budget, a dump was written less than the dump interval ago",
+					slog.String("watchdog", WatchdogOperationBudget), slog.String("operation", op.name))
+				continue
+			}
+			op.dumped = true
+			goroutines, groups, err := sample.goroutineProfile()
+			if err != nil {
+				gd.emitDump(WatchdogOperationBudget, "", err)
+				continue
+			}
+			file, err := writeOperationDump(configs, op, sample.Time, operations, goroutines, groups)
+			gd.emitDump(WatchdogOperationBudget, file, err)
+		}
+	}
+}
+
+// writeOperationTable writes the operations in flight with their age
+func writeOperationTable(lines []string, now time.Time, operations []*operation) []string {
+	lines = append(lines, fmt.Sprintf("%8s  %-32s %12s %12s  %-11s  %s", "ID", "Name", "Age", "Budget", "State", "Labels"))
+	for _, op := range operations {
+		state := "ok"
+		if now.Sub(op.started) > op.budget {
+			state = "over budget"
+		}
+		lines = append(lines, fmt.Sprintf("%8d  %-32s %12v %12v  %-11s  %s", op.id, op.name, now.Sub(op.started).Round(time.Millisecond), op.budget, state, formatOperationLabels(op.labels)))
+	}
+	return lines
+}
+
+// formatOperationLabels formats key, value pairs as "key=value key=value"
+func formatOperationLabels(labels []string) string {
+	pairs := make([]string, 0, len(labels)/2)
+	for i := 0; i+1 < len(labels); i += 2 {
+		pairs = append(pairs, labels[i]+"="+labels[i+1])
+	}
+	return strings.Join(pairs, " ")
+}
+
+// operationLabels returns key, value pairs as a map, nil when there is none
+func operationLabels(labels []string) map[string]string {
+	if len(labels) == 0 {
+		return nil
+	}
+	m := make(map[string]string, len(labels)/2)
+	for i := 0; i+1 < len(labels); i += 2 {
+		m[labels[i]] = labels[i+1]
+	}
+	return m
+}
+
+// writeOperationDump writes the goroutines of an operation over its budget and returns the path of the file it created
+func writeOperationDump(goDumpConfigs *GoDumpConfigs, op *operation, now time.Time, operations []*operation, goroutines []goroutineInfo, groups []goroutineGroup) (string, error) {
+	id := strconv.FormatUint(op.id, 10)
+	return writeDumpFile(dumpFilePath(goDumpConfigs, taggedGoroutineDumpPrefix(goDumpConfigs, op.name), DefaultGoroutineDumpPrefix, ".txt"), func(f *os.File) error {
+		f.WriteString("Operation Dump\n---\n")
+		f.WriteString("Time: " + time.Now().Format("2006-01-02T15:04:05") + "\n")
+		fmt.Fprintf(f, "Operation: %s (id %s), running for %v, budget %v\n", op.name, id, now.Sub(op.started).Round(time.Millisecond), op.budget)
+		if len(op.labels) > 0 {
+			f.WriteString("Labels: " + formatOperationLabels(op.labels) + "\n")
+		}
+		f.WriteString("---\n\n")
+		f.WriteString("Goroutines of the Operation:\n")
+		for _, g := range goroutines {
+			if g.ID == op.goroutineID || g.Labels[LabelOperationID] == id {
+				f.WriteString(g.Stack + "\n\n")
+			}
+		}
+		f.WriteString("---\n\n")
+		f.WriteString("Goroutines Carrying the Operation Labels:\n")
+		for _, group := range groups {
+			if group.Labels[LabelOperationID] != id {
+				continue
+			}
+			fmt.Fprintf(f, "%d goroutines\n", group.Count)
+			for i, function := range group.Functions {
+				f.WriteString("\t" + function + " " + group.Locations[i] + "\n")
+			}
+			f.WriteString("\n")
+		}
+		f.WriteString("---\n\n")
+		f.WriteString("In-flight Operations:\n")
+		for _, line := range writeOperationTable(nil, now, operations) {
+			f.WriteString(line + "\n")
+		}
+		return nil
+	})
+}
@@ -0,0 +1,151 @@
+package godump
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// trackedCheckout runs a tracked operation that starts a goroutine and waits until release is closed
+func trackedCheckout(gds *GoDumpService, ready chan bool, release chan bool, wg *sync.WaitGroup) {
+	defer wg.Done()
+	_, done := gds.Track(context.Background(), "checkout-request", time.Second)
+	defer done()
+	wg.Add(1)
+	go trackedCheckoutChild(ready, release, wg)
+	ready <- true
+	<-release
+}
+
+func trackedCheckoutChild(ready chan bool, release chan bool, wg *sync.WaitGroup) {
+	defer wg.Done()
+	ready <- true
+	<-release
+}
+
+func TestTrackOverBudget(t *testing.T) {
+	gds, err := NewGoDumpService(&GoDumpConfigs{GoDumpPath: t.TempDir(), WatchdogIntervalMs: 1000})
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	var received []Event
+	gds.OnEvent(func(e Event) { received = append(received, e) })
+	ready := make(chan bool)
+	release := make(chan bool)
+	wg := sync.WaitGroup{}
+	wg.Add(1)
+	go trackedCheckout(gds, ready, release, &wg)
+	<-ready
+	<-ready
+	_, done := gds.Track(context.Background(), "report", time.Hour)
+
+	gds.operations.check(gds, gds.config(), &Sample{Time: time.Now()})
+	if len(received) != 0 {
+		t.Fatalf("Error: Expected no event within the budget, got %+v", received)
+	}
+	gds.operations.check(gds, gds.config(), &Sample{Time: time.Now().Add(2 * time.Second)})
+	if len(received) != 2 || received[0].Type != EventThresholdCrossed || received[0].Watchdog != WatchdogOperationBudget ||
+		received[0].Detail != "checkout-request" || received[1].Type != EventDumpWritten {
+		t.Fatalf("Error: Expected the operation over budget to fire with a dump, got %+v", received)
+	}
+	if !strings.HasPrefix(filepath.Base(received[1].File), "goroutinedump-checkout-request-") {
+		t.Errorf("Error: Expected the dump to be named after the operation, got %v", received[1].File)
+	}
+	file := received[1].File
+	received = nil
+	gds.operations.check(gds, gds.config(), &Sample{Time: time.Now().Add(3 * time.Second)})
+	if len(received) != 0 {
+		t.Errorf("Error: Expected a single dump per operation over budget, got %+v", received)
+	}
+	dump, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	labeled := string(dump)[strings.Index(string(dump), "Goroutines Carrying the Operation Labels:"):]
+	labeled = labeled[:strings.Index(labeled, "In-flight Operations:")]
+	if !strings.Contains(labeled, "trackedCheckoutChild") || !strings.Contains(labeled, "trackedCheckout ") {
+		t.Errorf("Error: Expected the goroutines of the operation in the dump, got %s", dump)
+	}
+	if strings.Contains(labeled, "TestTrackOverBudget") {
+		t.Errorf("Error: Expected the goroutines of other operations to be left out, got %s", labeled)
+	}
+	if !strings.Contains(string(dump), "checkout-request") || !strings.Contains(string(dump), "report") || !strings.Contains(string(dump), "over budget") {
+		t.Errorf("Error: Expected every operation in flight in the dump, got %s", dump)
+	}
+
+	close(release)
+	wg.Wait()
+	status := gds.Status()
+	if len(status.Operations) != 1 || status.Operations[0].Name != "report" || status.Operations[0].OverBudget {
+		t.Errorf("Error: Expected only the report operation in flight, got %+v", status.Operations)
+	}
+	if text := status.String(); !strings.Contains(text, "In-flight Operations:") || !strings.Contains(text, "report") {
+		t.Errorf("Error: Expected the operations in the status text, got %s", text)
+	}
+	done()
+	done()
+	if count := gds.operations.count(); count != 0 {
+		t.Errorf("Error: Expected no operation in flight, got %d", count)
+	}
+}
+
+func TestCurrentGoroutineID(t *testing.T) {
+	ids := make(chan uint64, 2)
+	go func() { ids <- currentGoroutineID() }()
+	go func() { ids <- currentGoroutineID() }()
+	first, second := <-ids, <-ids
+	if first == 0 || second == 0 || first == second {
+		t.Errorf("Error: Expected distinct goroutine IDs, got %d and %d", first, second)
+	}
+}
+
+func TestOperationsKeepTheSamplerRunning(t *testing.T) {
+	gds, err := NewGoDumpService(&GoDumpConfigs{GoDumpPath: t.TempDir(), WatchdogIntervalMs: 50})
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	stop := make(chan bool)
+	wg := sync.WaitGroup{}
+	if err := gds.Start(stop, &wg); err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	defer func() {
+		close(stop)
+		wg.Wait()
+	}()
+	// sampler returns the stop channel of the running sampler, nil when it is not running
+	sampler := func() chan bool {
+		gds.state.mu.Lock()
+		defer gds.state.mu.Unlock()
+		return gds.state.samplerStop
+	}
+	if sampler() != nil {
+		t.Fatalf("Error: Expected no sampler without any watchdog or operation")
+	}
+	_, done := gds.Track(context.Background(), "first", time.Minute)
+	running := sampler()
+	done()
+	_, done = gds.Track(context.Background(), "second", time.Minute)
+	done()
+	if running == nil || sampler() != running {
+		t.Errorf("Error: Expected the sampler to start once and keep running after the operations ended")
+	}
+
+	other, err := NewGoDumpService(&GoDumpConfigs{GoDumpPath: t.TempDir(), WatchdogIntervalMs: 50})
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	if err := other.Start(stop, &wg); err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	other.Middleware(nil)
+	other.state.mu.Lock()
+	defer other.state.mu.Unlock()
+	if other.state.samplerStop == nil {
+		t.Errorf("Error: Expected the middleware to start the sampler")
+	}
+}
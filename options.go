@@ -0,0 +1,438 @@
+package godump
+
+import (
+	"log/slog"
+	"os"
+	"time"
+)
+
+/* Functional options
+ New builds the configuration from DefaultConfigs and the options, so only what differs from the defaults has to be written:
+	gds, err := godump.New(
+		godump.WithHeapThreshold(512 << 20),
+		godump.WithHangDetection(90 * time.Second),
+		godump.WithPath("/dumps"),
+	)
+ Enabling options (WithHeapThreshold, WithGoroutineThreshold, WithHangDetection...) also turn on the matching GoDump* flag
+*/
+
+// Defaults used by DefaultConfigs and the dump writers
+const (
+	DefaultWatchdogIntervalMs  = 1000
+	DefaultHeapDumpPrefix      = "heapdump"
+	DefaultGoroutineDumpPrefix = "goroutinedump"
+)
+
+// DefaultConfigs returns the configuration New and the loaders start from:
+//   - no watchdog is enabled
+//   - the watchdogs tick every DefaultWatchdogIntervalMs (1s)
+//   - the dumps are written to the system temporary directory (os.TempDir)
+func DefaultConfigs() *GoDumpConfigs {
+	return &GoDumpConfigs{
+		GoDumpPath:         os.TempDir(),
+		WatchdogIntervalMs: DefaultWatchdogIntervalMs,
+	}
+}
+
+type Option func(configs *GoDumpConfigs)
+
+// New creates the service from DefaultConfigs and the given options, the result is validated like NewGoDumpService
+func New(options ...Option) (*GoDumpService, error) {
+	configs := DefaultConfigs()
+	for _, option := range options {
+		option(configs)
+	}
+	return NewGoDumpService(configs)
+}
+
+// WithPath sets the directory the dumps are written to
+func WithPath(path string) Option {
+	return func(configs *GoDumpConfigs) {
+		configs.GoDumpPath = path
+	}
+}
+
+// WithWatchdogInterval sets how often the watchdogs check the application
+func WithWatchdogInterval(interval time.Duration) Option {
+	return func(configs *GoDumpConfigs) {
+		configs.WatchdogIntervalMs = uint64(interval / time.Millisecond)
+	}
+}
+
+// WithHeapThreshold enables heap dumps when the heap exceeds the given number of bytes
+func WithHeapThreshold(bytes uint64) Option {
+	return func(configs *GoDumpConfigs) {
+		configs.GoDumpHeap = true
+		heapConfigs(configs).HeapThresholdBytes = bytes
+	}
+}
+
+// WithHeapThresholdPercentage enables heap dumps when the heap exceeds a fraction (0 to 1) of the system memory
+func WithHeapThresholdPercentage(fraction float64) Option {
+	return func(configs *GoDumpConfigs) {
+		configs.GoDumpHeap = true
+		heapConfigs(configs).HeapThresholdPercentage = fraction
+	}
+}
+
+// WithHeapTiers enables warning, critical and emergency levels on the heap in bytes, see Tiers
+func WithHeapTiers(tiers Tiers) Option {
+	return func(configs *GoDumpConfigs) {
+		configs.GoDumpHeap = true
+		heapConfigs(configs).HeapBytesTiers = &tiers
+	}
+}
+
+// WithHeapPercentageTiers enables warning, critical and emergency levels on the heap as fractions (0 to 1) of the system memory
+func WithHeapPercentageTiers(tiers Tiers) Option {
+	return func(configs *GoDumpConfigs) {
+		configs.GoDumpHeap = true
+		heapConfigs(configs).HeapPercentageTiers = &tiers
+	}
+}
+
+// WithHeapDumpPrefix sets the file name prefix of the heap dumps, DefaultHeapDumpPrefix by default
+func WithHeapDumpPrefix(prefix string) Option {
+	return func(configs *GoDumpConfigs) {
+		heapConfigs(configs).HeapDumpPrefix = &prefix
+	}
+}
+
+// WithHeapMetric sets the runtime/metrics name the heap thresholds are compared to, DefaultHeapMetric by default
+func WithHeapMetric(name string) Option {
+	return func(configs *GoDumpConfigs) {
+		heapConfigs(configs).HeapMetric = name
+	}
+}
+
+// WithGoroutineThreshold enables goroutine dumps when the number of goroutines exceeds the threshold
+func WithGoroutineThreshold(threshold uint64) Option {
+	return func(configs *GoDumpConfigs) {
+		configs.GoDumpGoroutine = true
+		goroutineConfigs(configs).GoroutineThreshold = threshold
+	}
+}
+
+// WithGoroutineTiers enables warning, critical and emergency levels on the number of goroutines, see Tiers
+func WithGoroutineTiers(tiers Tiers) Option {
+	return func(configs *GoDumpConfigs) {
+		configs.GoDumpGoroutine = true
+		goroutineConfigs(configs).GoroutineTiers = &tiers
+	}
+}
+
+// WithHangDetection enables goroutine dumps when goroutines keep the same stack for longer than hangingTime
+func WithHangDetection(hangingTime time.Duration) Option {
+	return func(configs *GoDumpConfigs) {
+		configs.GoDumpGoroutine = true
+		goroutineConfigs(configs).GoroutineHangingTimeMs = uint64(hangingTime / time.Millisecond)
+	}
+}
+
+// WithStateHangingTime sets the hanging time of the goroutines waiting in state, e.g. "sync.Mutex.Lock" or "chan receive",
+// a hangingTime of 0 never reports the state, it can be given once per state
+func WithStateHangingTime(state string, hangingTime time.Duration) Option {
+	return func(configs *GoDumpConfigs) {
+		configs.GoDumpGoroutine = true
+		goroutine := goroutineConfigs(configs)
+		if goroutine.GoroutineHangingTimeByState == nil {
+			goroutine.GoroutineHangingTimeByState = map[string]uint64{}
+		}
+		goroutine.GoroutineHangingTimeByState[state] = uint64(hangingTime / time.Millisecond)
+	}
+}
+
+// WithHangIgnore keeps the goroutines matching the entries out of the hang detection, it can be given several times
+func WithHangIgnore(ignore ...HangIgnore) Option {
+	return func(configs *GoDumpConfigs) {
+		goroutineConfigs(configs).HangIgnore = append(goroutineConfigs(configs).HangIgnore, ignore...)
+	}
+}
+
+// WithoutDefaultHangIgnore reports the goroutines of DefaultHangIgnore as hanging like any other goroutine
+func WithoutDefaultHangIgnore() Option {
+	return func(configs *GoDumpConfigs) {
+		goroutineConfigs(configs).HangIgnoreNoDefaults = true
+	}
+}
+
+// WithHangingTiers enables warning, critical and emergency levels on the longest time a goroutine kept the same stack, in milliseconds,
+// see Tiers
+func WithHangingTiers(tiers Tiers) Option {
+	return func(configs *GoDumpConfigs) {
+		configs.GoDumpGoroutine = true
+		goroutineConfigs(configs).GoroutineHangingTiers = &tiers
+	}
+}
+
+// WithGoroutineGrowth enables goroutine dumps when the goroutines of a creation site grow by more than threshold without ever going down
+// over the window
+func WithGoroutineGrowth(window time.Duration, threshold uint64) Option {
+	return func(configs *GoDumpConfigs) {
+		configs.GoDumpGoroutine = true
+		goroutineConfigs(configs).GoroutineGrowthWindowMs = uint64(window / time.Millisecond)
+		goroutineConfigs(configs).GoroutineGrowthThreshold = threshold
+	}
+}
+
+// WithGoroutineGrowthTiers enables warning, critical and emergency levels on the goroutines the fastest growing creation site gained
+// over window, see Tiers
+func WithGoroutineGrowthTiers(window time.Duration, tiers Tiers) Option {
+	return func(configs *GoDumpConfigs) {
+		configs.GoDumpGoroutine = true
+		goroutineConfigs(configs).GoroutineGrowthWindowMs = uint64(window / time.Millisecond)
+		goroutineConfigs(configs).GoroutineGrowthTiers = &tiers
+	}
+}
+
+// WithGoroutineRule enables goroutine dumps when more goroutines than rule.Threshold match the rule, or the levels of rule.Tiers,
+// it can be given several times
+func WithGoroutineRule(rule GoroutineRule) Option {
+	return func(configs *GoDumpConfigs) {
+		configs.GoDumpGoroutine = true
+		goroutineConfigs(configs).GoroutineRules = append(goroutineConfigs(configs).GoroutineRules, rule)
+	}
+}
+
+// WithStallDetection enables stall reports when more than fraction (0 to 1) of the goroutines are blocked and none of them moved
+// for samples samples in a row
+func WithStallDetection(fraction float64, samples uint64) Option {
+	return func(configs *GoDumpConfigs) {
+		configs.GoDumpGoroutine = true
+		goroutineConfigs(configs).GoroutineStallFraction = fraction
+		goroutineConfigs(configs).GoroutineStallSamples = samples
+	}
+}
+
+// WithStallReportPrefix sets the file name prefix of the stall reports, DefaultGoroutineStallReportPrefix by default
+func WithStallReportPrefix(prefix string) Option {
+	return func(configs *GoDumpConfigs) {
+		goroutineConfigs(configs).GoroutineStallReportPrefix = &prefix
+	}
+}
+
+// WithGoroutineSummaryPrefix sets the file name prefix of the goroutine summaries, DefaultGoroutineSummaryPrefix by default
+func WithGoroutineSummaryPrefix(prefix string) Option {
+	return func(configs *GoDumpConfigs) {
+		goroutineConfigs(configs).GoroutineSummaryPrefix = &prefix
+	}
+}
+
+// WithGoroutineDumpPrefix sets the file name prefix of the goroutine dumps, DefaultGoroutineDumpPrefix by default
+func WithGoroutineDumpPrefix(prefix string) Option {
+	return func(configs *GoDumpConfigs) {
+		goroutineConfigs(configs).GoroutineDumpPrefix = &prefix
+	}
+}
+
+// WithGCCPUFraction enables GC pressure dumps when the GC uses more than a fraction (0 to 1) of the CPU time
+func WithGCCPUFraction(fraction float64) Option {
+	return func(configs *GoDumpConfigs) {
+		configs.GoDumpGC = true
+		gcConfigs(configs).GCCPUFractionThreshold = fraction
+	}
+}
+
+// WithGCCyclesPerMinute enables GC pressure dumps when the GC runs more cycles per minute than the threshold
+func WithGCCyclesPerMinute(cycles float64) Option {
+	return func(configs *GoDumpConfigs) {
+		configs.GoDumpGC = true
+		gcConfigs(configs).GCCyclesPerMinuteThreshold = cycles
+	}
+}
+
+// WithGCPauseP99 enables GC pressure dumps when the 99th percentile of the GC pauses exceeds the threshold
+func WithGCPauseP99(pause time.Duration) Option {
+	return func(configs *GoDumpConfigs) {
+		configs.GoDumpGC = true
+		gcConfigs(configs).GCPauseP99ThresholdMs = float64(pause) / float64(time.Millisecond)
+	}
+}
+
+// WithGCDumpPrefix sets the file name prefix of the MemStats snapshots written by the GC pressure watchdog, DefaultGCDumpPrefix by default
+func WithGCDumpPrefix(prefix string) Option {
+	return func(configs *GoDumpConfigs) {
+		gcConfigs(configs).GCDumpPrefix = &prefix
+	}
+}
+
+// WithSchedLatency enables goroutine dumps when the scheduling latency quantile (p99 by default) exceeds the threshold
+func WithSchedLatency(threshold time.Duration) Option {
+	return func(configs *GoDumpConfigs) {
+		configs.GoDumpSched = true
+		schedConfigs(configs).SchedLatencyThresholdMs = float64(threshold) / float64(time.Millisecond)
+	}
+}
+
+// WithSchedLatencyQuantile sets the quantile (0 to 1) of the scheduling latencies compared to the threshold, DefaultSchedLatencyQuantile by default
+func WithSchedLatencyQuantile(quantile float64) Option {
+	return func(configs *GoDumpConfigs) {
+		schedConfigs(configs).SchedLatencyQuantile = quantile
+	}
+}
+
+// WithTickerLag enables goroutine dumps when the sampler wakes up later than the threshold
+func WithTickerLag(threshold time.Duration) Option {
+	return func(configs *GoDumpConfigs) {
+		configs.GoDumpSched = true
+		schedConfigs(configs).TickerLagThresholdMs = float64(threshold) / float64(time.Millisecond)
+	}
+}
+
+// WithSchedSustained sets how long a scheduler signal has to stay above its threshold before the dump is taken
+func WithSchedSustained(sustained time.Duration) Option {
+	return func(configs *GoDumpConfigs) {
+		schedConfigs(configs).SchedSustainedMs = uint64(sustained / time.Millisecond)
+	}
+}
+
+// WithThreadThreshold enables OS resources dumps when the process has more OS threads than the threshold
+func WithThreadThreshold(threshold uint64) Option {
+	return func(configs *GoDumpConfigs) {
+		configs.GoDumpOS = true
+		osConfigs(configs).ThreadThreshold = threshold
+	}
+}
+
+// WithThreadGrowth enables OS resources dumps when the number of OS threads grows faster than the given number per minute
+func WithThreadGrowth(perMinute float64) Option {
+	return func(configs *GoDumpConfigs) {
+		configs.GoDumpOS = true
+		osConfigs(configs).ThreadGrowthPerMinute = perMinute
+	}
+}
+
+// WithThreadCreateThreshold enables OS resources dumps when the runtime created more threads than the threshold
+func WithThreadCreateThreshold(threshold uint64) Option {
+	return func(configs *GoDumpConfigs) {
+		configs.GoDumpOS = true
+		osConfigs(configs).ThreadCreateThreshold = threshold
+	}
+}
+
+// WithFDThreshold enables OS resources dumps when the process has more open file descriptors than the threshold
+func WithFDThreshold(threshold uint64) Option {
+	return func(configs *GoDumpConfigs) {
+		configs.GoDumpOS = true
+		osConfigs(configs).FDThreshold = threshold
+	}
+}
+
+// WithFDGrowth enables OS resources dumps when the number of open file descriptors grows faster than the given number per minute
+func WithFDGrowth(perMinute float64) Option {
+	return func(configs *GoDumpConfigs) {
+		configs.GoDumpOS = true
+		osConfigs(configs).FDGrowthPerMinute = perMinute
+	}
+}
+
+// WithOSGrowthWindow sets the window the thread and file descriptor growth rates are measured over, DefaultOSGrowthWindowMs by default
+func WithOSGrowthWindow(window time.Duration) Option {
+	return func(configs *GoDumpConfigs) {
+		osConfigs(configs).OSGrowthWindowMs = uint64(window / time.Millisecond)
+	}
+}
+
+// WithOSDumpPrefix sets the file name prefix of the OS resources dumps, DefaultOSDumpPrefix by default
+func WithOSDumpPrefix(prefix string) Option {
+	return func(configs *GoDumpConfigs) {
+		osConfigs(configs).OSDumpPrefix = &prefix
+	}
+}
+
+// WithCPUThreshold enables a CPU profile and a goroutine dump when the process uses more than a fraction (0 to 1) of the CPUs
+// for sustainedIntervals samples in a row
+func WithCPUThreshold(fraction float64, sustainedIntervals uint64) Option {
+	return func(configs *GoDumpConfigs) {
+		configs.GoDumpCPU = true
+		cpuConfigs(configs).CPUThresholdPercentage = fraction
+		cpuConfigs(configs).CPUSustainedIntervals = sustainedIntervals
+	}
+}
+
+// WithCPUProfileDuration sets how long the CPU profile runs once the CPU watchdog fired, DefaultCPUProfileDurationMs by default
+func WithCPUProfileDuration(duration time.Duration) Option {
+	return func(configs *GoDumpConfigs) {
+		cpuConfigs(configs).CPUProfileDurationMs = uint64(duration / time.Millisecond)
+	}
+}
+
+// WithCPUProfilePrefix sets the file name prefix of the CPU profiles, DefaultCPUProfilePrefix by default
+func WithCPUProfilePrefix(prefix string) Option {
+	return func(configs *GoDumpConfigs) {
+		cpuConfigs(configs).CPUProfilePrefix = &prefix
+	}
+}
+
+// WithNativeMemoryThreshold enables native memory dumps when the resident memory exceeds the memory of the Go runtime by more than the given bytes
+func WithNativeMemoryThreshold(bytes uint64) Option {
+	return func(configs *GoDumpConfigs) {
+		configs.GoDumpNativeMemory = true
+		nativeMemoryConfigs(configs).NativeMemoryThresholdBytes = bytes
+	}
+}
+
+// WithNativeMemoryDumpPrefix sets the file name prefix of the native memory dumps, DefaultNativeMemoryDumpPrefix by default
+func WithNativeMemoryDumpPrefix(prefix string) Option {
+	return func(configs *GoDumpConfigs) {
+		nativeMemoryConfigs(configs).NativeMemoryDumpPrefix = &prefix
+	}
+}
+
+// WithMutexWait enables contention dumps when goroutines waited longer than threshold for mutexes between two samples
+func WithMutexWait(threshold time.Duration) Option {
+	return func(configs *GoDumpConfigs) {
+		configs.GoDumpContention = true
+		contentionConfigs(configs).MutexWaitThresholdMs = float64(threshold) / float64(time.Millisecond)
+	}
+}
+
+// WithBlockWait enables contention dumps when goroutines were blocked longer than threshold between two samples
+func WithBlockWait(threshold time.Duration) Option {
+	return func(configs *GoDumpConfigs) {
+		configs.GoDumpContention = true
+		contentionConfigs(configs).BlockWaitThresholdMs = float64(threshold) / float64(time.Millisecond)
+	}
+}
+
+// WithMutexProfileFraction records one mutex contention event in fraction, DefaultMutexProfileFraction by default
+func WithMutexProfileFraction(fraction uint64) Option {
+	return func(configs *GoDumpConfigs) {
+		contentionConfigs(configs).MutexProfileFraction = fraction
+	}
+}
+
+// WithBlockProfileRate records one blocking event per rate spent blocked, DefaultBlockProfileRate nanoseconds by default
+func WithBlockProfileRate(rate time.Duration) Option {
+	return func(configs *GoDumpConfigs) {
+		contentionConfigs(configs).BlockProfileRate = uint64(rate)
+	}
+}
+
+// WithContentionTopSites sets the number of call sites written in the contention dumps, DefaultContentionTopSites by default
+func WithContentionTopSites(sites uint64) Option {
+	return func(configs *GoDumpConfigs) {
+		contentionConfigs(configs).ContentionTopSites = sites
+	}
+}
+
+// WithContentionDumpPrefix sets the file name prefix of the contention dumps, DefaultContentionDumpPrefix by default
+func WithContentionDumpPrefix(prefix string) Option {
+	return func(configs *GoDumpConfigs) {
+		contentionConfigs(configs).ContentionDumpPrefix = &prefix
+	}
+}
+
+// WithTriggerRule adds a composite rule evaluated on every sample
+func WithTriggerRule(rule TriggerRule) Option {
+	return func(configs *GoDumpConfigs) {
+		configs.TriggerRules = append(configs.TriggerRules, rule)
+	}
+}
+
+// WithLogger sets the logger godump reports its activity to
+func WithLogger(logger *slog.Logger) Option {
+	return func(configs *GoDumpConfigs) {
+		configs.Logger = logger
+	}
+}
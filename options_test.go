@@ -0,0 +1,48 @@
+package godump
+
+import (
+	"os"
+	"testing"
+	"time"
+)
+
+func TestNewWithOptions(t *testing.T) {
+	gds, err := New(
+		WithHeapThreshold(512<<20),
+		WithHangDetection(90*time.Second),
+		WithGoroutineDumpPrefix("stuck"),
+		WithWatchdogInterval(5*time.Second),
+		WithPath("/dumps"),
+	)
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	configs := gds.config()
+	if !configs.GoDumpHeap || configs.HeapDumpConfigs.HeapThresholdBytes != 512<<20 {
+		t.Errorf("Error: Unexpected heap configs %+v", configs.HeapDumpConfigs)
+	}
+	if !configs.GoDumpGoroutine || configs.GoroutineDumpConfigs.GoroutineHangingTimeMs != 90000 || *configs.GoroutineDumpConfigs.GoroutineDumpPrefix != "stuck" {
+		t.Errorf("Error: Unexpected goroutine configs %+v", configs.GoroutineDumpConfigs)
+	}
+	if configs.WatchdogIntervalMs != 5000 || configs.GoDumpPath != "/dumps" {
+		t.Errorf("Error: Unexpected configs %+v", configs)
+	}
+}
+
+func TestNewDefaults(t *testing.T) {
+	gds, err := New(WithGoroutineThreshold(100))
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	configs := gds.config()
+	if configs.WatchdogIntervalMs != DefaultWatchdogIntervalMs || configs.GoDumpPath != os.TempDir() {
+		t.Errorf("Error: Expected the defaults, got %+v", configs)
+	}
+	if configs.GoDumpHeap {
+		t.Errorf("Error: Expected the heap watchdog to stay disabled")
+	}
+	// Options still go through the validation
+	if _, err := New(WithHeapThresholdPercentage(1.5)); err == nil {
+		t.Errorf("Error: Expected error, got nil")
+	}
+}
@@ -0,0 +1,423 @@
+package godump
+
+import (
+	"math"
+	"runtime"
+	"runtime/metrics"
+	"time"
+)
+
+/* Sampler
+ The service runs a single sampler goroutine instead of one polling loop per watchdog:
+	- Once per WatchdogIntervalMs the sampler gathers a Sample, through runtime/metrics so the world is not stopped
+	- The same Sample is handed to every enabled watchdog, in a fixed order
+	- The configuration is read again on every tick, watchdogs enabled by a new configuration are created and disabled ones are dropped
+	  while the ones that stay enabled keep their state
+ Data that is expensive to gather, like the goroutine profile, is only read by the first watchdog that needs it
+*/
+
+// Sample is the state of the application gathered by the sampler on one tick
+type Sample struct {
+	Time                  time.Time
+	Elapsed               time.Duration // time since the previous sample, 0 for the first one
+	TickerLag             time.Duration // how late the sampler woke up compared to WatchdogIntervalMs
+	HeapBytes             uint64        // value of the configured HeapMetric, the live heap by default
+	HeapLiveBytes         uint64        // heap still reachable at the end of the last GC
+	HeapObjectsBytes      uint64        // bytes of heap objects including garbage, the equivalent of MemStats.Alloc
+	HeapGoalBytes         uint64        // heap size the GC aims to finish the cycle at
+	TotalMemoryBytes      uint64        // all the memory mapped by the runtime, the equivalent of MemStats.Sys
+	Goroutines            uint64
+	AvailableSystemMemory uint64
+
+	// every runtime/metrics value read on this tick, see Metric and Histogram
+	metrics    map[string]float64
+	histograms map[string]*metrics.Float64Histogram
+
+	// goroutine profile, read on demand by goroutineStacks
+	stacks       []runtime.StackRecord
+	stacksRead   bool
+	stacksFailed bool
+
+	// goroutine states, creators and labels, read on demand by goroutineProfile
+	goroutines     []goroutineInfo
+	groups         []goroutineGroup
+	goroutinesRead bool
+	goroutinesErr  error
+}
+
+// Metric returns the value of a runtime/metrics metric read on this tick, the sampler reads the default metrics
+// and every metric named in the configuration, histograms are not available through Metric
+func (s *Sample) Metric(name string) (float64, bool) {
+	value, ok := s.metrics[name]
+	return value, ok
+}
+
+// Histogram returns a runtime/metrics histogram read on this tick, the counts are cumulative since the program started
+func (s *Sample) Histogram(name string) (*metrics.Float64Histogram, bool) {
+	histogram, ok := s.histograms[name]
+	return histogram, ok
+}
+
+// histogramQuantile returns the value under which the fraction q of the observations recorded between two reads of a histogram fall
+// and the number of those observations, previous can be nil to use every observation
+func histogramQuantile(previous, current *metrics.Float64Histogram, q float64) (float64, uint64) {
+	if current == nil {
+		return 0, 0
+	}
+	counts := make([]uint64, len(current.Counts))
+	total := uint64(0)
+	for i, count := range current.Counts {
+		if previous != nil && i < len(previous.Counts) && previous.Counts[i] <= count {
+			count -= previous.Counts[i]
+		}
+		counts[i] = count
+		total += count
+	}
+	if total == 0 {
+		return 0, 0
+	}
+	rank := uint64(math.Ceil(q * float64(total)))
+	seen := uint64(0)
+	for i, count := range counts {
+		seen += count
+		if seen >= rank && count > 0 {
+			// Report the upper bound of the bucket, or its lower bound for the last open bucket
+			if upper := current.Buckets[i+1]; !math.IsInf(upper, 1) {
+				return upper, total
+			}
+			return current.Buckets[i], total
+		}
+	}
+	return current.Buckets[len(current.Buckets)-1], total
+}
+
+// goroutineStacks returns the goroutine profile of the sample, it is read once and shared by the watchdogs
+func (s *Sample) goroutineStacks() ([]runtime.StackRecord, bool) {
+	if !s.stacksRead {
+		s.stacksRead = true
+		// Leave room for the goroutines started between the two calls
+		records := make([]runtime.StackRecord, runtime.NumGoroutine()+10)
+		n, ok := runtime.GoroutineProfile(records)
+		s.stacks, s.stacksFailed = records[:n], !ok
+	}
+	return s.stacks, !s.stacksFailed
+}
+
+// goroutineProfile returns the goroutines and the goroutine groups of the sample, they are read once and shared by the watchdogs
+func (s *Sample) goroutineProfile() ([]goroutineInfo, []goroutineGroup, error) {
+	if !s.goroutinesRead {
+		s.goroutinesRead = true
+		s.goroutines, s.groups, s.goroutinesErr = readGoroutines()
+	}
+	return s.goroutines, s.groups, s.goroutinesErr
+}
+
+// watchdog is a condition evaluated by the sampler on every Sample, it keeps its own state between samples
+type watchdog interface {
+	check(gd *GoDumpService, configs *GoDumpConfigs, sample *Sample)
+}
+
+// watchdogCloser is implemented by the watchdogs that change settings of the process, close restores them when the watchdog stops
+type watchdogCloser interface {
+	close()
+}
+
+type namedWatchdog struct {
+	name     string
+	watchdog watchdog
+}
+
+// builtinWatchdogs lists the watchdogs the sampler can run, in evaluation order, with the configuration that enables them
+// and the runtime/metrics they need besides the ones the sampler always reads
+var builtinWatchdogs = []struct {
+	name    string
+	enabled func(configs *GoDumpConfigs) bool
+	create  func() watchdog
+	metrics []string
+}{
+	{
+		name: WatchdogHeapBytes,
+		enabled: func(configs *GoDumpConfigs) bool {
+			return configs.GoDumpHeap && (configs.HeapDumpConfigs.HeapThresholdBytes > 0 || configs.HeapDumpConfigs.HeapBytesTiers != nil)
+		},
+		create: func() watchdog { return &heapBytesWatchdog{} },
+	},
+	{
+		name: WatchdogHeapPercentage,
+		enabled: func(configs *GoDumpConfigs) bool {
+			return configs.GoDumpHeap && (configs.HeapDumpConfigs.HeapThresholdPercentage > 0 || configs.HeapDumpConfigs.HeapPercentageTiers != nil)
+		},
+		create: func() watchdog { return &heapPercentageWatchdog{} },
+	},
+	{
+		name: WatchdogGoroutines,
+		enabled: func(configs *GoDumpConfigs) bool {
+			return configs.GoDumpGoroutine && (configs.GoroutineDumpConfigs.GoroutineThreshold > 0 || configs.GoroutineDumpConfigs.GoroutineTiers != nil)
+		},
+		create: func() watchdog { return &goroutinesWatchdog{} },
+	},
+	{
+		name: WatchdogGoroutinesHanging,
+		enabled: func(configs *GoDumpConfigs) bool {
+			return configs.GoDumpGoroutine && (configs.GoroutineDumpConfigs.GoroutineHangingTimeMs > 0 || len(configs.GoroutineDumpConfigs.GoroutineHangingTimeByState) > 0 ||
+				configs.GoroutineDumpConfigs.GoroutineHangingTiers != nil)
+		},
+		create: func() watchdog { return &goroutinesHangingWatchdog{} },
+	},
+	{
+		name: WatchdogGoroutineGrowth,
+		enabled: func(configs *GoDumpConfigs) bool {
+			return configs.GoDumpGoroutine && configs.GoroutineDumpConfigs.GoroutineGrowthWindowMs > 0
+		},
+		create: func() watchdog { return &goroutineGrowthWatchdog{} },
+	},
+	{
+		name: WatchdogGoroutineRules,
+		enabled: func(configs *GoDumpConfigs) bool {
+			return configs.GoDumpGoroutine && len(configs.GoroutineDumpConfigs.GoroutineRules) > 0
+		},
+		create: func() watchdog { return &goroutineRulesWatchdog{} },
+	},
+	{
+		name: WatchdogGoroutineStall,
+		enabled: func(configs *GoDumpConfigs) bool {
+			return configs.GoDumpGoroutine && configs.GoroutineDumpConfigs.GoroutineStallFraction > 0
+		},
+		create: func() watchdog { return &goroutineStallWatchdog{} },
+	},
+	{
+		name: WatchdogGCPressure,
+		enabled: func(configs *GoDumpConfigs) bool {
+			return configs.GoDumpGC
+		},
+		create:  func() watchdog { return &gcPressureWatchdog{} },
+		metrics: []string{MetricGCCPU, MetricTotalCPU, MetricGCCycles, MetricGCPauses},
+	},
+	{
+		name: WatchdogScheduler,
+		enabled: func(configs *GoDumpConfigs) bool {
+			return configs.GoDumpSched
+		},
+		create:  func() watchdog { return &schedulerWatchdog{} },
+		metrics: []string{MetricSchedLatencies},
+	},
+	{
+		name: WatchdogOSResources,
+		enabled: func(configs *GoDumpConfigs) bool {
+			return configs.GoDumpOS
+		},
+		create: func() watchdog { return &osResourcesWatchdog{} },
+	},
+	{
+		name: WatchdogProcessCPU,
+		enabled: func(configs *GoDumpConfigs) bool {
+			return configs.GoDumpCPU
+		},
+		create: func() watchdog { return &processCPUWatchdog{} },
+	},
+	{
+		name: WatchdogNativeMemory,
+		enabled: func(configs *GoDumpConfigs) bool {
+			return configs.GoDumpNativeMemory
+		},
+		create: func() watchdog { return &nativeMemoryWatchdog{} },
+	},
+	{
+		name: WatchdogContention,
+		enabled: func(configs *GoDumpConfigs) bool {
+			return configs.GoDumpContention
+		},
+		create: func() watchdog { return newContentionWatchdog() },
+	},
+	{
+		name: WatchdogTriggerRules,
+		enabled: func(configs *GoDumpConfigs) bool {
+			return len(configs.TriggerRules) > 0
+		},
+		create:  func() watchdog { return &triggerRulesWatchdog{} },
+		metrics: []string{MetricGCCPU, MetricTotalCPU},
+	},
+}
+
+// enabledWatchdogs returns the names of the built-in watchdogs enabled by a configuration
+func enabledWatchdogs(configs *GoDumpConfigs) []string {
+	names := []string{}
+	for _, builtin := range builtinWatchdogs {
+		if builtin.enabled(configs) {
+			names = append(names, builtin.name)
+		}
+	}
+	return names
+}
+
+// The runtime/metrics read on every tick, the metrics named in the configuration are read as well
+const (
+	MetricHeapLive    = "/gc/heap/live:bytes"
+	MetricHeapObjects = "/memory/classes/heap/objects:bytes"
+	MetricHeapGoal    = "/gc/heap/goal:bytes"
+	MetricGoroutines  = "/sched/goroutines:goroutines"
+	MetricTotalMemory = "/memory/classes/total:bytes"
+)
+
+// DefaultHeapMetric is the heap value compared to the heap thresholds when HeapMetric is empty
+const DefaultHeapMetric = MetricHeapLive
+
+// supportedMetrics are the metrics this runtime can report as a single value
+var supportedMetrics = func() map[string]metrics.Description {
+	supported := map[string]metrics.Description{}
+	for _, description := range metrics.All() {
+		if description.Kind == metrics.KindUint64 || description.Kind == metrics.KindFloat64 {
+			supported[description.Name] = description
+		}
+	}
+	return supported
+}()
+
+// heapMetric returns the metric the heap watchdogs compare to their thresholds
+func heapMetric(configs *GoDumpConfigs) string {
+	if configs.HeapDumpConfigs == nil || configs.HeapDumpConfigs.HeapMetric == "" {
+		return DefaultHeapMetric
+	}
+	return configs.HeapDumpConfigs.HeapMetric
+}
+
+type sampler struct {
+	watchdogs             []namedWatchdog
+	fixed                 bool           // the watchdogs were chosen by the caller and do not follow the configuration
+	configs               *GoDumpConfigs // the configuration the watchdogs were synced with
+	AvailableSystemMemory uint64
+	metrics               []metrics.Sample
+	last                  time.Time
+}
+
+func newSampler(AvailableSystemMemory uint64) *sampler {
+	s := &sampler{
+		AvailableSystemMemory: AvailableSystemMemory,
+	}
+	for _, name := range []string{MetricHeapLive, MetricHeapObjects, MetricHeapGoal, MetricGoroutines, MetricTotalMemory} {
+		s.addMetric(name)
+	}
+	return s
+}
+
+// addMetric makes the sampler read a metric on every tick
+func (s *sampler) addMetric(name string) {
+	for _, m := range s.metrics {
+		if m.Name == name {
+			return
+		}
+	}
+	s.metrics = append(s.metrics, metrics.Sample{Name: name})
+}
+
+// sync makes the watchdogs match the configuration, the watchdogs that stay enabled keep their state
+func (s *sampler) sync(configs *GoDumpConfigs) {
+	current := make(map[string]watchdog, len(s.watchdogs))
+	for _, w := range s.watchdogs {
+		current[w.name] = w.watchdog
+	}
+	s.watchdogs = s.watchdogs[:0]
+	for _, builtin := range builtinWatchdogs {
+		if !builtin.enabled(configs) {
+			continue
+		}
+		w, ok := current[builtin.name]
+		if !ok {
+			w = builtin.create()
+		}
+		for _, name := range builtin.metrics {
+			s.addMetric(name)
+		}
+		delete(current, builtin.name)
+		s.watchdogs = append(s.watchdogs, namedWatchdog{name: builtin.name, watchdog: w})
+	}
+	// The watchdogs left were disabled
+	for _, w := range current {
+		if closer, ok := w.(watchdogCloser); ok {
+			closer.close()
+		}
+	}
+	s.configs = configs
+}
+
+// close stops the watchdogs
+func (s *sampler) close() {
+	for _, w := range s.watchdogs {
+		if closer, ok := w.watchdog.(watchdogCloser); ok {
+			closer.close()
+		}
+	}
+}
+
+// collect gathers the sample for this tick
+func (s *sampler) collect(now time.Time, configs *GoDumpConfigs) *Sample {
+	heap := heapMetric(configs)
+	s.addMetric(heap)
+	metrics.Read(s.metrics)
+	sample := &Sample{
+		Time:                  now,
+		AvailableSystemMemory: s.AvailableSystemMemory,
+		// /sched/goroutines:goroutines also counts the runtime goroutines, NumGoroutine does not stop the world either
+		Goroutines: uint64(runtime.NumGoroutine()),
+		metrics:    make(map[string]float64, len(s.metrics)),
+		histograms: map[string]*metrics.Float64Histogram{},
+	}
+	if !s.last.IsZero() {
+		sample.Elapsed = now.Sub(s.last)
+	}
+	s.last = now
+	for _, m := range s.metrics {
+		switch m.Value.Kind() {
+		case metrics.KindUint64:
+			sample.metrics[m.Name] = float64(m.Value.Uint64())
+		case metrics.KindFloat64:
+			sample.metrics[m.Name] = m.Value.Float64()
+		case metrics.KindFloat64Histogram:
+			// The runtime reuses the histogram memory on the next read, keep a copy of the counts
+			histogram := m.Value.Float64Histogram()
+			sample.histograms[m.Name] = &metrics.Float64Histogram{
+				Counts:  append([]uint64(nil), histogram.Counts...),
+				Buckets: histogram.Buckets,
+			}
+		}
+	}
+	uint64Metric := func(name string) uint64 {
+		value, _ := sample.Metric(name)
+		return uint64(value)
+	}
+	sample.HeapBytes = uint64Metric(heap)
+	sample.HeapLiveBytes = uint64Metric(MetricHeapLive)
+	sample.HeapObjectsBytes = uint64Metric(MetricHeapObjects)
+	sample.HeapGoalBytes = uint64Metric(MetricHeapGoal)
+	sample.TotalMemoryBytes = uint64Metric(MetricTotalMemory)
+	return sample
+}
+
+// runSampler gathers a sample every WatchdogIntervalMs and hands it to the watchdogs until stop receives a value or is closed
+func (gd *GoDumpService) runSampler(stop chan bool, s *sampler) {
+	for {
+		interval := time.Duration(gd.config().WatchdogIntervalMs) * time.Millisecond
+		waitStart := time.Now()
+		select {
+		case <-stop:
+			s.close()
+			return
+		case <-time.After(interval):
+			now := time.Now()
+			configs := gd.config()
+			if !s.fixed && configs != s.configs {
+				s.sync(configs)
+			}
+			sample := s.collect(now, configs)
+			sample.TickerLag = max(now.Sub(waitStart)-interval, 0)
+			for _, w := range s.watchdogs {
+				w.watchdog.check(gd, configs, sample)
+			}
+			if !s.fixed {
+				gd.heartbeats.check(gd, configs, sample)
+				gd.operations.check(gd, configs, sample)
+				gd.triggers.check(gd, configs, sample)
+			}
+		}
+	}
+}
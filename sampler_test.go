@@ -0,0 +1,153 @@
+package godump
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestSamplerSyncKeepsWatchdogState(t *testing.T) {
+	s := newSampler(0)
+	configs := &GoDumpConfigs{
+		GoDumpHeap:           true,
+		GoDumpGoroutine:      true,
+		HeapDumpConfigs:      &DumpHeapConfigs{HeapThresholdBytes: 100},
+		GoroutineDumpConfigs: &DumpGoroutineConfigs{GoroutineThreshold: 10},
+	}
+	s.sync(configs)
+	if len(s.watchdogs) != 2 || s.watchdogs[0].name != WatchdogHeapBytes || s.watchdogs[1].name != WatchdogGoroutines {
+		t.Fatalf("Error: Unexpected watchdogs %+v", s.watchdogs)
+	}
+	heap := s.watchdogs[0].watchdog
+	heap.(*heapBytesWatchdog).above = true
+
+	// Disable the goroutine watchdog and enable the percentage one
+	configs = &GoDumpConfigs{
+		GoDumpHeap:      true,
+		HeapDumpConfigs: &DumpHeapConfigs{HeapThresholdBytes: 200, HeapThresholdPercentage: 0.5},
+	}
+	s.sync(configs)
+	if len(s.watchdogs) != 2 || s.watchdogs[1].name != WatchdogHeapPercentage {
+		t.Fatalf("Error: Unexpected watchdogs %+v", s.watchdogs)
+	}
+	if s.watchdogs[0].watchdog != heap || !heap.(*heapBytesWatchdog).above {
+		t.Errorf("Error: Expected the heap bytes watchdog to keep its state")
+	}
+}
+
+func TestSamplerCollect(t *testing.T) {
+	s := newSampler(1024)
+	now := time.Now()
+	first := s.collect(now, &GoDumpConfigs{})
+	if first.HeapObjectsBytes == 0 || first.TotalMemoryBytes == 0 || first.Goroutines == 0 || first.AvailableSystemMemory != 1024 || first.Elapsed != 0 {
+		t.Errorf("Error: Unexpected sample %+v", first)
+	}
+	second := s.collect(now.Add(time.Second), &GoDumpConfigs{})
+	if second.Elapsed != time.Second {
+		t.Errorf("Error: Expected 1s elapsed, got %v", second.Elapsed)
+	}
+	stacks, ok := second.goroutineStacks()
+	if !ok || len(stacks) == 0 {
+		t.Errorf("Error: Expected the goroutine profile, got %v records", len(stacks))
+	}
+}
+
+func TestSamplerStopsEveryWatchdogWithOneValue(t *testing.T) {
+	gds, err := New(
+		WithHeapThreshold(1<<40),
+		WithHeapThresholdPercentage(0.99),
+		WithGoroutineThreshold(1<<20),
+		WithHangDetection(time.Hour),
+		WithWatchdogInterval(10*time.Millisecond),
+		WithPath(t.TempDir()),
+	)
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	wg := sync.WaitGroup{}
+	programChanEnd := make(chan bool)
+	if err := gds.Start(programChanEnd, &wg); err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	time.Sleep(50 * time.Millisecond)
+	programChanEnd <- true
+	done := make(chan bool)
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatalf("Error: Expected the service to stop")
+	}
+}
+
+func TestSamplerHeapMetric(t *testing.T) {
+	s := newSampler(0)
+	sample := s.collect(time.Now(), &GoDumpConfigs{})
+	if sample.HeapBytes != sample.HeapLiveBytes {
+		t.Errorf("Error: Expected the live heap by default, got %v and %v", sample.HeapBytes, sample.HeapLiveBytes)
+	}
+	// Any single value metric can be used as the heap value, it is read from then on
+	configs := &GoDumpConfigs{HeapDumpConfigs: &DumpHeapConfigs{HeapMetric: "/gc/heap/objects:objects"}}
+	sample = s.collect(time.Now(), configs)
+	objects, ok := sample.Metric("/gc/heap/objects:objects")
+	if !ok || objects == 0 || sample.HeapBytes != uint64(objects) {
+		t.Errorf("Error: Expected the heap value to come from /gc/heap/objects:objects, got %v (%v)", sample.HeapBytes, objects)
+	}
+}
+
+func TestSamplerRestartWaitsForThePreviousSampler(t *testing.T) {
+	gds, err := NewGoDumpService(&GoDumpConfigs{GoDumpPath: t.TempDir(), WatchdogIntervalMs: 10})
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	stop := make(chan bool)
+	wg := sync.WaitGroup{}
+	if err := gds.Start(stop, &wg); err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	defer func() {
+		close(stop)
+		wg.Wait()
+	}()
+	var running, overlaps atomic.Int32
+	entered := make(chan bool, 100)
+	release := make(chan bool)
+	var once sync.Once
+	trigger := TriggerFunc(func(sample Sample) (bool, string) {
+		if running.Add(1) > 1 {
+			overlaps.Add(1)
+		}
+		defer running.Add(-1)
+		entered <- true
+		// The first evaluation blocks the sampler in the middle of its tick
+		once.Do(func() { <-release })
+		return false, ""
+	})
+	if err := gds.RegisterTrigger("slow", trigger); err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	<-entered
+	// Stopping and starting the sampler again while the first one is still in its tick
+	gds.UnregisterTrigger("slow")
+	if err := gds.RegisterTrigger("slow", trigger); err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	select {
+	case <-entered:
+		t.Errorf("Error: Expected the new sampler to wait for the previous one")
+	case <-time.After(100 * time.Millisecond):
+	}
+	close(release)
+	select {
+	case <-entered:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Error: Expected the new sampler to run once the previous one exited")
+	}
+	if overlaps.Load() != 0 {
+		t.Errorf("Error: Expected a single sampler at a time, got %d overlaps", overlaps.Load())
+	}
+}
@@ -0,0 +1,114 @@
+package godump
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+/* Status
+ A snapshot of what the service watches, for health endpoints and debugging:
+	- Whether the service runs and the built-in watchdogs enabled by the configuration
+	- The age of every heartbeat and whether it is stale
+	- The operations in flight (see Track) with their age and budget
+ Status.String formats the snapshot as text
+*/
+
+// Status is a snapshot of the service
+type Status struct {
+	Running    bool
+	Watchdogs  []string
+	Heartbeats []HeartbeatStatus
+	Operations []OperationStatus
+}
+
+// HeartbeatStatus is the state of one heartbeat
+type HeartbeatStatus struct {
+	Name        string
+	MaxInterval time.Duration
+	LastBeat    time.Time
+	Age         time.Duration
+	Stale       bool
+}
+
+// OperationStatus is an operation in flight
+type OperationStatus struct {
+	ID         uint64
+	Name       string
+	Started    time.Time
+	Age        time.Duration
+	Budget     time.Duration
+	OverBudget bool
+	Labels     map[string]string // the labels added to the operation, e.g. by Middleware
+}
+
+// Status returns a snapshot of the service
+func (gd *GoDumpService) Status() Status {
+	gd.state.mu.Lock()
+	status := Status{Running: gd.state.running, Watchdogs: enabledWatchdogs(gd.config())}
+	gd.state.mu.Unlock()
+	now := time.Now()
+	for _, h := range gd.heartbeats.list() {
+		age := now.Sub(h.LastBeat())
+		status.Heartbeats = append(status.Heartbeats, HeartbeatStatus{
+			Name:        h.name,
+			MaxInterval: h.maxInterval,
+			LastBeat:    h.LastBeat(),
+			Age:         age,
+			Stale:       age > h.maxInterval,
+		})
+	}
+	for _, op := range gd.operations.list() {
+		age := now.Sub(op.started)
+		status.Operations = append(status.Operations, OperationStatus{
+			ID:         op.id,
+			Name:       op.name,
+			Started:    op.started,
+			Age:        age,
+			Budget:     op.budget,
+			OverBudget: age > op.budget,
+			Labels:     operationLabels(op.labels),
+		})
+	}
+	return status
+}
+
+// String formats the status as text
+func (s Status) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Running: %v\n", s.Running)
+	fmt.Fprintf(&b, "Watchdogs: %s\n", strings.Join(s.Watchdogs, ", "))
+	if len(s.Heartbeats) > 0 {
+		b.WriteString("Heartbeats:\n")
+		fmt.Fprintf(&b, "%-32s %12s %12s  %s\n", "Name", "Age", "Max", "State")
+		for _, h := range s.Heartbeats {
+			state := "ok"
+			if h.Stale {
+				state = "stale"
+			}
+			fmt.Fprintf(&b, "%-32s %12v %12v  %s\n", h.Name, h.Age.Round(time.Millisecond), h.MaxInterval, state)
+		}
+	}
+	if len(s.Operations) > 0 {
+		b.WriteString("In-flight Operations:\n")
+		fmt.Fprintf(&b, "%8s  %-32s %12s %12s  %-11s  %s\n", "ID", "Name", "Age", "Budget", "State", "Labels")
+		for _, op := range s.Operations {
+			state := "ok"
+			if op.OverBudget {
+				state = "over budget"
+			}
+			keys := make([]string, 0, len(op.Labels))
+			for key := range op.Labels {
+				keys = append(keys, key)
+			}
+			sort.Strings(keys)
+			labels := make([]string, 0, len(keys))
+			for _, key := range keys {
+				labels = append(labels, key+"="+op.Labels[key])
+			}
+			fmt.Fprintf(&b, "%8d  %-32s %12v %12v  %-11s  %s\n", op.ID, op.Name, op.Age.Round(time.Millisecond), op.Budget, state, strings.Join(labels, " "))
+		}
+	}
+	return b.String()
+}
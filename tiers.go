@@ -0,0 +1,274 @@
+package godump
+
+import (
+	"bytes"
+	"fmt"
+	"log/slog"
+	"os"
+	"runtime"
+	"runtime/pprof"
+	"sort"
+	"strings"
+	"time"
+)
+
+/* Tiers
+ A single threshold has to choose between firing early with little data and firing late with a full dump, Tiers escalate instead.
+ Tiers set up to three levels next to the threshold of a watchdog:
+	- HeapBytesTiers and HeapPercentageTiers on the heap
+	- GoroutineTiers on the number of goroutines
+	- GoroutineHangingTiers on the longest time a goroutine kept the same stack, in milliseconds
+	- GoroutineGrowthTiers on the goroutines the fastest growing creation site gained over GoroutineGrowthWindowMs
+	- GoroutineRule.Tiers on the goroutines matching a rule
+ The levels are:
+	- Warning: the events and a goroutine summary, the goroutine count and the biggest groups of goroutines without their stacks
+	- Critical: a heap dump, a goroutine dump and a CPU profile
+	- Emergency: the callbacks registered with OnEmergency
+ A level left at 0 is off. A value above a level also is above the levels below it, so every level it crossed runs its actions.
+ Each level has its own cooldown, its actions run at most once per cooldown while the value stays above it:
+	- The crossed and recovered events carry the name of the level as Detail, after the name of the rule for GoroutineRule.Tiers
+	- EventTierReached is emitted every time the actions of a level run
+ In the configuration loaders the levels are written "warning=1GiB/1m, critical=2GiB, emergency=3GiB/10m", the duration after '/' is the cooldown,
+ and after '>' in place of the limit of a goroutine rule
+*/
+
+// Defaults of Tiers
+const (
+	DefaultWarningCooldownMs      = 60 * 1000
+	DefaultCriticalCooldownMs     = 5 * 60 * 1000
+	DefaultEmergencyCooldownMs    = 5 * 60 * 1000
+	DefaultGoroutineSummaryPrefix = "goroutinesummary"
+	goroutineSummaryGroups        = 20
+)
+
+// Names of the levels as reported in Event.Detail
+const (
+	TierWarning   = "warning"
+	TierCritical  = "critical"
+	TierEmergency = "emergency"
+)
+
+// Tiers are escalating levels of a threshold, in the unit of the threshold (bytes, fraction of the memory, goroutines or milliseconds)
+type Tiers struct {
+	Warning             float64
+	Critical            float64
+	Emergency           float64
+	WarningCooldownMs   uint64 // DefaultWarningCooldownMs when 0
+	CriticalCooldownMs  uint64 // DefaultCriticalCooldownMs when 0
+	EmergencyCooldownMs uint64 // DefaultEmergencyCooldownMs when 0
+}
+
+// tier is one level of Tiers with its actions
+type tier struct {
+	name     string
+	level    float64
+	cooldown time.Duration
+	actions  []Action
+}
+
+// levels returns the levels from the lowest to the highest
+func (t *Tiers) levels() [3]tier {
+	cooldown := func(ms uint64, defaultMs uint64) time.Duration {
+		if ms == 0 {
+			ms = defaultMs
+		}
+		return time.Duration(ms) * time.Millisecond
+	}
+	return [3]tier{
+		{TierWarning, t.Warning, cooldown(t.WarningCooldownMs, DefaultWarningCooldownMs), []Action{ActionGoroutineSummary}},
+		{TierCritical, t.Critical, cooldown(t.CriticalCooldownMs, DefaultCriticalCooldownMs), []Action{ActionHeapDump, ActionGoroutineDump, ActionCPUProfile}},
+		{TierEmergency, t.Emergency, cooldown(t.EmergencyCooldownMs, DefaultEmergencyCooldownMs), nil},
+	}
+}
+
+// String writes the levels in the syntax of the configuration loaders
+func (t Tiers) String() string {
+	parts := []string{}
+	for _, level := range t.levels() {
+		if level.level > 0 {
+			parts = append(parts, fmt.Sprintf("%s=%v/%v", level.name, level.level, level.cooldown))
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+// formatTiers writes the tiers for the logs, empty when they are not set
+func formatTiers(t *Tiers) string {
+	if t == nil {
+		return ""
+	}
+	return t.String()
+}
+
+// lowest returns the lowest level that is set, 0 when none is
+func (t *Tiers) lowest() float64 {
+	for _, level := range t.levels() {
+		if level.level > 0 {
+			return level.level
+		}
+	}
+	return 0
+}
+
+// validate checks the levels, maximum is the highest level allowed, 0 for no limit
+func (t *Tiers) validate(invalid func(field string, reason string, args ...any), field string, maximum float64) {
+	if t.Warning == 0 && t.Critical == 0 && t.Emergency == 0 {
+		invalid(field, "needs at least one of 'Warning', 'Critical' or 'Emergency'")
+	}
+	previous, previousName := 0.0, ""
+	for _, level := range t.levels() {
+		levelField := field + "." + strings.ToUpper(level.name[:1]) + level.name[1:]
+		if level.level < 0 {
+			invalid(levelField, "cannot be negative, got %v", level.level)
+			continue
+		}
+		if maximum > 0 && level.level > maximum {
+			invalid(levelField, "cannot be greater than %v, got %v", maximum, level.level)
+			continue
+		}
+		if level.level == 0 {
+			continue
+		}
+		if level.level <= previous {
+			invalid(levelField, "must be greater than the %s level %v, got %v", previousName, previous, level.level)
+		}
+		previous, previousName = level.level, level.name
+	}
+}
+
+// tierState is the state a watchdog keeps for its tiers
+type tierState struct {
+	above [3]bool
+	last  [3]time.Time // when the actions of each level last ran
+}
+
+// checkTiers compares a value to every level of the tiers, a level is level*scale in the unit of the value
+// subject names what the value is about when a watchdog has several tiers, e.g. the name of a goroutine rule, empty otherwise
+func (gd *GoDumpService) checkTiers(watchdog string, subject string, tiers *Tiers, state *tierState, value float64, scale float64, configs *GoDumpConfigs, sample *Sample) {
+	for i, level := range tiers.levels() {
+		if level.level == 0 {
+			continue
+		}
+		threshold := level.level * scale
+		detail := level.name
+		if subject != "" {
+			detail = subject + ": " + level.name
+		}
+		if !gd.checkDetailThreshold(watchdog, detail, &state.above[i], value, threshold) {
+			continue
+		}
+		if !state.last[i].IsZero() && sample.Time.Sub(state.last[i]) < level.cooldown {
+			gd.logger().Debug("godump tier reached again during its cooldown", slog.String("watchdog", watchdog), slog.String("tier", detail),
+				slog.Duration("cooldown", level.cooldown))
+			continue
+		}
+		state.last[i] = sample.Time
+		gd.logger().Info("godump tier reached, running its actions", slog.String("watchdog", watchdog), slog.String("tier", detail),
+			slog.Float64("value", value), slog.Float64("threshold", threshold))
+		event := Event{Type: EventTierReached, Watchdog: watchdog, Detail: detail, Value: value, Threshold: threshold}
+		gd.emit(event)
+		gd.runActions(watchdog, fmt.Sprintf("%s, %v above %v", detail, value, threshold), configs, level.actions)
+		if level.name == TierEmergency {
+			gd.callEmergency(event)
+		}
+	}
+}
+
+// OnEmergency registers a callback called when a value reaches the emergency level of its tiers, on the sampler goroutine
+// so it must not block, e.g. to shed load or restart the process gracefully
+func (gd *GoDumpService) OnEmergency(callback func(Event)) {
+	if callback == nil {
+		return
+	}
+	gd.events.mu.Lock()
+	defer gd.events.mu.Unlock()
+	gd.events.emergency = append(gd.events.emergency, callback)
+}
+
+func (gd *GoDumpService) callEmergency(event Event) {
+	// The callbacks run after the lock is released so they can register or unsubscribe
+	gd.events.mu.RLock()
+	callbacks := append([]func(Event){}, gd.events.emergency...)
+	gd.events.mu.RUnlock()
+	if len(callbacks) == 0 {
+		gd.logger().Warn("godump emergency tier reached without any OnEmergency callback", slog.String("watchdog", event.Watchdog))
+	}
+	for _, callback := range callbacks {
+		callback(event)
+	}
+}
+
+// writeGoroutineSummary writes the goroutine count and the biggest groups of goroutines sharing a stack, it is cheaper to read
+// than a goroutine dump, and returns the path of the file it created
+func writeGoroutineSummary(goDumpConfigs *GoDumpConfigs, reason string) (string, error) {
+	var prefix *string
+	if goDumpConfigs.GoroutineDumpConfigs != nil {
+		prefix = goDumpConfigs.GoroutineDumpConfigs.GoroutineSummaryPrefix
+	}
+	var buf bytes.Buffer
+	if err := pprof.Lookup("goroutine").WriteTo(&buf, 1); err != nil {
+		return "", err
+	}
+	groups := parseGoroutineGroups(buf.String())
+	sort.SliceStable(groups, func(i, j int) bool { return groups[i].Count > groups[j].Count })
+	return writeDumpFile(dumpFilePath(goDumpConfigs, prefix, DefaultGoroutineSummaryPrefix, ".txt"), func(f *os.File) error {
+		f.WriteString("Goroutine Summary\n---\n")
+		f.WriteString("Time: " + time.Now().Format("2006-01-02T15:04:05") + "\n")
+		f.WriteString("Reason: " + reason + "\n")
+		fmt.Fprintf(f, "Number of Goroutines: %d in %d groups\n", runtime.NumGoroutine(), len(groups))
+		f.WriteString("---\n\n")
+		f.WriteString("Biggest Groups:\n")
+		fmt.Fprintf(f, "%8s  %s\n", "Count", "Function")
+		for i, group := range groups {
+			if i == goroutineSummaryGroups {
+				break
+			}
+			g := goroutineInfo{Functions: group.Functions, Locations: group.Locations}
+			fmt.Fprintf(f, "%8d  %s\n", group.Count, g.waitSite())
+		}
+		return nil
+	})
+}
+
+// parseCountLevel reads a level of Tiers counted in goroutines, e.g. "5k"
+func parseCountLevel(level string) (float64, error) {
+	count, err := parseCount(level)
+	return float64(count), err
+}
+
+// parseTiers parses levels written as "warning=1GiB/1m, critical=2GiB, emergency=3GiB/10m", parse reads a level
+func parseTiers(value string, parse func(string) (float64, error)) (*Tiers, error) {
+	tiers := &Tiers{}
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		name, text, ok := strings.Cut(entry, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid tier %q: expected <level>=<value>[/<cooldown>]", entry)
+		}
+		text, cooldownText, hasCooldown := strings.Cut(text, "/")
+		level, err := parse(strings.TrimSpace(text))
+		if err != nil {
+			return nil, fmt.Errorf("invalid tier %q: %w", entry, err)
+		}
+		cooldown := uint64(0)
+		if hasCooldown {
+			if cooldown, err = parseDurationMs(cooldownText); err != nil {
+				return nil, fmt.Errorf("invalid tier %q: %w", entry, err)
+			}
+		}
+		switch strings.TrimSpace(name) {
+		case TierWarning:
+			tiers.Warning, tiers.WarningCooldownMs = level, cooldown
+		case TierCritical:
+			tiers.Critical, tiers.CriticalCooldownMs = level, cooldown
+		case TierEmergency:
+			tiers.Emergency, tiers.EmergencyCooldownMs = level, cooldown
+		default:
+			return nil, fmt.Errorf("invalid tier %q: unknown level %q, expected warning, critical or emergency", entry, name)
+		}
+	}
+	return tiers, nil
+}
@@ -0,0 +1,300 @@
+package godump
+
+import (
+	"context"
+	"errors"
+	"os"
+	"runtime/pprof"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestTiersEscalate(t *testing.T) {
+	configs := &GoDumpConfigs{GoDumpPath: t.TempDir(), WatchdogIntervalMs: 1000, GoDumpGoroutine: true,
+		GoroutineDumpConfigs: &DumpGoroutineConfigs{GoroutineTiers: &Tiers{Warning: 10, Critical: 20, Emergency: 30}},
+		CPUDumpConfigs:       &DumpCPUConfigs{CPUProfileDurationMs: 100},
+	}
+	gds, err := NewGoDumpService(configs)
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	var mu sync.Mutex
+	var received []Event
+	var emergencies []Event
+	gds.OnEvent(func(e Event) {
+		mu.Lock()
+		defer mu.Unlock()
+		received = append(received, e)
+	})
+	gds.OnEmergency(func(e Event) { emergencies = append(emergencies, e) })
+	// take returns the events received since the previous call, as "Type detail" for the tier events
+	take := func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		names := []string{}
+		for _, e := range received {
+			names = append(names, strings.TrimSpace(e.Type.String()+" "+e.Detail))
+		}
+		received = nil
+		return names
+	}
+
+	w := &goroutinesWatchdog{}
+	start := time.Now()
+	w.check(gds, configs, &Sample{Time: start, Goroutines: 15})
+	mu.Lock()
+	summary := received[len(received)-1].File
+	mu.Unlock()
+	if names := strings.Join(take(), ", "); names != "ThresholdCrossed warning, TierReached warning, DumpWritten" {
+		t.Fatalf("Error: Expected the warning level to write a summary, got %s", names)
+	}
+	content, err := os.ReadFile(summary)
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	if !strings.HasPrefix(summary, configs.GoDumpPath+"/"+DefaultGoroutineSummaryPrefix) || !strings.Contains(string(content), "Goroutine Summary") ||
+		!strings.Contains(string(content), "Reason: goroutines: warning, 15 above 10") || !strings.Contains(string(content), "Biggest Groups:") ||
+		strings.Contains(string(content), "goroutine 1 [") {
+		t.Errorf("Error: Unexpected summary %s:\n%s", summary, content)
+	}
+
+	w.check(gds, configs, &Sample{Time: start.Add(time.Second), Goroutines: 15})
+	if names := take(); len(names) != 0 {
+		t.Errorf("Error: Expected no event during the cooldown, got %v", names)
+	}
+
+	w.check(gds, configs, &Sample{Time: start.Add(2 * time.Second), Goroutines: 35})
+	if names := strings.Join(take(), ", "); names != "ThresholdCrossed critical, TierReached critical, DumpWritten, DumpWritten, "+
+		"ThresholdCrossed emergency, TierReached emergency" {
+		t.Fatalf("Error: Expected the critical and emergency levels to fire, got %s", names)
+	}
+	if len(emergencies) != 1 || emergencies[0].Watchdog != WatchdogGoroutines || emergencies[0].Value != 35 || emergencies[0].Threshold != 30 {
+		t.Errorf("Error: Expected the emergency callback to be called once, got %+v", emergencies)
+	}
+
+	// The CPU profile of the critical level finishes in the background
+	deadline := time.Now().Add(5 * time.Second)
+	for gds.state.profiling.Load() && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	mu.Lock()
+	if len(received) != 1 || received[0].Type != EventDumpWritten || !strings.HasSuffix(received[0].File, ".pprof") {
+		t.Errorf("Error: Expected the CPU profile to be written, got %+v", received)
+	}
+	received = nil
+	mu.Unlock()
+
+	w.check(gds, configs, &Sample{Time: start.Add(61 * time.Second), Goroutines: 15})
+	if names := strings.Join(take(), ", "); names != "TierReached warning, DumpWritten, ThresholdRecovered critical, ThresholdRecovered emergency" {
+		t.Errorf("Error: Expected the warning level to fire again after its cooldown, got %s", names)
+	}
+}
+
+func TestTiersAndThresholdDumpOnSameSample(t *testing.T) {
+	configs := &GoDumpConfigs{GoDumpPath: t.TempDir(), WatchdogIntervalMs: 1000, GoDumpHeap: true,
+		HeapDumpConfigs: &DumpHeapConfigs{HeapThresholdBytes: 10, HeapBytesTiers: &Tiers{Critical: 20}},
+		CPUDumpConfigs:  &DumpCPUConfigs{CPUProfileDurationMs: 100},
+	}
+	gds, err := NewGoDumpService(configs)
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	var mu sync.Mutex
+	files := map[string]int{}
+	heapDumps := 0
+	gds.OnEvent(func(e Event) {
+		mu.Lock()
+		defer mu.Unlock()
+		if e.Type == EventDumpWritten {
+			files[e.File]++
+			if strings.HasSuffix(e.File, ".hprof") {
+				heapDumps++
+			}
+		}
+	})
+	(&heapBytesWatchdog{}).check(gds, configs, &Sample{Time: time.Now(), HeapBytes: 100})
+	deadline := time.Now().Add(5 * time.Second)
+	for gds.state.profiling.Load() && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if heapDumps != 2 {
+		t.Errorf("Error: Expected a heap dump for the threshold and one for the critical level, got %v", files)
+	}
+	for file, count := range files {
+		if count != 1 {
+			t.Errorf("Error: Expected %s to be written once, got %d", file, count)
+		}
+		if _, err := os.Stat(file); err != nil {
+			t.Errorf("Error: %v", err)
+		}
+	}
+}
+
+func TestTiersOnGoroutineWatchdogs(t *testing.T) {
+	stop := make(chan bool)
+	defer close(stop)
+	pprof.Do(context.Background(), pprof.Labels("pool", "godump_tiers_test"), func(context.Context) {
+		leakGoroutines(3, stop)
+	})
+	time.Sleep(10 * time.Millisecond)
+	configs := &GoDumpConfigs{GoDumpPath: t.TempDir(), WatchdogIntervalMs: 1000, GoDumpGoroutine: true,
+		GoroutineDumpConfigs: &DumpGoroutineConfigs{
+			GoroutineHangingTiers:   &Tiers{Warning: 1500},
+			GoroutineGrowthWindowMs: 3000,
+			GoroutineGrowthTiers:    &Tiers{Warning: 5},
+			GoroutineRules:          []GoroutineRule{{LabelKey: "pool", LabelValue: "godump_tiers_test", Tiers: &Tiers{Warning: 2}}},
+		},
+	}
+	gds, err := NewGoDumpService(configs)
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	var received []Event
+	gds.OnEvent(func(e Event) { received = append(received, e) })
+	// reached returns the EventTierReached received since the previous call
+	reached := func() []Event {
+		events := []Event{}
+		for _, e := range received {
+			if e.Type == EventTierReached {
+				events = append(events, e)
+			}
+		}
+		received = nil
+		return events
+	}
+	start := time.Now()
+
+	// The longest hang is compared to the levels in milliseconds
+	hanging := &goroutinesHangingWatchdog{}
+	hanging.check(gds, configs, &Sample{Time: start})
+	hanging.check(gds, configs, &Sample{Time: start.Add(time.Second)})
+	if events := reached(); len(events) != 0 {
+		t.Errorf("Error: Expected no tier below the warning level, got %+v", events)
+	}
+	hanging.check(gds, configs, &Sample{Time: start.Add(2 * time.Second)})
+	if events := reached(); len(events) != 1 || events[0].Watchdog != WatchdogGoroutinesHanging || events[0].Detail != TierWarning ||
+		events[0].Value != 2000 || events[0].Threshold != 1500 {
+		t.Errorf("Error: Expected the hang to reach the warning level, got %+v", events)
+	}
+
+	// The growth of the fastest growing creation site is compared to the levels, without the default threshold
+	growth := &goroutineGrowthWatchdog{}
+	for i := 0; i <= 3; i++ {
+		leakGoroutines(3, stop)
+		time.Sleep(10 * time.Millisecond)
+		growth.check(gds, configs, &Sample{Time: start.Add(time.Duration(i) * time.Second)})
+	}
+	for _, e := range received {
+		if e.Type == EventThresholdCrossed && e.Detail != TierWarning {
+			t.Errorf("Error: Expected GoroutineGrowthThreshold to be off next to the tiers, got %+v", e)
+		}
+	}
+	if events := reached(); len(events) != 1 || events[0].Watchdog != WatchdogGoroutineGrowth || events[0].Value != 9 {
+		t.Errorf("Error: Expected the growth to reach the warning level, got %+v", events)
+	}
+
+	// The tiers of a rule carry its name
+	(&goroutineRulesWatchdog{}).check(gds, configs, &Sample{Time: start})
+	if events := reached(); len(events) != 1 || events[0].Watchdog != WatchdogGoroutineRules ||
+		events[0].Detail != "label=pool:godump_tiers_test: warning" || events[0].Value != 3 {
+		t.Errorf("Error: Expected the rule to reach the warning level, got %+v", events)
+	}
+}
+
+func TestTiersValidate(t *testing.T) {
+	configs := &GoDumpConfigs{GoDumpPath: t.TempDir(), WatchdogIntervalMs: 1000, GoDumpHeap: true, GoDumpGoroutine: true,
+		HeapDumpConfigs: &DumpHeapConfigs{
+			HeapBytesTiers:      &Tiers{Warning: 2 << 30, Critical: 1 << 30},
+			HeapPercentageTiers: &Tiers{Warning: 0.5, Emergency: 1.5},
+		},
+		GoroutineDumpConfigs: &DumpGoroutineConfigs{GoroutineTiers: &Tiers{Critical: -1}},
+	}
+	err := configs.Validate()
+	for _, field := range []string{"HeapDumpConfigs.HeapBytesTiers.Critical", "HeapDumpConfigs.HeapPercentageTiers.Emergency",
+		"GoroutineDumpConfigs.GoroutineTiers.Critical"} {
+		found := false
+		for _, e := range err.(interface{ Unwrap() []error }).Unwrap() {
+			var configErr *ConfigError
+			if errors.As(e, &configErr) && configErr.Field == field {
+				found = true
+			}
+		}
+		if !found {
+			t.Errorf("Error: Expected an error for %s, got %v", field, err)
+		}
+	}
+
+	configs.GoroutineDumpConfigs.GoroutineTiers = &Tiers{WarningCooldownMs: 1000}
+	if err := configs.Validate(); err == nil || !strings.Contains(err.Error(), "'GoroutineDumpConfigs.GoroutineTiers' needs at least one") {
+		t.Errorf("Error: Expected an error for tiers without any level, got %v", err)
+	}
+
+	configs.GoroutineDumpConfigs = &DumpGoroutineConfigs{GoroutineHangingTiers: &Tiers{Warning: 500}, GoroutineGrowthTiers: &Tiers{Warning: 5}}
+	err = configs.Validate()
+	if err == nil || !strings.Contains(err.Error(), "'GoroutineDumpConfigs.GoroutineHangingTiers' (500ms) cannot be shorter") ||
+		!strings.Contains(err.Error(), "'GoroutineDumpConfigs.GoroutineGrowthTiers' cannot be set without 'GoroutineGrowthWindowMs'") {
+		t.Errorf("Error: Expected errors for the hanging and growth tiers, got %v", err)
+	}
+
+	gds, err := New(WithPath(t.TempDir()), WithHeapPercentageTiers(Tiers{Warning: 0.7, Critical: 0.9}), WithGoroutineTiers(Tiers{Warning: 10000}))
+	if err != nil {
+		t.Fatalf("Error: Expected tiers without thresholds to be valid, got %v", err)
+	}
+	names := enabledWatchdogs(gds.config())
+	if strings.Join(names, ",") != WatchdogHeapPercentage+","+WatchdogGoroutines {
+		t.Errorf("Error: Expected the heap percentage and goroutine watchdogs, got %v", names)
+	}
+}
+
+func TestParseTiers(t *testing.T) {
+	tiers, err := parseTiers("warning=1GiB/1m, critical=2GiB, emergency=3GiB/10m", func(level string) (float64, error) {
+		size, err := parseSize(level)
+		return float64(size), err
+	})
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	expected := Tiers{Warning: 1 << 30, WarningCooldownMs: 60000, Critical: 2 << 30, Emergency: 3 << 30, EmergencyCooldownMs: 600000}
+	if *tiers != expected {
+		t.Errorf("Error: Expected %+v, got %+v", expected, *tiers)
+	}
+	if tiers.String() != "warning=1.073741824e+09/1m0s, critical=2.147483648e+09/5m0s, emergency=3.221225472e+09/10m0s" {
+		t.Errorf("Error: Unexpected string %q", tiers.String())
+	}
+	for _, text := range []string{"warning", "warning=high", "warning=80%/soon", "severe=90%"} {
+		if _, err := parseTiers(text, parsePercentage); err == nil {
+			t.Errorf("Error: Expected an error for %q", text)
+		}
+	}
+}
+
+func TestEmergencyCallbackCanSubscribe(t *testing.T) {
+	gds, err := NewGoDumpService(&GoDumpConfigs{GoDumpPath: t.TempDir(), WatchdogIntervalMs: 1000})
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	calls := 0
+	gds.OnEmergency(func(e Event) {
+		calls++
+		// Registering from an emergency callback must not deadlock
+		gds.Unsubscribe(gds.Subscribe())
+		gds.OnEmergency(func(e Event) {})
+	})
+	done := make(chan bool)
+	go func() {
+		gds.callEmergency(Event{Type: EventTierReached, Watchdog: WatchdogGoroutines, Detail: TierEmergency})
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Error: Expected callEmergency to return while a callback subscribes")
+	}
+	if calls != 1 {
+		t.Errorf("Error: Expected the callback to be called once, got %d", calls)
+	}
+}
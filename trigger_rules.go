@@ -0,0 +1,524 @@
+package godump
+
+import (
+	"fmt"
+	"regexp"
+	"runtime/metrics"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+/* Trigger rules
+ A single threshold fires on every spike, a TriggerRule combines conditions on the sample and can ask for them to last:
+	godump.TriggerRule{
+		Name: "heap-and-goroutines",
+		When: godump.Condition{All: []godump.Condition{
+			{Metric: "heap", Op: ">", Value: 1 << 30},
+			{Metric: "goroutines", Op: ">", Value: 5000},
+		}, ForTicks: 3},
+		Actions: []godump.Action{godump.ActionHeapDump},
+	}
+ A Condition is a comparison (Metric, Op, Value) or a combination of conditions (All for AND, Any for OR), any of them can set ForTicks
+ to hold on that many samples in a row. The metrics are:
+	- heap, heap_live, heap_objects, heap_goal, total_memory: bytes, heap is the configured HeapMetric
+	- heap_percentage: heap over the available system memory, a fraction between 0 and 1
+	- goroutines
+	- gc_fraction: fraction of the CPU time spent in the GC between two samples
+	- ticker_lag_ms: how late the sampler woke up
+	- any runtime/metrics name with a single value, e.g. /sched/gomaxprocs:threads
+ The rules of GoDumpConfigs.TriggerRules are evaluated on every sample like the triggers of RegisterTrigger, NewRuleTrigger turns a
+ Condition into a Trigger. In the configuration loaders the rules are written as "[<name>:] <expression> [=> <action>, ...]" separated by ';':
+	heap > 1GiB && goroutines > 5k for 3 => heap_dump; pressure: heap_percentage > 80% || gc_fraction > 0.3
+ && binds tighter than ||, "for <n>" applies to the expression it ends (use parentheses for a part of it), AND and OR are accepted too
+ and the values take the size and count units (KiB, MiB, GiB, k, M) or a percentage
+*/
+
+// TriggerRule runs its actions while its condition holds
+type TriggerRule struct {
+	Name    string // reported as Event.Watchdog, the condition written as an expression when empty
+	When    Condition
+	Actions []Action // DefaultTriggerActions when empty
+}
+
+// Condition is a comparison when Metric is set, or the combination of the conditions of All (AND) or Any (OR)
+type Condition struct {
+	Metric   string
+	Op       string // >, >=, < or <=
+	Value    float64
+	All      []Condition
+	Any      []Condition
+	ForTicks uint64 // the condition has to hold on this many samples in a row, 0 and 1 need a single sample
+}
+
+// ruleMetrics are the values of the sample a condition can compare, gc_fraction and the runtime/metrics names are read apart
+var ruleMetrics = map[string]func(sample *Sample) float64{
+	"heap":         func(sample *Sample) float64 { return float64(sample.HeapBytes) },
+	"heap_live":    func(sample *Sample) float64 { return float64(sample.HeapLiveBytes) },
+	"heap_objects": func(sample *Sample) float64 { return float64(sample.HeapObjectsBytes) },
+	"heap_goal":    func(sample *Sample) float64 { return float64(sample.HeapGoalBytes) },
+	"total_memory": func(sample *Sample) float64 { return float64(sample.TotalMemoryBytes) },
+	"goroutines":   func(sample *Sample) float64 { return float64(sample.Goroutines) },
+	"heap_percentage": func(sample *Sample) float64 {
+		if sample.AvailableSystemMemory == 0 {
+			return 0
+		}
+		return float64(sample.HeapBytes) / float64(sample.AvailableSystemMemory)
+	},
+	"ticker_lag_ms": func(sample *Sample) float64 { return float64(sample.TickerLag) / float64(time.Millisecond) },
+}
+
+const ruleMetricGCFraction = "gc_fraction"
+
+// WatchdogTriggerRules is the built-in watchdog evaluating GoDumpConfigs.TriggerRules, the events carry the name of each rule
+const WatchdogTriggerRules = "trigger_rules"
+
+// name returns the name of the rule as reported in the events
+func (r *TriggerRule) name() string {
+	if r.Name != "" {
+		return r.Name
+	}
+	return r.When.String()
+}
+
+func (r *TriggerRule) validate(invalid func(field string, reason string, args ...any), field string) {
+	if r.Name != "" && reservedWatchdogName(r.Name) {
+		invalid(field+".Name", "cannot be the name of a built-in watchdog, got %q", r.Name)
+	}
+	for i, action := range r.Actions {
+		if !action.valid() {
+			invalid(fmt.Sprintf("%s.Actions[%d]", field, i), "must be %s, got %q", actionNames, action)
+		}
+	}
+	r.When.validate(invalid, field+".When")
+}
+
+func (c *Condition) validate(invalid func(field string, reason string, args ...any), field string) {
+	set := 0
+	if c.Metric != "" {
+		set++
+	}
+	if len(c.All) > 0 {
+		set++
+	}
+	if len(c.Any) > 0 {
+		set++
+	}
+	if set != 1 {
+		invalid(field, "needs exactly one of 'Metric', 'All' or 'Any'")
+		return
+	}
+	if c.Metric != "" {
+		if _, ok := ruleMetrics[c.Metric]; !ok && c.Metric != ruleMetricGCFraction {
+			if _, ok := supportedMetrics[c.Metric]; !ok {
+				invalid(field+".Metric", "must be a rule metric or a runtime/metrics name with a single value, got %q", c.Metric)
+			}
+		}
+		switch c.Op {
+		case ">", ">=", "<", "<=":
+		default:
+			invalid(field+".Op", "must be >, >=, < or <=, got %q", c.Op)
+		}
+	}
+	for i := range c.All {
+		c.All[i].validate(invalid, fmt.Sprintf("%s.All[%d]", field, i))
+	}
+	for i := range c.Any {
+		c.Any[i].validate(invalid, fmt.Sprintf("%s.Any[%d]", field, i))
+	}
+}
+
+// String writes the condition in the expression syntax of the configuration loaders
+func (c Condition) String() string {
+	var text string
+	switch {
+	case c.Metric != "":
+		text = c.Metric + " " + c.Op + " " + strconv.FormatFloat(c.Value, 'f', -1, 64)
+	case len(c.All) > 0:
+		text = joinConditions(c.All, " && ")
+	default:
+		text = joinConditions(c.Any, " || ")
+	}
+	if c.ForTicks > 1 {
+		text += " for " + strconv.FormatUint(c.ForTicks, 10)
+	}
+	return text
+}
+
+// joinConditions writes the conditions with an operator, the ones that are not plain comparisons are put in parentheses
+func joinConditions(conditions []Condition, operator string) string {
+	parts := make([]string, len(conditions))
+	for i, c := range conditions {
+		parts[i] = c.String()
+		if c.Metric == "" || c.ForTicks > 1 {
+			parts[i] = "(" + parts[i] + ")"
+		}
+	}
+	return strings.Join(parts, operator)
+}
+
+// compiledCondition is a Condition with the state kept between samples
+type compiledCondition struct {
+	Condition
+	children []*compiledCondition
+	streak   uint64             // samples in a row the condition held
+	runtime  []metrics.Sample   // runtime/metrics the sampler does not read
+	previous map[string]float64 // values of the previous sample for the rates
+}
+
+func compileCondition(c Condition) *compiledCondition {
+	compiled := &compiledCondition{Condition: c}
+	for _, child := range append(append([]Condition{}, c.All...), c.Any...) {
+		compiled.children = append(compiled.children, compileCondition(child))
+	}
+	return compiled
+}
+
+// evaluate returns whether the condition held long enough, every comparison is evaluated so that the streaks stay right
+// and the values read are added to values
+func (c *compiledCondition) evaluate(sample *Sample, values map[string]float64) bool {
+	held := false
+	switch {
+	case c.Metric != "":
+		value, ok := c.read(sample)
+		if ok {
+			values[c.Metric] = value
+			held = compare(value, c.Op, c.Value)
+		}
+	case len(c.All) > 0:
+		held = true
+		for _, child := range c.children {
+			held = child.evaluate(sample, values) && held
+		}
+	default:
+		for _, child := range c.children {
+			held = child.evaluate(sample, values) || held
+		}
+	}
+	if !held {
+		c.streak = 0
+		return false
+	}
+	c.streak++
+	return c.streak >= max(c.ForTicks, 1)
+}
+
+func compare(value float64, op string, threshold float64) bool {
+	switch op {
+	case ">":
+		return value > threshold
+	case ">=":
+		return value >= threshold
+	case "<":
+		return value < threshold
+	case "<=":
+		return value <= threshold
+	}
+	return false
+}
+
+// read returns the value of the metric of a comparison, false when it cannot be known yet
+func (c *compiledCondition) read(sample *Sample) (float64, bool) {
+	if value, ok := ruleMetrics[c.Metric]; ok {
+		return value(sample), true
+	}
+	if c.Metric != ruleMetricGCFraction {
+		return c.runtimeMetric(sample, c.Metric)
+	}
+	// The GC fraction is a rate, we need two samples
+	gc, okGC := c.runtimeMetric(sample, MetricGCCPU)
+	total, okTotal := c.runtimeMetric(sample, MetricTotalCPU)
+	if !okGC || !okTotal {
+		return 0, false
+	}
+	previousGC, seen := c.previous[MetricGCCPU]
+	previousTotal := c.previous[MetricTotalCPU]
+	c.previous = map[string]float64{MetricGCCPU: gc, MetricTotalCPU: total}
+	if !seen || total <= previousTotal {
+		return 0, false
+	}
+	return (gc - previousGC) / (total - previousTotal), true
+}
+
+// runtimeMetric returns a runtime/metrics value from the sample, or reads it when the sampler does not
+func (c *compiledCondition) runtimeMetric(sample *Sample, name string) (float64, bool) {
+	if value, ok := sample.Metric(name); ok {
+		return value, true
+	}
+	i := 0
+	for i < len(c.runtime) && c.runtime[i].Name != name {
+		i++
+	}
+	if i == len(c.runtime) {
+		c.runtime = append(c.runtime, metrics.Sample{Name: name})
+	}
+	metrics.Read(c.runtime[i : i+1])
+	switch c.runtime[i].Value.Kind() {
+	case metrics.KindUint64:
+		return float64(c.runtime[i].Value.Uint64()), true
+	case metrics.KindFloat64:
+		return c.runtime[i].Value.Float64(), true
+	}
+	return 0, false
+}
+
+// ruleTrigger is a Condition used as a Trigger
+type ruleTrigger struct {
+	condition *compiledCondition
+	text      string
+}
+
+// NewRuleTrigger returns a Trigger firing while the condition holds, to be registered with RegisterTrigger
+func NewRuleTrigger(condition Condition) (Trigger, error) {
+	var errs []string
+	condition.validate(func(field string, reason string, args ...any) {
+		errs = append(errs, fmt.Sprintf("'%s' %s", field, fmt.Sprintf(reason, args...)))
+	}, "Condition")
+	if len(errs) > 0 {
+		return nil, fmt.Errorf("invalid condition %q: %s", condition.String(), strings.Join(errs, ", "))
+	}
+	return newRuleTrigger(condition), nil
+}
+
+func newRuleTrigger(condition Condition) *ruleTrigger {
+	return &ruleTrigger{condition: compileCondition(condition), text: condition.String()}
+}
+
+// Evaluate returns whether the condition holds, the reason is the condition followed by the values read
+func (t *ruleTrigger) Evaluate(sample Sample) (bool, string) {
+	values := map[string]float64{}
+	fired := t.condition.evaluate(&sample, values)
+	if !fired {
+		return false, ""
+	}
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	read := make([]string, len(names))
+	for i, name := range names {
+		read[i] = name + "=" + strconv.FormatFloat(values[name], 'f', -1, 64)
+	}
+	return true, t.text + " (" + strings.Join(read, ", ") + ")"
+}
+
+// triggerRulesWatchdog evaluates GoDumpConfigs.TriggerRules, a rule that stays in the configuration keeps its state
+type triggerRulesWatchdog struct {
+	rules map[string]*registeredTrigger // by the rule written as text, with its name and actions
+}
+
+func (w *triggerRulesWatchdog) check(gd *GoDumpService, configs *GoDumpConfigs, sample *Sample) {
+	rules := make(map[string]*registeredTrigger, len(configs.TriggerRules))
+	for _, rule := range configs.TriggerRules {
+		actions := rule.Actions
+		if len(actions) == 0 {
+			actions = DefaultTriggerActions()
+		}
+		key := fmt.Sprintf("%s: %s => %v", rule.name(), rule.When.String(), actions)
+		t, ok := w.rules[key]
+		if !ok {
+			t = &registeredTrigger{name: rule.name(), trigger: newRuleTrigger(rule.When), actions: actions}
+		}
+		rules[key] = t
+		gd.checkTrigger(t, configs, sample)
+	}
+	w.rules = rules
+}
+
+// ruleName matches the name written before an expression, runtime/metrics names start with '/'
+var ruleName = regexp.MustCompile(`^\s*([A-Za-z0-9_.-]+)\s*:\s`)
+
+// parseTriggerRules parses rules written as "heap > 1GiB && goroutines > 5k for 3 => heap_dump; pressure: gc_fraction > 30%"
+func parseTriggerRules(value string) ([]TriggerRule, error) {
+	rules := []TriggerRule{}
+	for _, text := range strings.Split(value, ";") {
+		text = strings.TrimSpace(text)
+		if text == "" {
+			continue
+		}
+		rule := TriggerRule{}
+		expression := text
+		if match := ruleName.FindStringSubmatch(expression); match != nil {
+			rule.Name = match[1]
+			expression = expression[len(match[0]):]
+		}
+		expression, actions, hasActions := strings.Cut(expression, "=>")
+		if hasActions {
+			for _, action := range strings.Split(actions, ",") {
+				rule.Actions = append(rule.Actions, Action(strings.TrimSpace(action)))
+			}
+		}
+		p := &ruleParser{tokens: tokenizeRule(expression)}
+		when, err := p.parseExpression()
+		if err == nil && p.pos < len(p.tokens) {
+			err = fmt.Errorf("unexpected %q", p.tokens[p.pos])
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid trigger rule %q: %w", text, err)
+		}
+		rule.When = when
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+// tokenizeRule splits an expression into operators, parentheses and words (metrics, values and keywords)
+func tokenizeRule(expression string) []string {
+	tokens := []string{}
+	for i := 0; i < len(expression); {
+		switch c := expression[i]; {
+		case c == ' ' || c == '\t' || c == '\n':
+			i++
+		case c == '(' || c == ')':
+			tokens = append(tokens, string(c))
+			i++
+		case strings.HasPrefix(expression[i:], "&&") || strings.HasPrefix(expression[i:], "||") ||
+			strings.HasPrefix(expression[i:], ">=") || strings.HasPrefix(expression[i:], "<="):
+			tokens = append(tokens, expression[i:i+2])
+			i += 2
+		case c == '>' || c == '<':
+			tokens = append(tokens, string(c))
+			i++
+		default:
+			end := i
+			for end < len(expression) && !strings.ContainsRune(" \t\n()<>&|", rune(expression[end])) {
+				end++
+			}
+			if end == i {
+				// A single '&' or '|'
+				end++
+			}
+			tokens = append(tokens, expression[i:end])
+			i = end
+		}
+	}
+	return tokens
+}
+
+// ruleParser parses the expression syntax of the trigger rules:
+//
+//	expression = or [ "for" <n> [ "ticks" ] ]
+//	or         = and { ( "||" | "OR" ) and }
+//	and        = operand { ( "&&" | "AND" ) operand }
+//	operand    = "(" expression ")" | <metric> ( ">" | ">=" | "<" | "<=" ) <value>
+type ruleParser struct {
+	tokens []string
+	pos    int
+}
+
+func (p *ruleParser) peek() string {
+	if p.pos < len(p.tokens) {
+		return p.tokens[p.pos]
+	}
+	return ""
+}
+
+func (p *ruleParser) next() string {
+	token := p.peek()
+	p.pos++
+	return token
+}
+
+func (p *ruleParser) parseExpression() (Condition, error) {
+	c, err := p.parseOr()
+	if err != nil || !strings.EqualFold(p.peek(), "for") {
+		return c, err
+	}
+	p.next()
+	ticks, err := strconv.ParseUint(p.next(), 10, 64)
+	if err != nil || ticks == 0 {
+		return c, fmt.Errorf("expected a number of ticks after for")
+	}
+	if token := strings.ToLower(p.peek()); token == "tick" || token == "ticks" {
+		p.next()
+	}
+	if c.ForTicks > 1 {
+		// Both the inner and the outer condition have to last
+		c = Condition{All: []Condition{c}}
+	}
+	c.ForTicks = ticks
+	return c, nil
+}
+
+func (p *ruleParser) parseOr() (Condition, error) {
+	return p.parseList(p.parseAnd, "||", "OR", func(conditions []Condition) Condition {
+		return Condition{Any: conditions}
+	})
+}
+
+func (p *ruleParser) parseAnd() (Condition, error) {
+	return p.parseList(p.parseOperand, "&&", "AND", func(conditions []Condition) Condition {
+		return Condition{All: conditions}
+	})
+}
+
+// parseList parses operands separated by an operator and combines them when there are several
+func (p *ruleParser) parseList(operand func() (Condition, error), operator string, keyword string, combine func([]Condition) Condition) (Condition, error) {
+	first, err := operand()
+	if err != nil {
+		return first, err
+	}
+	conditions := []Condition{first}
+	for p.peek() == operator || strings.EqualFold(p.peek(), keyword) {
+		p.next()
+		c, err := operand()
+		if err != nil {
+			return c, err
+		}
+		conditions = append(conditions, c)
+	}
+	if len(conditions) == 1 {
+		return first, nil
+	}
+	return combine(conditions), nil
+}
+
+func (p *ruleParser) parseOperand() (Condition, error) {
+	if p.peek() == "(" {
+		p.next()
+		c, err := p.parseExpression()
+		if err != nil {
+			return c, err
+		}
+		if p.next() != ")" {
+			return c, fmt.Errorf("missing closing parenthesis")
+		}
+		return c, nil
+	}
+	metric := p.next()
+	switch metric {
+	case "", "(", ")", ">", ">=", "<", "<=", "&&", "||":
+		return Condition{}, fmt.Errorf("expected a metric, got %q", metric)
+	}
+	op := p.next()
+	switch op {
+	case ">", ">=", "<", "<=":
+	default:
+		return Condition{}, fmt.Errorf("expected >, >=, < or <= after %s, got %q", metric, op)
+	}
+	value, err := parseRuleValue(p.next())
+	if err != nil {
+		return Condition{}, err
+	}
+	return Condition{Metric: metric, Op: op, Value: value}, nil
+}
+
+// parseRuleValue parses a number with an optional size or count unit, or a percentage
+func parseRuleValue(value string) (float64, error) {
+	if strings.HasSuffix(value, "%") {
+		n, err := strconv.ParseFloat(strings.TrimSuffix(value, "%"), 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid value %q: expected a number such as 80%%", value)
+		}
+		return n / 100, nil
+	}
+	number, unit := splitNumber(value)
+	multiplier, ok := sizeUnits[strings.ToLower(unit)]
+	n, err := strconv.ParseFloat(number, 64)
+	if !ok || err != nil {
+		return 0, fmt.Errorf("invalid value %q: expected a number with an optional unit such as 1GiB, 5k or 80%%", value)
+	}
+	return n * multiplier, nil
+}
@@ -0,0 +1,152 @@
+package godump
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseTriggerRules(t *testing.T) {
+	rules, err := parseTriggerRules("heap > 1GiB AND goroutines >= 5k for 3 ticks => heap_dump, cpu_profile; pressure: heap_percentage > 80% || (gc_fraction > 0.3 && /sched/gomaxprocs:threads < 2)")
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	expected := []TriggerRule{
+		{
+			When: Condition{All: []Condition{
+				{Metric: "heap", Op: ">", Value: 1 << 30},
+				{Metric: "goroutines", Op: ">=", Value: 5000},
+			}, ForTicks: 3},
+			Actions: []Action{ActionHeapDump, ActionCPUProfile},
+		},
+		{
+			Name: "pressure",
+			When: Condition{Any: []Condition{
+				{Metric: "heap_percentage", Op: ">", Value: 0.8},
+				{All: []Condition{
+					{Metric: "gc_fraction", Op: ">", Value: 0.3},
+					{Metric: "/sched/gomaxprocs:threads", Op: "<", Value: 2},
+				}},
+			}},
+		},
+	}
+	if !reflect.DeepEqual(rules, expected) {
+		t.Fatalf("Error: Expected %+v, got %+v", expected, rules)
+	}
+	for _, rule := range rules {
+		again, err := parseTriggerRules(rule.When.String())
+		if err != nil || len(again) != 1 || !reflect.DeepEqual(again[0].When, rule.When) {
+			t.Errorf("Error: Expected %q to parse back to the same condition, got %+v, %v", rule.When.String(), again, err)
+		}
+	}
+
+	for _, text := range []string{"heap >", "heap > 1 ||", "(heap > 1", "heap ~ 1", "heap > 1 for x", "heap > 1GiX", "heap > 1 goroutines"} {
+		if _, err := parseTriggerRules(text); err == nil {
+			t.Errorf("Error: Expected an error for %q", text)
+		}
+	}
+}
+
+func TestTriggerRuleSustained(t *testing.T) {
+	trigger := newRuleTrigger(Condition{All: []Condition{
+		{Metric: "heap", Op: ">", Value: 100},
+		{Metric: "goroutines", Op: ">", Value: 10},
+	}, ForTicks: 3})
+	fired := []bool{}
+	for _, sample := range []Sample{
+		{HeapBytes: 200, Goroutines: 20},
+		{HeapBytes: 200, Goroutines: 20},
+		{HeapBytes: 200, Goroutines: 5}, // the streak is broken
+		{HeapBytes: 200, Goroutines: 20},
+		{HeapBytes: 200, Goroutines: 20},
+		{HeapBytes: 200, Goroutines: 20},
+		{HeapBytes: 200, Goroutines: 20},
+	} {
+		ok, reason := trigger.Evaluate(sample)
+		fired = append(fired, ok)
+		if ok && reason != "heap > 100 && goroutines > 10 for 3 (goroutines=20, heap=200)" {
+			t.Errorf("Error: Unexpected reason %q", reason)
+		}
+	}
+	if !reflect.DeepEqual(fired, []bool{false, false, false, false, false, true, true}) {
+		t.Errorf("Error: Expected the rule to fire on the third sample in a row, got %v", fired)
+	}
+}
+
+func TestTriggerRuleGCFraction(t *testing.T) {
+	trigger := newRuleTrigger(Condition{Any: []Condition{
+		{Metric: "heap_percentage", Op: ">", Value: 0.8},
+		{Metric: "gc_fraction", Op: ">", Value: 0.3},
+	}})
+	sample := func(gc, total float64, heap uint64) Sample {
+		return Sample{HeapBytes: heap, AvailableSystemMemory: 1000, metrics: map[string]float64{MetricGCCPU: gc, MetricTotalCPU: total}}
+	}
+	if fired, _ := trigger.Evaluate(sample(0, 10, 100)); fired {
+		t.Errorf("Error: Expected the first sample not to fire, the GC fraction is a rate")
+	}
+	if fired, _ := trigger.Evaluate(sample(1, 20, 100)); fired {
+		t.Errorf("Error: Expected a 10%% GC fraction not to fire")
+	}
+	if fired, reason := trigger.Evaluate(sample(6, 30, 100)); !fired || !strings.Contains(reason, "gc_fraction=0.5") {
+		t.Errorf("Error: Expected a 50%% GC fraction to fire, got %q", reason)
+	}
+	if fired, _ := trigger.Evaluate(sample(6, 40, 900)); !fired {
+		t.Errorf("Error: Expected a 90%% heap to fire")
+	}
+}
+
+func TestTriggerRulesValidate(t *testing.T) {
+	configs := &GoDumpConfigs{GoDumpPath: t.TempDir(), WatchdogIntervalMs: 1000, TriggerRules: []TriggerRule{
+		{When: Condition{Metric: "queue", Op: ">", Value: 1}},
+		{When: Condition{Metric: "heap", Op: "!=", Value: 1}},
+		{When: Condition{Metric: "heap", Op: ">", Value: 1, All: []Condition{{Metric: "heap", Op: ">", Value: 1}}}},
+		{Name: "twice", When: Condition{Metric: "heap", Op: ">", Value: 1}},
+		{Name: "twice", When: Condition{Metric: "goroutines", Op: ">", Value: 1}, Actions: []Action{"email"}},
+		{Name: WatchdogGoroutines, When: Condition{Metric: "goroutines", Op: ">", Value: 1}},
+	}}
+	err := configs.Validate()
+	for _, field := range []string{"TriggerRules[0].When.Metric", "TriggerRules[1].When.Op", "TriggerRules[2].When", "TriggerRules[4].Name", "TriggerRules[4].Actions[0]", "TriggerRules[5].Name"} {
+		found := false
+		for _, e := range err.(interface{ Unwrap() []error }).Unwrap() {
+			var configErr *ConfigError
+			if errors.As(e, &configErr) && configErr.Field == field {
+				found = true
+			}
+		}
+		if !found {
+			t.Errorf("Error: Expected an error for %s, got %v", field, err)
+		}
+	}
+	if _, err := NewRuleTrigger(Condition{Metric: "queue", Op: ">"}); err == nil {
+		t.Errorf("Error: Expected an error for an unknown metric")
+	}
+}
+
+func TestTriggerRulesWatchdog(t *testing.T) {
+	configs := &GoDumpConfigs{GoDumpPath: t.TempDir(), WatchdogIntervalMs: 1000, TriggerRules: []TriggerRule{
+		{Name: "many-goroutines", When: Condition{Metric: "goroutines", Op: ">", Value: 10, ForTicks: 2}},
+	}}
+	gds, err := NewGoDumpService(configs)
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	var received []Event
+	gds.OnEvent(func(e Event) { received = append(received, e) })
+	w := &triggerRulesWatchdog{}
+	w.check(gds, configs, &Sample{Time: time.Now(), Goroutines: 20})
+	if len(received) != 0 {
+		t.Fatalf("Error: Expected no event before the rule is sustained, got %+v", received)
+	}
+	// A new configuration with the same rule keeps its state
+	reloaded := *configs
+	w.check(gds, &reloaded, &Sample{Time: time.Now(), Goroutines: 20})
+	if len(received) != 2 || received[0].Type != EventThresholdCrossed || received[0].Watchdog != "many-goroutines" ||
+		received[0].Detail != "goroutines > 10 for 2 (goroutines=20)" || received[1].Type != EventDumpWritten {
+		t.Fatalf("Error: Expected the rule to fire with a goroutine dump, got %+v", received)
+	}
+	if names := enabledWatchdogs(configs); names[len(names)-1] != WatchdogTriggerRules {
+		t.Errorf("Error: Expected the trigger rules watchdog to be enabled, got %v", names)
+	}
+}
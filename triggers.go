@@ -0,0 +1,204 @@
+package godump
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+/* Custom triggers
+ The built-in watchdogs only know the runtime, a Trigger brings a condition of the application (queue depth, cache size...)
+ into the same dump pipeline:
+	err := gds.RegisterTrigger("queue-depth", godump.TriggerFunc(func(sample godump.Sample) (bool, string) {
+		depth := queue.Len()
+		return depth > 10000, fmt.Sprintf("%d messages waiting", depth)
+	}), godump.ActionGoroutineDump, godump.ActionHeapDump)
+ The triggers are evaluated by the sampler on every sample after the watchdogs, they keep the sampler running even when no
+ watchdog is enabled. A trigger behaves like a built-in watchdog named after it:
+	- Its actions run on every sample it fires, the goroutine dump carries the reason
+	- The events carry the trigger name as Watchdog and the reason as Detail, Value is 1 while it fires and Threshold is 0
+*/
+
+// Trigger is a condition evaluated on every sample, reason says why it fired and is written in the events, logs and goroutine dumps
+type Trigger interface {
+	Evaluate(sample Sample) (fired bool, reason string)
+}
+
+// TriggerFunc is a function used as a Trigger
+type TriggerFunc func(sample Sample) (fired bool, reason string)
+
+func (f TriggerFunc) Evaluate(sample Sample) (bool, string) {
+	return f(sample)
+}
+
+// Action is what the service does when a trigger fires
+type Action string
+
+const (
+	ActionGoroutineSummary Action = "goroutine_summary" // the goroutine count and the biggest groups of goroutines, without their stacks
+	ActionGoroutineDump    Action = "goroutine_dump"    // a goroutine dump with the reason, like WithGoroutineDumpPrefix names it
+	ActionHeapDump         Action = "heap_dump"         // a heap dump, like WithHeapDumpPrefix names it
+	ActionCPUProfile       Action = "cpu_profile"       // a CPU profile in the background, like the CPU watchdog takes it
+)
+
+// actionNames lists the actions in the error messages
+const actionNames = "goroutine_summary, goroutine_dump, heap_dump or cpu_profile"
+
+// DefaultTriggerActions returns the actions of a trigger registered without any, a new slice on every call
+func DefaultTriggerActions() []Action {
+	return []Action{ActionGoroutineDump}
+}
+
+func (a Action) valid() bool {
+	switch a {
+	case ActionGoroutineSummary, ActionGoroutineDump, ActionHeapDump, ActionCPUProfile:
+		return true
+	}
+	return false
+}
+
+// watchdogSignals are the names reported in the events besides the names of the built-in watchdogs, one per signal a watchdog watches
+var watchdogSignals = []string{
+	WatchdogGCCPUFraction, WatchdogGCCycles, WatchdogGCPauseP99,
+	WatchdogSchedLatency, WatchdogTickerLag,
+	WatchdogThreads, WatchdogThreadGrowth, WatchdogThreadCreate, WatchdogFDs, WatchdogFDGrowth,
+	WatchdogMutexWait, WatchdogBlockWait,
+	WatchdogHeartbeat, WatchdogOperationBudget,
+}
+
+// reservedWatchdogName returns whether the name is used by a built-in watchdog or one of its signals in the events
+func reservedWatchdogName(name string) bool {
+	for _, builtin := range builtinWatchdogs {
+		if builtin.name == name {
+			return true
+		}
+	}
+	for _, signal := range watchdogSignals {
+		if signal == name {
+			return true
+		}
+	}
+	return false
+}
+
+// registeredTrigger is a trigger with the state the sampler keeps for it
+type registeredTrigger struct {
+	name    string
+	trigger Trigger
+	actions []Action
+	above   bool // only used by the sampler
+}
+
+// triggerRegistry holds the triggers of a service, it is shared by every copy of the service
+type triggerRegistry struct {
+	mu     sync.Mutex
+	byName map[string]*registeredTrigger
+}
+
+// RegisterTrigger evaluates the trigger on every sample and runs the actions when it fires, DefaultTriggerActions when none is given
+// registering a name again replaces the previous trigger
+func (gd *GoDumpService) RegisterTrigger(name string, trigger Trigger, actions ...Action) error {
+	if name == "" {
+		return fmt.Errorf("the trigger name must not be empty")
+	}
+	if trigger == nil {
+		return fmt.Errorf("the trigger %q must not be nil", name)
+	}
+	if reservedWatchdogName(name) {
+		return fmt.Errorf("the trigger name %q is the name of a built-in watchdog", name)
+	}
+	for _, action := range actions {
+		if !action.valid() {
+			return fmt.Errorf("the trigger %q has an unknown action %q, expected %s", name, action, actionNames)
+		}
+	}
+	if len(actions) == 0 {
+		actions = DefaultTriggerActions()
+	}
+	t := &registeredTrigger{name: name, trigger: trigger, actions: append([]Action(nil), actions...)}
+	gd.state.mu.Lock()
+	defer gd.state.mu.Unlock()
+	gd.triggers.mu.Lock()
+	if gd.triggers.byName == nil {
+		gd.triggers.byName = map[string]*registeredTrigger{}
+	}
+	gd.triggers.byName[name] = t
+	gd.triggers.mu.Unlock()
+	gd.updateSampler()
+	return nil
+}
+
+// UnregisterTrigger stops evaluating a trigger, it returns false when no trigger has the name
+func (gd *GoDumpService) UnregisterTrigger(name string) bool {
+	gd.state.mu.Lock()
+	defer gd.state.mu.Unlock()
+	gd.triggers.mu.Lock()
+	_, ok := gd.triggers.byName[name]
+	delete(gd.triggers.byName, name)
+	gd.triggers.mu.Unlock()
+	gd.updateSampler()
+	return ok
+}
+
+// list returns the triggers sorted by name
+func (r *triggerRegistry) list() []*registeredTrigger {
+	if r == nil {
+		return nil
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	triggers := make([]*registeredTrigger, 0, len(r.byName))
+	for _, t := range r.byName {
+		triggers = append(triggers, t)
+	}
+	sort.Slice(triggers, func(i, j int) bool { return triggers[i].name < triggers[j].name })
+	return triggers
+}
+
+func (r *triggerRegistry) count() int {
+	if r == nil {
+		return 0
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.byName)
+}
+
+// check evaluates every trigger and runs the actions of the ones that fired, it runs on the sampler after the watchdogs
+func (r *triggerRegistry) check(gd *GoDumpService, configs *GoDumpConfigs, sample *Sample) {
+	for _, t := range r.list() {
+		gd.checkTrigger(t, configs, sample)
+	}
+}
+
+// checkTrigger evaluates a trigger and runs its actions when it fired
+func (gd *GoDumpService) checkTrigger(t *registeredTrigger, configs *GoDumpConfigs, sample *Sample) {
+	fired, reason := t.trigger.Evaluate(*sample)
+	value := 0.0
+	if fired {
+		value = 1
+	}
+	if gd.checkDetailThreshold(t.name, reason, &t.above, value, 0) {
+		gd.runActions(t.name, reason, configs, t.actions)
+	}
+}
+
+// runActions runs the actions of a trigger that fired
+func (gd *GoDumpService) runActions(watchdog string, reason string, configs *GoDumpConfigs, actions []Action) {
+	for _, action := range actions {
+		switch action {
+		case ActionGoroutineSummary:
+			file, err := writeGoroutineSummary(configs, watchdog+": "+reason)
+			gd.emitDump(watchdog, file, err)
+		case ActionGoroutineDump:
+			section := dumpSection{title: "Trigger", lines: []string{watchdog + ": " + reason}}
+			file, err := writeGoroutineDump(configs, nil, section)
+			gd.emitDump(watchdog, file, err)
+		case ActionHeapDump:
+			file, err := writeHeapDump(configs)
+			gd.emitDump(watchdog, file, err)
+		case ActionCPUProfile:
+			gd.startCPUProfile(watchdog, configs)
+		}
+	}
+}
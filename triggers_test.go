@@ -0,0 +1,116 @@
+package godump
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRegisterTrigger(t *testing.T) {
+	gds, err := NewGoDumpService(&GoDumpConfigs{GoDumpPath: t.TempDir(), WatchdogIntervalMs: 1000})
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	var received []Event
+	gds.OnEvent(func(e Event) { received = append(received, e) })
+	depth := 10
+	err = gds.RegisterTrigger("queue-depth", TriggerFunc(func(sample Sample) (bool, string) {
+		return depth > 100, fmt.Sprintf("%d messages waiting", depth)
+	}), ActionGoroutineDump, ActionHeapDump)
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+
+	gds.triggers.check(gds, gds.config(), &Sample{Time: time.Now()})
+	if len(received) != 0 {
+		t.Fatalf("Error: Expected no event while the trigger does not fire, got %+v", received)
+	}
+	depth = 500
+	gds.triggers.check(gds, gds.config(), &Sample{Time: time.Now()})
+	if len(received) != 3 || received[0].Type != EventThresholdCrossed || received[0].Watchdog != "queue-depth" ||
+		received[0].Detail != "500 messages waiting" || received[1].Type != EventDumpWritten || received[2].Type != EventDumpWritten {
+		t.Fatalf("Error: Expected the trigger to fire with a goroutine and a heap dump, got %+v", received)
+	}
+	dump, err := os.ReadFile(received[1].File)
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	if !strings.Contains(string(dump), "Trigger:\nqueue-depth: 500 messages waiting") {
+		t.Errorf("Error: Expected the reason in the goroutine dump, got %s", dump)
+	}
+
+	received = nil
+	depth = 10
+	gds.triggers.check(gds, gds.config(), &Sample{Time: time.Now()})
+	if len(received) != 1 || received[0].Type != EventThresholdRecovered || received[0].Watchdog != "queue-depth" {
+		t.Errorf("Error: Expected the trigger to recover, got %+v", received)
+	}
+	if !gds.UnregisterTrigger("queue-depth") || gds.UnregisterTrigger("queue-depth") || gds.triggers.count() != 0 {
+		t.Errorf("Error: Expected the trigger to be unregistered once")
+	}
+}
+
+func TestRegisterTriggerErrors(t *testing.T) {
+	gds, err := NewGoDumpService(&GoDumpConfigs{GoDumpPath: t.TempDir(), WatchdogIntervalMs: 1000})
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	never := TriggerFunc(func(sample Sample) (bool, string) { return false, "" })
+	if err := gds.RegisterTrigger("", never); err == nil {
+		t.Errorf("Error: Expected an error for an empty name")
+	}
+	if err := gds.RegisterTrigger("nil", nil); err == nil {
+		t.Errorf("Error: Expected an error for a nil trigger")
+	}
+	for _, name := range []string{
+		WatchdogHeapBytes, WatchdogHeapPercentage, WatchdogGoroutines, WatchdogGoroutinesHanging, WatchdogGoroutineGrowth,
+		WatchdogGoroutineRules, WatchdogGoroutineStall, WatchdogGCPressure, WatchdogGCCPUFraction, WatchdogGCCycles, WatchdogGCPauseP99,
+		WatchdogScheduler, WatchdogSchedLatency, WatchdogTickerLag, WatchdogOSResources, WatchdogThreads, WatchdogThreadGrowth,
+		WatchdogThreadCreate, WatchdogFDs, WatchdogFDGrowth, WatchdogProcessCPU, WatchdogNativeMemory, WatchdogContention,
+		WatchdogMutexWait, WatchdogBlockWait, WatchdogTriggerRules, WatchdogHeartbeat, WatchdogOperationBudget,
+	} {
+		if err := gds.RegisterTrigger(name, never); err == nil {
+			t.Errorf("Error: Expected an error for %q, the name of a built-in watchdog", name)
+		}
+	}
+	if err := gds.RegisterTrigger("unknown", never, Action("email")); err == nil {
+		t.Errorf("Error: Expected an error for an unknown action")
+	}
+	if err := gds.RegisterTrigger("default", never); err != nil || len(gds.triggers.list()[0].actions) != 1 || gds.triggers.list()[0].actions[0] != ActionGoroutineDump {
+		t.Errorf("Error: Expected the default actions, got %v", err)
+	}
+}
+
+func TestTriggerStartsSampler(t *testing.T) {
+	gds, err := NewGoDumpService(&GoDumpConfigs{GoDumpPath: t.TempDir(), WatchdogIntervalMs: 50})
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	events := gds.Subscribe()
+	stop := make(chan bool)
+	wg := sync.WaitGroup{}
+	if err := gds.Start(stop, &wg); err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	defer func() {
+		close(stop)
+		wg.Wait()
+	}()
+	err = gds.RegisterTrigger("goroutines-seen", TriggerFunc(func(sample Sample) (bool, string) {
+		return sample.Goroutines > 0, fmt.Sprintf("%d goroutines", sample.Goroutines)
+	}))
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	select {
+	case e := <-events:
+		if e.Type != EventThresholdCrossed || e.Watchdog != "goroutines-seen" {
+			t.Errorf("Error: Expected the trigger to fire, got %+v", e)
+		}
+	case <-time.After(5 * time.Second):
+		t.Errorf("Error: Expected the sampler to evaluate the trigger")
+	}
+}
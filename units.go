@@ -0,0 +1,148 @@
+package godump
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+/* Human readable values used by the configuration loaders
+- Sizes: "512MiB", "1.5GB", "4096" (bytes), decimal units are powers of 1000 and binary units powers of 1024
+- Percentages: "80%" or "0.8"
+- Durations: anything time.ParseDuration accepts, "90s", "1m30s", "500ms"
+- Counts: "5000", "5k", "2M"
+- Booleans: "1", "true", "yes", "on" and "0", "false", "no", "off"
+*/
+
+var sizeUnits = map[string]float64{
+	"":    1,
+	"b":   1,
+	"k":   1000,
+	"kb":  1000,
+	"kib": 1 << 10,
+	"m":   1000 * 1000,
+	"mb":  1000 * 1000,
+	"mib": 1 << 20,
+	"g":   1000 * 1000 * 1000,
+	"gb":  1000 * 1000 * 1000,
+	"gib": 1 << 30,
+	"t":   1000 * 1000 * 1000 * 1000,
+	"tb":  1000 * 1000 * 1000 * 1000,
+	"tib": 1 << 40,
+}
+
+// maxUint64Float is 2^64, the first float64 that does not fit in a uint64, float64(math.MaxUint64) rounds up to it
+const maxUint64Float float64 = 1 << 64
+
+// splitNumber splits "512MiB" into "512" and "MiB"
+func splitNumber(value string) (string, string) {
+	i := 0
+	for i < len(value) && (value[i] >= '0' && value[i] <= '9' || value[i] == '.') {
+		i++
+	}
+	return value[:i], strings.TrimSpace(value[i:])
+}
+
+// parseSize parses a human readable size into bytes
+func parseSize(value string) (uint64, error) {
+	number, unit := splitNumber(strings.TrimSpace(value))
+	if number == "" {
+		return 0, fmt.Errorf("invalid size %q: expected a number followed by an optional unit such as 512MiB", value)
+	}
+	multiplier, ok := sizeUnits[strings.ToLower(unit)]
+	if !ok {
+		return 0, fmt.Errorf("invalid size %q: unknown unit %q (use B, KB, KiB, MB, MiB, GB, GiB, TB or TiB)", value, unit)
+	}
+	n, err := strconv.ParseFloat(number, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid size %q: %q is not a number", value, number)
+	}
+	bytes := n * multiplier
+	if bytes >= maxUint64Float {
+		return 0, fmt.Errorf("invalid size %q: value overflows uint64", value)
+	}
+	return uint64(bytes), nil
+}
+
+// parseCount parses a number with an optional k (thousands) or M (millions) suffix
+func parseCount(value string) (uint64, error) {
+	number, unit := splitNumber(strings.TrimSpace(value))
+	multiplier := 1.0
+	switch unit {
+	case "":
+	case "k", "K":
+		multiplier = 1000
+	case "m", "M":
+		multiplier = 1000 * 1000
+	default:
+		return 0, fmt.Errorf("invalid count %q: unknown suffix %q (use k or M)", value, unit)
+	}
+	n, err := strconv.ParseFloat(number, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid count %q: %q is not a number", value, number)
+	}
+	count := n * multiplier
+	if count >= maxUint64Float {
+		return 0, fmt.Errorf("invalid count %q: value overflows uint64", value)
+	}
+	return uint64(count), nil
+}
+
+// parsePercentage parses "80%" or "0.8" into a fraction between 0 and 1
+func parsePercentage(value string) (float64, error) {
+	trimmed := strings.TrimSpace(value)
+	if strings.HasSuffix(trimmed, "%") {
+		n, err := strconv.ParseFloat(strings.TrimSpace(strings.TrimSuffix(trimmed, "%")), 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid percentage %q: expected a number such as 80%%", value)
+		}
+		if n < 0 || n > 100 {
+			return 0, fmt.Errorf("invalid percentage %q: must be between 0%% and 100%%", value)
+		}
+		return n / 100, nil
+	}
+	n, err := strconv.ParseFloat(trimmed, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid percentage %q: expected 80%% or a fraction such as 0.8", value)
+	}
+	if n < 0 || n > 1 {
+		return 0, fmt.Errorf("invalid percentage %q: a fraction must be between 0 and 1, write 80%% for eighty percent", value)
+	}
+	return n, nil
+}
+
+// parseDuration parses a positive duration such as "90s"
+func parseDuration(value string) (time.Duration, error) {
+	d, err := time.ParseDuration(strings.TrimSpace(value))
+	if err != nil {
+		return 0, fmt.Errorf("invalid duration %q: expected a number with a unit such as 500ms, 90s or 5m", value)
+	}
+	if d < 0 {
+		return 0, fmt.Errorf("invalid duration %q: cannot be negative", value)
+	}
+	return d, nil
+}
+
+// parseDurationMs parses a duration such as "90s" into milliseconds, a duration under 1ms would be 0 and turn the setting off
+func parseDurationMs(value string) (uint64, error) {
+	d, err := parseDuration(value)
+	if err != nil {
+		return 0, err
+	}
+	if d > 0 && d < time.Millisecond {
+		return 0, fmt.Errorf("invalid duration %q: must be 0 or at least 1ms", value)
+	}
+	return uint64(d / time.Millisecond), nil
+}
+
+// parseBool parses the usual spellings of a boolean flag
+func parseBool(value string) (bool, error) {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "1", "t", "true", "y", "yes", "on":
+		return true, nil
+	case "0", "f", "false", "n", "no", "off", "":
+		return false, nil
+	}
+	return false, fmt.Errorf("invalid boolean %q: expected true/false, 1/0, yes/no or on/off", value)
+}
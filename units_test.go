@@ -0,0 +1,104 @@
+package godump
+
+import (
+	"testing"
+)
+
+func TestParseSize(t *testing.T) {
+	testCases := []struct {
+		value    string
+		expected uint64
+		fails    bool
+	}{
+		{value: "4096", expected: 4096},
+		{value: "512MiB", expected: 512 * 1024 * 1024},
+		{value: "512 mib", expected: 512 * 1024 * 1024},
+		{value: "1.5GB", expected: 1500 * 1000 * 1000},
+		{value: "2k", expected: 2000},
+		{value: "10XB", fails: true},
+		{value: "MiB", fails: true},
+		{value: "1.2.3MB", fails: true},
+		{value: "16777215TiB", expected: 16777215 << 40},
+		{value: "16777216TiB", fails: true},
+		{value: "18446744073709551616", fails: true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.value, func(t *testing.T) {
+			got, err := parseSize(tc.value)
+			if tc.fails {
+				if err == nil {
+					t.Errorf("Error: Expected error, got %v", got)
+				}
+				return
+			}
+			if err != nil || got != tc.expected {
+				t.Errorf("Error: Expected %v, got %v (%v)", tc.expected, got, err)
+			}
+		})
+	}
+}
+
+func TestParseCount(t *testing.T) {
+	testCases := []struct {
+		value    string
+		expected uint64
+		fails    bool
+	}{
+		{value: "50", expected: 50},
+		{value: "5k", expected: 5000},
+		{value: "1.5M", expected: 1500000},
+		{value: "18446744073709549568", expected: 18446744073709549568},
+		{value: "18446744073709551616", fails: true},
+		{value: "99999999999999999999k", fails: true},
+		{value: "5G", fails: true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.value, func(t *testing.T) {
+			got, err := parseCount(tc.value)
+			if tc.fails {
+				if err == nil {
+					t.Errorf("Error: Expected error, got %v", got)
+				}
+				return
+			}
+			if err != nil || got != tc.expected {
+				t.Errorf("Error: Expected %v, got %v (%v)", tc.expected, got, err)
+			}
+		})
+	}
+}
+
+func TestParsePercentageDurationCountBool(t *testing.T) {
+	if got, err := parsePercentage("80%"); err != nil || got != 0.8 {
+		t.Errorf("Error: Expected 0.8, got %v (%v)", got, err)
+	}
+	if got, err := parsePercentage("0.25"); err != nil || got != 0.25 {
+		t.Errorf("Error: Expected 0.25, got %v (%v)", got, err)
+	}
+	for _, bad := range []string{"80", "120%", "eighty"} {
+		if _, err := parsePercentage(bad); err == nil {
+			t.Errorf("Error: Expected error for %q", bad)
+		}
+	}
+	if got, err := parseDurationMs("1m30s"); err != nil || got != 90000 {
+		t.Errorf("Error: Expected 90000, got %v (%v)", got, err)
+	}
+	if _, err := parseDurationMs("90"); err == nil {
+		t.Errorf("Error: Expected error for a duration without unit")
+	}
+	if _, err := parseDurationMs("500us"); err == nil {
+		t.Errorf("Error: Expected error for a duration under 1ms")
+	}
+	if got, err := parseDurationMs("0s"); err != nil || got != 0 {
+		t.Errorf("Error: Expected 0, got %v (%v)", got, err)
+	}
+	if got, err := parseCount("5k"); err != nil || got != 5000 {
+		t.Errorf("Error: Expected 5000, got %v (%v)", got, err)
+	}
+	if got, err := parseBool("on"); err != nil || !got {
+		t.Errorf("Error: Expected true, got %v (%v)", got, err)
+	}
+	if _, err := parseBool("maybe"); err == nil {
+		t.Errorf("Error: Expected error for maybe")
+	}
+}
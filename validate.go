@@ -0,0 +1,250 @@
+package godump
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+/* Validation
+ Validate reports every problem of a configuration at once through errors.Join, each problem is a *ConfigError:
+	err := configs.Validate()
+	var configErr *godump.ConfigError
+	if errors.As(err, &configErr) {
+		// configErr.Field is the first invalid field, e.g. "HeapDumpConfigs.HeapThresholdPercentage"
+	}
+	errors.Is(err, godump.ErrInvalidConfig) // true for any validation problem
+*/
+
+var (
+	// ErrInvalidConfig matches every *ConfigError with errors.Is
+	ErrInvalidConfig = errors.New("invalid godump configuration")
+	// ErrNilConfig is returned when the configuration itself is nil
+	ErrNilConfig = fmt.Errorf("configs cannot be nil: %w", ErrInvalidConfig)
+)
+
+// ConfigError describes one invalid field of a GoDumpConfigs
+type ConfigError struct {
+	Field  string // path of the field from GoDumpConfigs, e.g. "GoroutineDumpConfigs.GoroutineHangingTimeMs"
+	Reason string
+}
+
+func (e *ConfigError) Error() string {
+	return fmt.Sprintf("the variable '%s' %s", e.Field, e.Reason)
+}
+
+func (e *ConfigError) Is(target error) bool {
+	return target == ErrInvalidConfig
+}
+
+// Validate checks the configuration and returns all the problems joined, or nil when it can be used by the service
+func (configs *GoDumpConfigs) Validate() error {
+	if configs == nil {
+		return ErrNilConfig
+	}
+	var errs []error
+	invalid := func(field string, reason string, args ...any) {
+		errs = append(errs, &ConfigError{Field: field, Reason: fmt.Sprintf(reason, args...)})
+	}
+	if configs.GoDumpHeap && configs.HeapDumpConfigs == nil {
+		invalid("HeapDumpConfigs", "cannot be nil when GoDumpHeap is true")
+	}
+	if configs.GoDumpGoroutine && configs.GoroutineDumpConfigs == nil {
+		invalid("GoroutineDumpConfigs", "cannot be nil when GoDumpGoroutine is true")
+	}
+	if configs.GoDumpHeap && configs.HeapDumpConfigs != nil {
+		heap := configs.HeapDumpConfigs
+		if heap.HeapThresholdBytes == 0 && heap.HeapThresholdPercentage == 0 && heap.HeapBytesTiers == nil && heap.HeapPercentageTiers == nil {
+			invalid("HeapDumpConfigs.HeapThresholdBytes", "'HeapThresholdPercentage', 'HeapBytesTiers' and 'HeapPercentageTiers' cannot be all 0 or nil")
+		}
+		if heap.HeapBytesTiers != nil {
+			heap.HeapBytesTiers.validate(invalid, "HeapDumpConfigs.HeapBytesTiers", 0)
+		}
+		if heap.HeapPercentageTiers != nil {
+			heap.HeapPercentageTiers.validate(invalid, "HeapDumpConfigs.HeapPercentageTiers", 1)
+		}
+		if heap.HeapThresholdPercentage > 1 || heap.HeapThresholdPercentage < 0 {
+			invalid("HeapDumpConfigs.HeapThresholdPercentage", "cannot be greater than 1 or less than 0, got %v", heap.HeapThresholdPercentage)
+		}
+		validatePrefix(invalid, "HeapDumpConfigs.HeapDumpPrefix", heap.HeapDumpPrefix)
+		if _, ok := supportedMetrics[heap.HeapMetric]; heap.HeapMetric != "" && !ok {
+			invalid("HeapDumpConfigs.HeapMetric", "must be a runtime/metrics name with a single value, got %q", heap.HeapMetric)
+		}
+	}
+	if configs.GoDumpGoroutine && configs.GoroutineDumpConfigs != nil {
+		goroutine := configs.GoroutineDumpConfigs
+		if goroutine.GoroutineThreshold == 0 && goroutine.GoroutineHangingTimeMs == 0 && len(goroutine.GoroutineHangingTimeByState) == 0 &&
+			goroutine.GoroutineGrowthWindowMs == 0 && len(goroutine.GoroutineRules) == 0 && goroutine.GoroutineStallFraction == 0 && goroutine.GoroutineTiers == nil &&
+			goroutine.GoroutineHangingTiers == nil {
+			invalid("GoroutineDumpConfigs.GoroutineThreshold", "'GoroutineTiers', 'GoroutineHangingTimeMs', 'GoroutineHangingTimeByState', 'GoroutineHangingTiers', 'GoroutineGrowthWindowMs', 'GoroutineRules' and 'GoroutineStallFraction' cannot be all 0 or empty")
+		}
+		if goroutine.GoroutineTiers != nil {
+			goroutine.GoroutineTiers.validate(invalid, "GoroutineDumpConfigs.GoroutineTiers", 0)
+		}
+		if goroutine.GoroutineHangingTiers != nil {
+			goroutine.GoroutineHangingTiers.validate(invalid, "GoroutineDumpConfigs.GoroutineHangingTiers", 0)
+			if first := goroutine.GoroutineHangingTiers.lowest(); first > 0 && first < float64(configs.WatchdogIntervalMs) {
+				invalid("GoroutineDumpConfigs.GoroutineHangingTiers", "(%vms) cannot be shorter than 'WatchdogIntervalMs' (%dms), a hang needs at least two samples",
+					first, configs.WatchdogIntervalMs)
+			}
+		}
+		if goroutine.GoroutineGrowthTiers != nil {
+			goroutine.GoroutineGrowthTiers.validate(invalid, "GoroutineDumpConfigs.GoroutineGrowthTiers", 0)
+			if goroutine.GoroutineGrowthWindowMs == 0 {
+				invalid("GoroutineDumpConfigs.GoroutineGrowthTiers", "cannot be set without 'GoroutineGrowthWindowMs'")
+			}
+		}
+		if goroutine.GoroutineStallFraction > 1 || goroutine.GoroutineStallFraction < 0 {
+			invalid("GoroutineDumpConfigs.GoroutineStallFraction", "cannot be greater than 1 or less than 0, got %v", goroutine.GoroutineStallFraction)
+		}
+		validatePrefix(invalid, "GoroutineDumpConfigs.GoroutineStallReportPrefix", goroutine.GoroutineStallReportPrefix)
+		ruleNames := map[string]bool{}
+		for i := range goroutine.GoroutineRules {
+			rule := &goroutine.GoroutineRules[i]
+			rule.validate(invalid, fmt.Sprintf("GoroutineDumpConfigs.GoroutineRules[%d]", i))
+			if ruleNames[rule.name()] {
+				invalid(fmt.Sprintf("GoroutineDumpConfigs.GoroutineRules[%d].Name", i), "must be unique, %q is used by another rule", rule.name())
+			}
+			ruleNames[rule.name()] = true
+		}
+		for i := range goroutine.HangIgnore {
+			goroutine.HangIgnore[i].validate(invalid, fmt.Sprintf("GoroutineDumpConfigs.HangIgnore[%d]", i))
+		}
+		if goroutine.GoroutineGrowthWindowMs > 0 && goroutine.GoroutineGrowthWindowMs < configs.WatchdogIntervalMs {
+			invalid("GoroutineDumpConfigs.GoroutineGrowthWindowMs", "(%dms) cannot be shorter than 'WatchdogIntervalMs' (%dms), a growth needs at least two samples",
+				goroutine.GoroutineGrowthWindowMs, configs.WatchdogIntervalMs)
+		}
+		if goroutine.GoroutineHangingTimeMs > 0 && goroutine.GoroutineHangingTimeMs < configs.WatchdogIntervalMs {
+			invalid("GoroutineDumpConfigs.GoroutineHangingTimeMs", "(%dms) cannot be shorter than 'WatchdogIntervalMs' (%dms), a hang needs at least two samples",
+				goroutine.GoroutineHangingTimeMs, configs.WatchdogIntervalMs)
+		}
+		for state, ms := range goroutine.GoroutineHangingTimeByState {
+			if state == "" {
+				invalid("GoroutineDumpConfigs.GoroutineHangingTimeByState", "cannot have an empty state")
+			}
+			if ms > 0 && ms < configs.WatchdogIntervalMs {
+				invalid(fmt.Sprintf("GoroutineDumpConfigs.GoroutineHangingTimeByState[%q]", state), "(%dms) cannot be shorter than 'WatchdogIntervalMs' (%dms), a hang needs at least two samples",
+					ms, configs.WatchdogIntervalMs)
+			}
+		}
+		validatePrefix(invalid, "GoroutineDumpConfigs.GoroutineSummaryPrefix", goroutine.GoroutineSummaryPrefix)
+		validatePrefix(invalid, "GoroutineDumpConfigs.GoroutineDumpPrefix", goroutine.GoroutineDumpPrefix)
+	}
+	if configs.GoDumpGC && configs.GCDumpConfigs == nil {
+		invalid("GCDumpConfigs", "cannot be nil when GoDumpGC is true")
+	}
+	if configs.GoDumpGC && configs.GCDumpConfigs != nil {
+		gc := configs.GCDumpConfigs
+		if gc.GCCPUFractionThreshold == 0 && gc.GCCyclesPerMinuteThreshold == 0 && gc.GCPauseP99ThresholdMs == 0 {
+			invalid("GCDumpConfigs.GCCPUFractionThreshold", "'GCCyclesPerMinuteThreshold' and 'GCPauseP99ThresholdMs' cannot be all 0")
+		}
+		if gc.GCCPUFractionThreshold > 1 || gc.GCCPUFractionThreshold < 0 {
+			invalid("GCDumpConfigs.GCCPUFractionThreshold", "cannot be greater than 1 or less than 0, got %v", gc.GCCPUFractionThreshold)
+		}
+		if gc.GCCyclesPerMinuteThreshold < 0 {
+			invalid("GCDumpConfigs.GCCyclesPerMinuteThreshold", "cannot be negative, got %v", gc.GCCyclesPerMinuteThreshold)
+		}
+		if gc.GCPauseP99ThresholdMs < 0 {
+			invalid("GCDumpConfigs.GCPauseP99ThresholdMs", "cannot be negative, got %v", gc.GCPauseP99ThresholdMs)
+		}
+		validatePrefix(invalid, "GCDumpConfigs.GCDumpPrefix", gc.GCDumpPrefix)
+	}
+	if configs.GoDumpSched && configs.SchedDumpConfigs == nil {
+		invalid("SchedDumpConfigs", "cannot be nil when GoDumpSched is true")
+	}
+	if configs.GoDumpSched && configs.SchedDumpConfigs != nil {
+		sched := configs.SchedDumpConfigs
+		if sched.SchedLatencyThresholdMs == 0 && sched.TickerLagThresholdMs == 0 {
+			invalid("SchedDumpConfigs.SchedLatencyThresholdMs", "and 'TickerLagThresholdMs' cannot be both 0")
+		}
+		if sched.SchedLatencyThresholdMs < 0 {
+			invalid("SchedDumpConfigs.SchedLatencyThresholdMs", "cannot be negative, got %v", sched.SchedLatencyThresholdMs)
+		}
+		if sched.TickerLagThresholdMs < 0 {
+			invalid("SchedDumpConfigs.TickerLagThresholdMs", "cannot be negative, got %v", sched.TickerLagThresholdMs)
+		}
+		if sched.SchedLatencyQuantile > 1 || sched.SchedLatencyQuantile < 0 {
+			invalid("SchedDumpConfigs.SchedLatencyQuantile", "cannot be greater than 1 or less than 0, got %v", sched.SchedLatencyQuantile)
+		}
+	}
+	if configs.GoDumpOS && configs.OSDumpConfigs == nil {
+		invalid("OSDumpConfigs", "cannot be nil when GoDumpOS is true")
+	}
+	if configs.GoDumpOS && configs.OSDumpConfigs != nil {
+		osConfigs := configs.OSDumpConfigs
+		if osConfigs.ThreadThreshold == 0 && osConfigs.ThreadGrowthPerMinute == 0 && osConfigs.ThreadCreateThreshold == 0 &&
+			osConfigs.FDThreshold == 0 && osConfigs.FDGrowthPerMinute == 0 {
+			invalid("OSDumpConfigs.ThreadThreshold", "'ThreadGrowthPerMinute', 'ThreadCreateThreshold', 'FDThreshold' and 'FDGrowthPerMinute' cannot be all 0")
+		}
+		if osConfigs.ThreadGrowthPerMinute < 0 {
+			invalid("OSDumpConfigs.ThreadGrowthPerMinute", "cannot be negative, got %v", osConfigs.ThreadGrowthPerMinute)
+		}
+		if osConfigs.FDGrowthPerMinute < 0 {
+			invalid("OSDumpConfigs.FDGrowthPerMinute", "cannot be negative, got %v", osConfigs.FDGrowthPerMinute)
+		}
+		if osConfigs.OSGrowthWindowMs > 0 && osConfigs.OSGrowthWindowMs < configs.WatchdogIntervalMs {
+			invalid("OSDumpConfigs.OSGrowthWindowMs", "(%dms) cannot be shorter than 'WatchdogIntervalMs' (%dms), a growth rate needs at least two samples",
+				osConfigs.OSGrowthWindowMs, configs.WatchdogIntervalMs)
+		}
+		validatePrefix(invalid, "OSDumpConfigs.OSDumpPrefix", osConfigs.OSDumpPrefix)
+	}
+	if configs.GoDumpCPU && configs.CPUDumpConfigs == nil {
+		invalid("CPUDumpConfigs", "cannot be nil when GoDumpCPU is true")
+	}
+	if configs.GoDumpCPU && configs.CPUDumpConfigs != nil {
+		cpu := configs.CPUDumpConfigs
+		if cpu.CPUThresholdPercentage <= 0 || cpu.CPUThresholdPercentage > 1 {
+			invalid("CPUDumpConfigs.CPUThresholdPercentage", "must be greater than 0 and at most 1, got %v", cpu.CPUThresholdPercentage)
+		}
+		validatePrefix(invalid, "CPUDumpConfigs.CPUProfilePrefix", cpu.CPUProfilePrefix)
+	}
+	if configs.GoDumpNativeMemory && configs.NativeMemoryDumpConfigs == nil {
+		invalid("NativeMemoryDumpConfigs", "cannot be nil when GoDumpNativeMemory is true")
+	}
+	if configs.GoDumpNativeMemory && configs.NativeMemoryDumpConfigs != nil {
+		native := configs.NativeMemoryDumpConfigs
+		if native.NativeMemoryThresholdBytes == 0 {
+			invalid("NativeMemoryDumpConfigs.NativeMemoryThresholdBytes", "cannot be 0")
+		}
+		validatePrefix(invalid, "NativeMemoryDumpConfigs.NativeMemoryDumpPrefix", native.NativeMemoryDumpPrefix)
+	}
+	if configs.GoDumpContention && configs.ContentionDumpConfigs == nil {
+		invalid("ContentionDumpConfigs", "cannot be nil when GoDumpContention is true")
+	}
+	if configs.GoDumpContention && configs.ContentionDumpConfigs != nil {
+		contention := configs.ContentionDumpConfigs
+		if contention.MutexWaitThresholdMs == 0 && contention.BlockWaitThresholdMs == 0 {
+			invalid("ContentionDumpConfigs.MutexWaitThresholdMs", "and 'BlockWaitThresholdMs' cannot be both 0")
+		}
+		if contention.MutexWaitThresholdMs < 0 {
+			invalid("ContentionDumpConfigs.MutexWaitThresholdMs", "cannot be negative, got %v", contention.MutexWaitThresholdMs)
+		}
+		if contention.BlockWaitThresholdMs < 0 {
+			invalid("ContentionDumpConfigs.BlockWaitThresholdMs", "cannot be negative, got %v", contention.BlockWaitThresholdMs)
+		}
+		validatePrefix(invalid, "ContentionDumpConfigs.ContentionDumpPrefix", contention.ContentionDumpPrefix)
+	}
+	names := map[string]bool{}
+	for i := range configs.TriggerRules {
+		rule := &configs.TriggerRules[i]
+		rule.validate(invalid, fmt.Sprintf("TriggerRules[%d]", i))
+		if names[rule.name()] {
+			invalid(fmt.Sprintf("TriggerRules[%d].Name", i), "must be unique, %q is used by another rule", rule.name())
+		}
+		names[rule.name()] = true
+	}
+	if configs.WatchdogIntervalMs == 0 {
+		invalid("WatchdogIntervalMs", "cannot be 0")
+	}
+	if configs.GoDumpPath == "" {
+		invalid("GoDumpPath", "cannot be empty")
+	}
+	return errors.Join(errs...)
+}
+
+// validatePrefix rejects file name prefixes that would write the dumps outside of GoDumpPath
+func validatePrefix(invalid func(field string, reason string, args ...any), field string, prefix *string) {
+	if prefix != nil && strings.ContainsAny(*prefix, `/\`) {
+		invalid(field, "cannot contain a path separator, got %q", *prefix)
+	}
+}
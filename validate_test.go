@@ -0,0 +1,68 @@
+package godump
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestValidateReportsEveryProblem(t *testing.T) {
+	prefix := "../heap"
+	configs := &GoDumpConfigs{
+		GoDumpHeap:      true,
+		GoDumpGoroutine: true,
+		HeapDumpConfigs: &DumpHeapConfigs{
+			HeapThresholdPercentage: 1.5,
+			HeapDumpPrefix:          &prefix,
+			HeapMetric:              "/gc/pauses:seconds",
+		},
+		GoroutineDumpConfigs: &DumpGoroutineConfigs{
+			GoroutineHangingTimeMs: 500,
+		},
+		WatchdogIntervalMs: 1000,
+	}
+	err := configs.Validate()
+	if !errors.Is(err, ErrInvalidConfig) {
+		t.Fatalf("Error: Expected ErrInvalidConfig, got %v", err)
+	}
+	fields := map[string]bool{}
+	for _, joined := range err.(interface{ Unwrap() []error }).Unwrap() {
+		var configErr *ConfigError
+		if !errors.As(joined, &configErr) {
+			t.Fatalf("Error: Expected a *ConfigError, got %T", joined)
+		}
+		fields[configErr.Field] = true
+	}
+	for _, expected := range []string{
+		"HeapDumpConfigs.HeapThresholdPercentage",
+		"HeapDumpConfigs.HeapDumpPrefix",
+		"HeapDumpConfigs.HeapMetric",
+		"GoroutineDumpConfigs.GoroutineHangingTimeMs",
+		"GoDumpPath",
+	} {
+		if !fields[expected] {
+			t.Errorf("Error: Expected a problem on %s, got %v", expected, fields)
+		}
+	}
+	if len(fields) != 5 {
+		t.Errorf("Error: Expected 5 problems, got %v", fields)
+	}
+}
+
+func TestValidateNilAndValid(t *testing.T) {
+	var configs *GoDumpConfigs
+	if err := configs.Validate(); !errors.Is(err, ErrNilConfig) || !errors.Is(err, ErrInvalidConfig) {
+		t.Errorf("Error: Expected ErrNilConfig, got %v", err)
+	}
+	if _, err := NewGoDumpService(nil); !errors.Is(err, ErrNilConfig) {
+		t.Errorf("Error: Expected ErrNilConfig from NewGoDumpService, got %v", err)
+	}
+	valid := &GoDumpConfigs{
+		GoDumpGoroutine:      true,
+		GoroutineDumpConfigs: &DumpGoroutineConfigs{GoroutineHangingTimeMs: 1000},
+		WatchdogIntervalMs:   1000,
+		GoDumpPath:           "./_test",
+	}
+	if err := valid.Validate(); err != nil {
+		t.Errorf("Error: Expected no error, got %v", err)
+	}
+}
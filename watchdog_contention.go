@@ -0,0 +1,287 @@
+package godump
+
+import (
+	"bytes"
+	"fmt"
+	"log/slog"
+	"os"
+	"runtime"
+	"runtime/pprof"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+/* Lock contention watchdog
+ Turns on the mutex and block profiles of the runtime and compares the time goroutines spent waiting between two samples to a threshold:
+	- Mutex wait: time goroutines waited for a sync.Mutex or sync.RWMutex, sampled 1/MutexProfileFraction of the time (the runtime
+	  scales the recorded waits back), the call sites are where the lock was released, the code that held it
+	- Block wait: time goroutines spent blocked on channels, selects, sync.Cond, WaitGroup or a lock, every event longer than
+	  BlockProfileRate nanoseconds and a sample of the shorter ones, the call sites are where the goroutines blocked
+ A profile is only turned on when its threshold is set, the mutex profile fraction in use before is restored and the block profile is turned off
+ when the watchdog stops
+ When a threshold is exceeded a dump with the ContentionTopSites call sites that waited the most since the previous sample is written
+*/
+
+type DumpContentionConfigs struct {
+	MutexWaitThresholdMs float64 // time spent waiting for mutexes between two samples, 0 disables the mutex profile
+	BlockWaitThresholdMs float64 // time spent blocked between two samples, 0 disables the block profile
+	MutexProfileFraction uint64  // one mutex contention event in this many is recorded, DefaultMutexProfileFraction when 0
+	BlockProfileRate     uint64  // one blocking event is recorded per this many nanoseconds spent blocked, DefaultBlockProfileRate when 0
+	ContentionTopSites   uint64  // call sites written in the dump, DefaultContentionTopSites when 0
+	ContentionDumpPrefix *string
+}
+
+const (
+	DefaultContentionDumpPrefix = "contentiondump"
+	DefaultMutexProfileFraction = 10
+	DefaultBlockProfileRate     = 10000 // 10µs
+	DefaultContentionTopSites   = 10
+)
+
+const (
+	WatchdogMutexWait = "mutex_wait_ms"
+	WatchdogBlockWait = "block_wait_ms"
+	// WatchdogContention groups both signals in the sampler and names the dumps
+	WatchdogContention = "contention"
+)
+
+// contentionRecord is one stack of a mutex or block profile with its cumulative values
+type contentionRecord struct {
+	key       string // the program counters of the stack
+	cycles    int64
+	count     int64
+	functions []string
+	locations []string
+}
+
+// site names the first frame of the record outside of the runtime and the sync package
+func (r *contentionRecord) site() string {
+	for i, function := range r.functions {
+		if !strings.HasPrefix(function, "runtime.") && !strings.HasPrefix(function, "sync.") && !strings.HasPrefix(function, "internal/") {
+			return function + " " + r.locations[i]
+		}
+	}
+	if len(r.functions) > 0 {
+		return r.functions[0] + " " + r.locations[0]
+	}
+	return r.key
+}
+
+// contentionProfile is a mutex or block profile read in its debug=1 text format
+type contentionProfile struct {
+	cyclesPerSecond float64
+	records         []contentionRecord // the runtime already scaled the mutex records by the sampling period
+}
+
+// The profiles are read through a variable so the tests can replace them
+var readContentionProfile = func(name string) (string, error) {
+	var buf bytes.Buffer
+	if err := pprof.Lookup(name).WriteTo(&buf, 1); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// parseContentionProfile parses the debug=1 format of the mutex and block profiles:
+//
+//	cycles/second=1999998254
+//	sampling period=1
+//	510875836 79 @ 0x4df199 0x4df198
+//	#	0x4df198	sync.(*Mutex).Unlock+0x98	/usr/local/go/src/sync/mutex.go:65
+func parseContentionProfile(text string) contentionProfile {
+	profile := contentionProfile{}
+	var current *contentionRecord
+	for _, line := range strings.Split(text, "\n") {
+		switch {
+		case strings.HasPrefix(line, "cycles/second="):
+			profile.cyclesPerSecond, _ = strconv.ParseFloat(strings.TrimPrefix(line, "cycles/second="), 64)
+		case strings.HasPrefix(line, "#") && current != nil:
+			// "#	0x4df198	sync.(*Mutex).Unlock+0x98	/usr/local/go/src/sync/mutex.go:65"
+			fields := strings.Fields(line)
+			if len(fields) < 4 {
+				continue
+			}
+			function := fields[2]
+			if plus := strings.LastIndex(function, "+0x"); plus >= 0 {
+				function = function[:plus]
+			}
+			current.functions = append(current.functions, function)
+			current.locations = append(current.locations, fields[len(fields)-1])
+		case strings.Contains(line, " @ "):
+			values, pcs, _ := strings.Cut(line, " @ ")
+			fields := strings.Fields(values)
+			if len(fields) != 2 {
+				current = nil
+				continue
+			}
+			record := contentionRecord{key: pcs}
+			record.cycles, _ = strconv.ParseInt(fields[0], 10, 64)
+			record.count, _ = strconv.ParseInt(fields[1], 10, 64)
+			profile.records = append(profile.records, record)
+			current = &profile.records[len(profile.records)-1]
+		default:
+			current = nil
+		}
+	}
+	return profile
+}
+
+// wait converts cycles of the profile to a wait time
+func (p *contentionProfile) wait(cycles int64) time.Duration {
+	if p.cyclesPerSecond <= 0 {
+		return 0
+	}
+	return time.Duration(float64(cycles) / p.cyclesPerSecond * float64(time.Second))
+}
+
+// contentionSignal follows one of the two profiles between samples
+type contentionSignal struct {
+	watchdog string
+	profile  string
+	title    string
+	previous map[string]contentionRecord // nil until the profile was read once
+	above    bool
+}
+
+// check reads the profile and returns the section of the dump when the wait since the previous sample exceeds the threshold
+func (s *contentionSignal) check(gd *GoDumpService, threshold float64, topSites int) (dumpSection, bool) {
+	if threshold == 0 {
+		s.previous, s.above = nil, false
+		return dumpSection{}, false
+	}
+	text, err := readContentionProfile(s.profile)
+	if err != nil {
+		gd.logger().Warn("godump could not read the profile", slog.String("watchdog", s.watchdog), slog.Any("error", err))
+		return dumpSection{}, false
+	}
+	profile := parseContentionProfile(text)
+	previous := s.previous
+	s.previous = make(map[string]contentionRecord, len(profile.records))
+	deltas := []contentionRecord{}
+	total := int64(0)
+	for _, record := range profile.records {
+		s.previous[record.key] = record
+		delta := record
+		if before, ok := previous[record.key]; ok {
+			delta.cycles -= before.cycles
+			delta.count -= before.count
+		}
+		if delta.cycles <= 0 {
+			continue
+		}
+		deltas = append(deltas, delta)
+		total += delta.cycles
+	}
+	if previous == nil {
+		// The first read is the baseline
+		return dumpSection{}, false
+	}
+	waitMs := float64(profile.wait(total)) / float64(time.Millisecond)
+	if !gd.checkThreshold(s.watchdog, &s.above, waitMs, threshold) {
+		return dumpSection{}, false
+	}
+	sort.Slice(deltas, func(i, j int) bool { return deltas[i].cycles > deltas[j].cycles })
+	section := dumpSection{title: fmt.Sprintf("%s (%.1fms since the previous sample, threshold %vms)", s.title, waitMs, threshold)}
+	for _, delta := range deltas[:min(len(deltas), topSites)] {
+		section.lines = append(section.lines, fmt.Sprintf("%10.1fms %8d  %s", float64(profile.wait(delta.cycles))/float64(time.Millisecond), delta.count, delta.site()))
+		for i, function := range delta.functions {
+			section.lines = append(section.lines, "\t"+function+" "+delta.locations[i])
+		}
+	}
+	return section, true
+}
+
+type contentionWatchdog struct {
+	mutex                 contentionSignal
+	block                 contentionSignal
+	mutexFraction         int // the rates set by the watchdog, 0 when it did not turn the profile on
+	blockRate             int
+	previousMutexFraction int
+}
+
+func newContentionWatchdog() *contentionWatchdog {
+	return &contentionWatchdog{
+		mutex: contentionSignal{watchdog: WatchdogMutexWait, profile: "mutex", title: "Top Mutex Wait Call Sites"},
+		block: contentionSignal{watchdog: WatchdogBlockWait, profile: "block", title: "Top Blocking Call Sites"},
+	}
+}
+
+// setRates turns the profiles on or off, 0 turns a profile off
+func (w *contentionWatchdog) setRates(mutexFraction int, blockRate int) {
+	if mutexFraction != w.mutexFraction {
+		switch {
+		case w.mutexFraction == 0:
+			w.previousMutexFraction = runtime.SetMutexProfileFraction(mutexFraction)
+		case mutexFraction == 0:
+			runtime.SetMutexProfileFraction(w.previousMutexFraction)
+		default:
+			runtime.SetMutexProfileFraction(mutexFraction)
+		}
+		w.mutexFraction = mutexFraction
+	}
+	if blockRate != w.blockRate {
+		runtime.SetBlockProfileRate(blockRate)
+		w.blockRate = blockRate
+	}
+}
+
+func (w *contentionWatchdog) check(gd *GoDumpService, configs *GoDumpConfigs, sample *Sample) {
+	contention := configs.ContentionDumpConfigs
+	mutexFraction, blockRate := 0, 0
+	if contention.MutexWaitThresholdMs > 0 {
+		mutexFraction = int(contention.MutexProfileFraction)
+		if mutexFraction == 0 {
+			mutexFraction = DefaultMutexProfileFraction
+		}
+	}
+	if contention.BlockWaitThresholdMs > 0 {
+		blockRate = int(contention.BlockProfileRate)
+		if blockRate == 0 {
+			blockRate = DefaultBlockProfileRate
+		}
+	}
+	w.setRates(mutexFraction, blockRate)
+	topSites := int(contention.ContentionTopSites)
+	if topSites == 0 {
+		topSites = DefaultContentionTopSites
+	}
+	sections := []dumpSection{}
+	if section, fired := w.mutex.check(gd, contention.MutexWaitThresholdMs, topSites); fired {
+		sections = append(sections, section)
+	}
+	if section, fired := w.block.check(gd, contention.BlockWaitThresholdMs, topSites); fired {
+		sections = append(sections, section)
+	}
+	if len(sections) > 0 {
+		file, err := writeContentionDump(configs, sections)
+		gd.emitDump(WatchdogContention, file, err)
+	}
+}
+
+// close turns off the profiles the watchdog turned on
+func (w *contentionWatchdog) close() {
+	w.setRates(0, 0)
+}
+
+// writeContentionDump writes the top contended call sites and returns the path of the file it created
+func writeContentionDump(goDumpConfigs *GoDumpConfigs, sections []dumpSection) (string, error) {
+	var prefix *string
+	if goDumpConfigs.ContentionDumpConfigs != nil {
+		prefix = goDumpConfigs.ContentionDumpConfigs.ContentionDumpPrefix
+	}
+	return writeDumpFile(dumpFilePath(goDumpConfigs, prefix, DefaultContentionDumpPrefix, ".txt"), func(f *os.File) error {
+		f.WriteString("Contention Dump\n---\n")
+		f.WriteString("Time: " + time.Now().Format("2006-01-02T15:04:05") + "\n")
+		for _, section := range sections {
+			f.WriteString("---\n\n")
+			f.WriteString(section.title + ":\n")
+			fmt.Fprintf(f, "%12s %8s  %s\n", "Wait", "Events", "Call Site")
+			for _, line := range section.lines {
+				f.WriteString(line + "\n")
+			}
+		}
+		return nil
+	})
+}
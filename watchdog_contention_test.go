@@ -0,0 +1,110 @@
+package godump
+
+import (
+	"os"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+const testMutexProfile = `--- mutex:
+cycles/second=2000000000
+sampling period=5
+400000000 79 @ 0x4df199 0x4df198 0x483981
+#	0x4df198	sync.(*Mutex).Unlock+0x98	/usr/local/go/src/sync/mutex.go:65
+#	0x4df197	main.main.func1+0x97		/tmp/mp/main.go:23
+
+`
+
+func TestParseContentionProfile(t *testing.T) {
+	profile := parseContentionProfile(testMutexProfile)
+	if profile.cyclesPerSecond != 2e9 || len(profile.records) != 1 {
+		t.Fatalf("Error: Unexpected profile %+v", profile)
+	}
+	record := profile.records[0]
+	if record.cycles != 400000000 || record.count != 79 || record.site() != "main.main.func1 /tmp/mp/main.go:23" {
+		t.Errorf("Error: Unexpected record %+v", record)
+	}
+	// The runtime already scaled the cycles by the sampling period
+	if wait := profile.wait(record.cycles); wait != 200*time.Millisecond {
+		t.Errorf("Error: Expected the wait not to be scaled again by the sampling period, got %v", wait)
+	}
+}
+
+// contend makes goroutines wait for a mutex held for a millisecond at a time
+func contend() {
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 10; j++ {
+				mu.Lock()
+				time.Sleep(time.Millisecond)
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestContentionWatchdog(t *testing.T) {
+	before := runtime.SetMutexProfileFraction(-1)
+	configs := &GoDumpConfigs{
+		GoDumpContention:   true,
+		GoDumpPath:         t.TempDir(),
+		WatchdogIntervalMs: 1000,
+		ContentionDumpConfigs: &DumpContentionConfigs{
+			MutexWaitThresholdMs: 5,
+			BlockWaitThresholdMs: 5,
+			MutexProfileFraction: 1,
+		},
+	}
+	gds, err := NewGoDumpService(configs)
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	var received []Event
+	gds.OnEvent(func(e Event) { received = append(received, e) })
+
+	w := newContentionWatchdog()
+	defer w.close()
+	w.check(gds, configs, &Sample{})
+	if runtime.SetMutexProfileFraction(-1) != 1 {
+		t.Errorf("Error: Expected the mutex profile to be turned on")
+	}
+	if len(received) != 0 {
+		t.Fatalf("Error: Expected the first sample to be the baseline, got %+v", received)
+	}
+	contend()
+	w.check(gds, configs, &Sample{})
+	crossed := map[string]bool{}
+	var written *Event
+	for i := range received {
+		switch received[i].Type {
+		case EventThresholdCrossed:
+			crossed[received[i].Watchdog] = true
+		case EventDumpWritten:
+			written = &received[i]
+		}
+	}
+	if !crossed[WatchdogMutexWait] || !crossed[WatchdogBlockWait] || written == nil {
+		t.Fatalf("Error: Expected both signals to fire with a dump, got %+v", received)
+	}
+	dump, err := os.ReadFile(written.File)
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	for _, expected := range []string{"Top Mutex Wait Call Sites", "Top Blocking Call Sites", "godump.contend.func1"} {
+		if !strings.Contains(string(dump), expected) {
+			t.Errorf("Error: Expected %q in the dump, got %s", expected, dump)
+		}
+	}
+	w.close()
+	if fraction := runtime.SetMutexProfileFraction(-1); fraction != before {
+		t.Errorf("Error: Expected the mutex profile fraction to be restored to %v, got %v", before, fraction)
+	}
+}
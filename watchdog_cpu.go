@@ -0,0 +1,167 @@
+package godump
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"runtime"
+	"runtime/pprof"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+/* Process CPU watchdog
+ Computes the CPU utilisation of the process from /proc/self/stat (user and system time) between two samples, Linux only
+ The utilisation is a fraction of the CPUs of the machine, 1 means every CPU was busy running the process
+ When it stays above CPUThresholdPercentage for CPUSustainedIntervals samples:
+	- A CPU profile is captured in the background for CPUProfileDurationMs, only one profile runs at a time
+	- A goroutine dump is written right away
+*/
+
+type DumpCPUConfigs struct {
+	CPUThresholdPercentage float64 // fraction (0 to 1) of the CPUs used by the process
+	CPUSustainedIntervals  uint64  // samples in a row above the threshold before the profile is taken, 1 when 0
+	CPUProfileDurationMs   uint64  // DefaultCPUProfileDurationMs when 0
+	CPUProfilePrefix       *string
+}
+
+const (
+	DefaultCPUProfilePrefix     = "cpuprofile"
+	DefaultCPUProfileDurationMs = 10000
+)
+
+const WatchdogProcessCPU = "process_cpu"
+
+// clockTicksPerSecond is the unit of the times in /proc/self/stat (USER_HZ), it is 100 on every Linux architecture Go supports
+const clockTicksPerSecond = 100
+
+// The process CPU time is read through a variable so the tests can replace it
+var readProcessCPU = readProcStatCPU
+
+// readProcStatCPU returns the user and system CPU time consumed by the process
+func readProcStatCPU() (time.Duration, error) {
+	stat, err := os.ReadFile("/proc/self/stat")
+	if err != nil {
+		return 0, err
+	}
+	// The command name can contain spaces and parentheses, the fields start after the last ')'
+	end := strings.LastIndexByte(string(stat), ')')
+	if end < 0 {
+		return 0, fmt.Errorf("unexpected /proc/self/stat format")
+	}
+	// fields[0] is the state (field 3), utime and stime are the fields 14 and 15
+	fields := strings.Fields(string(stat[end+1:]))
+	if len(fields) < 13 {
+		return 0, fmt.Errorf("unexpected /proc/self/stat format")
+	}
+	utime, err := strconv.ParseUint(fields[11], 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	stime, err := strconv.ParseUint(fields[12], 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	return time.Duration(utime+stime) * time.Second / clockTicksPerSecond, nil
+}
+
+type processCPUWatchdog struct {
+	previousCPU  time.Duration
+	previousTime time.Time
+	intervals    uint64 // samples in a row above the threshold
+	above        bool
+}
+
+func (w *processCPUWatchdog) check(gd *GoDumpService, configs *GoDumpConfigs, sample *Sample) {
+	cpu, err := readProcessCPU()
+	if err != nil {
+		gd.logger().Debug("godump could not read the value", slog.String("watchdog", WatchdogProcessCPU), slog.Any("error", err))
+		return
+	}
+	previousCPU, previousTime := w.previousCPU, w.previousTime
+	w.previousCPU, w.previousTime = cpu, sample.Time
+	if previousTime.IsZero() || !sample.Time.After(previousTime) {
+		// The utilisation is a rate, we need two samples
+		return
+	}
+	cpuConfigs := configs.CPUDumpConfigs
+	utilisation := float64(cpu-previousCPU) / float64(sample.Time.Sub(previousTime)) / float64(runtime.NumCPU())
+	if utilisation > cpuConfigs.CPUThresholdPercentage {
+		w.intervals++
+	} else {
+		w.intervals = 0
+	}
+	if !w.above && w.intervals > 0 && w.intervals < max(cpuConfigs.CPUSustainedIntervals, 1) {
+		gd.logger().Debug("godump threshold exceeded, waiting for it to be sustained",
+			slog.String("watchdog", WatchdogProcessCPU), slog.Float64("value", utilisation), slog.Float64("threshold", cpuConfigs.CPUThresholdPercentage),
+			slog.Uint64("intervals", w.intervals), slog.Uint64("sustained_intervals", cpuConfigs.CPUSustainedIntervals))
+		return
+	}
+	if gd.checkThreshold(WatchdogProcessCPU, &w.above, utilisation, cpuConfigs.CPUThresholdPercentage) {
+		gd.startCPUProfile(WatchdogProcessCPU, configs)
+		gd.takeGoroutineDump(WatchdogProcessCPU, nil)
+	}
+}
+
+// startCPUProfile captures a CPU profile in the background on behalf of a watchdog, the profile stops early when the service stops
+// The runtime runs a single CPU profile at a time, the watchdogs, triggers and tiers share gd.state.profiling and a new profile
+// is not started before the previous one is written
+func (gd *GoDumpService) startCPUProfile(watchdog string, configs *GoDumpConfigs) {
+	profiling := &gd.state.profiling
+	if !profiling.CompareAndSwap(false, true) {
+		// The previous profile is still running
+		gd.logger().Debug("godump CPU profile already running", slog.String("watchdog", watchdog))
+		return
+	}
+	cpuConfigs := configs.CPUDumpConfigs
+	if cpuConfigs == nil {
+		cpuConfigs = &DumpCPUConfigs{}
+	}
+	duration := time.Duration(cpuConfigs.CPUProfileDurationMs) * time.Millisecond
+	if duration == 0 {
+		duration = DefaultCPUProfileDurationMs * time.Millisecond
+	}
+	cpuProfileFile := dumpFilePath(configs, cpuConfigs.CPUProfilePrefix, DefaultCPUProfilePrefix, ".pprof")
+	f, err := os.Create(cpuProfileFile)
+	if err == nil {
+		err = pprof.StartCPUProfile(f)
+		if err != nil {
+			// e.g. the application runs its own profile, do not leave an empty file behind
+			f.Close()
+			os.Remove(cpuProfileFile)
+		}
+	}
+	if err != nil {
+		profiling.Store(false)
+		gd.emitDump(watchdog, cpuProfileFile, err)
+		return
+	}
+	gd.logger().Info("godump CPU profile started", slog.String("watchdog", watchdog), slog.String("file", cpuProfileFile), slog.Duration("duration", duration))
+	done, SafeExitWg := gd.background()
+	go func() {
+		if SafeExitWg != nil {
+			defer SafeExitWg.Done()
+		}
+		defer profiling.Store(false)
+		select {
+		case <-time.After(duration):
+		case <-done:
+		}
+		pprof.StopCPUProfile()
+		gd.emitDump(watchdog, cpuProfileFile, f.Close())
+	}()
+}
+
+// background registers a task that outlives the current tick, it returns the channel closed when the service stops
+// and the wait group the task has to call Done on, both are nil when the service is not running
+func (gd *GoDumpService) background() (chan bool, *sync.WaitGroup) {
+	gd.state.mu.Lock()
+	defer gd.state.mu.Unlock()
+	if !gd.state.running {
+		return nil, nil
+	}
+	gd.state.SafeExitWg.Add(1)
+	return gd.state.done, gd.state.SafeExitWg
+}
@@ -0,0 +1,115 @@
+package godump
+
+import (
+	"io"
+	"os"
+	"runtime"
+	"runtime/pprof"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReadProcStatCPU(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("Skipping: /proc is only available on Linux")
+	}
+	before, err := readProcStatCPU()
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	// Burn some CPU so the time moves forward
+	for start := time.Now(); time.Since(start) < 50*time.Millisecond; {
+	}
+	after, err := readProcStatCPU()
+	if err != nil || after <= before {
+		t.Errorf("Error: Expected the CPU time to grow, got %v then %v (%v)", before, after, err)
+	}
+}
+
+func TestProcessCPUWatchdog(t *testing.T) {
+	cpu := time.Duration(0)
+	readProcessCPU = func() (time.Duration, error) { return cpu, nil }
+	t.Cleanup(func() { readProcessCPU = readProcStatCPU })
+	configs := &GoDumpConfigs{
+		GoDumpCPU:          true,
+		GoDumpPath:         t.TempDir(),
+		WatchdogIntervalMs: 1000,
+		CPUDumpConfigs: &DumpCPUConfigs{
+			CPUThresholdPercentage: 0.5,
+			CPUSustainedIntervals:  2,
+			CPUProfileDurationMs:   50,
+		},
+	}
+	gds, err := NewGoDumpService(configs)
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	events := gds.Subscribe()
+
+	w := &processCPUWatchdog{}
+	now := time.Now()
+	busy := time.Duration(runtime.NumCPU()) * 900 * time.Millisecond
+	w.check(gds, configs, &Sample{Time: now})
+	// 90% of the CPUs for one interval is not sustained yet
+	cpu += busy
+	w.check(gds, configs, &Sample{Time: now.Add(time.Second)})
+	if len(events) != 0 {
+		t.Fatalf("Error: Expected no event after one interval, got %v", len(events))
+	}
+	cpu += busy
+	w.check(gds, configs, &Sample{Time: now.Add(2 * time.Second)})
+	crossed := <-events
+	if crossed.Type != EventThresholdCrossed || crossed.Watchdog != WatchdogProcessCPU || crossed.Value < 0.89 || crossed.Value > 0.91 {
+		t.Errorf("Error: Unexpected event %+v", crossed)
+	}
+	files := map[string]bool{}
+	timeout := time.After(5 * time.Second)
+	for len(files) < 2 {
+		select {
+		case e := <-events:
+			if e.Type != EventDumpWritten {
+				t.Fatalf("Error: Unexpected event %+v", e)
+			}
+			files[e.File[strings.LastIndexByte(e.File, '.'):]] = true
+		case <-timeout:
+			t.Fatalf("Error: Expected a goroutine dump and a CPU profile, got %v", files)
+		}
+	}
+	if !files[".txt"] || !files[".pprof"] {
+		t.Errorf("Error: Expected a goroutine dump and a CPU profile, got %v", files)
+	}
+}
+
+func TestCPUProfileAlreadyRunning(t *testing.T) {
+	configs := &GoDumpConfigs{GoDumpPath: t.TempDir(), WatchdogIntervalMs: 1000}
+	gds, err := NewGoDumpService(configs)
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	var received []Event
+	gds.OnEvent(func(e Event) { received = append(received, e) })
+	// The application runs its own profile
+	if err := pprof.StartCPUProfile(io.Discard); err != nil {
+		t.Skipf("Skipping: %v", err)
+	}
+	gds.startCPUProfile(WatchdogProcessCPU, configs)
+	pprof.StopCPUProfile()
+	if len(received) != 1 || received[0].Type != EventDumpFailed {
+		t.Fatalf("Error: Expected the profile to fail, got %+v", received)
+	}
+	if _, err := os.Stat(received[0].File); !os.IsNotExist(err) {
+		t.Errorf("Error: Expected the empty profile to be removed, got %v", err)
+	}
+	if gds.state.profiling.Load() {
+		t.Errorf("Error: Expected the profiling guard to be released")
+	}
+
+	// A profile started by a trigger blocks the profile of a tier or of the CPU watchdog
+	gds.state.profiling.Store(true)
+	received = nil
+	gds.runActions("tier", "critical", configs, []Action{ActionCPUProfile})
+	if len(received) != 0 {
+		t.Errorf("Error: Expected no second profile while one runs, got %+v", received)
+	}
+}
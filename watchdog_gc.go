@@ -0,0 +1,115 @@
+package godump
+
+import (
+	"encoding/json"
+	"os"
+	"runtime"
+	"time"
+)
+
+/* GC pressure watchdog
+ Catches GC death spirals, where the heap is not necessarily big but the application spends its time collecting it
+ The signals are computed between two samples from runtime/metrics:
+	- GC CPU fraction: /cpu/classes/gc/total:cpu-seconds over /cpu/classes/total:cpu-seconds
+	- GC cycles per minute: /gc/cycles/total:gc-cycles
+	- p99 GC pause: the 99th percentile of the pauses added to /gc/pauses:seconds
+ When any signal exceeds its threshold a heap dump and a MemStats snapshot (with the signals that fired) are written
+*/
+
+type DumpGCConfigs struct {
+	GCCPUFractionThreshold     float64 // fraction (0 to 1) of the CPU time spent in the GC, 0 disables it
+	GCCyclesPerMinuteThreshold float64 // 0 disables it
+	GCPauseP99ThresholdMs      float64 // 0 disables it
+	GCDumpPrefix               *string
+}
+
+const DefaultGCDumpPrefix = "gcdump"
+
+// Names of the GC pressure signals as reported in Event.Watchdog
+const (
+	WatchdogGCCPUFraction = "gc_cpu_fraction"
+	WatchdogGCCycles      = "gc_cycles_per_minute"
+	WatchdogGCPauseP99    = "gc_pause_p99_ms"
+	WatchdogGCPressure    = "gc_pressure" // the heap dump and MemStats snapshot written when any signal fires
+)
+
+const (
+	MetricGCCPU    = "/cpu/classes/gc/total:cpu-seconds"
+	MetricTotalCPU = "/cpu/classes/total:cpu-seconds"
+	MetricGCCycles = "/gc/cycles/total:gc-cycles"
+	MetricGCPauses = "/gc/pauses:seconds"
+)
+
+type gcPressureWatchdog struct {
+	previous    *Sample
+	aboveCPU    bool
+	aboveCycles bool
+	abovePause  bool
+}
+
+func (w *gcPressureWatchdog) check(gd *GoDumpService, configs *GoDumpConfigs, sample *Sample) {
+	previous := w.previous
+	w.previous = sample
+	if previous == nil {
+		// The signals are rates, we need two samples
+		return
+	}
+	gc := configs.GCDumpConfigs
+	delta := func(name string) float64 {
+		current, _ := sample.Metric(name)
+		last, _ := previous.Metric(name)
+		return current - last
+	}
+	signals := map[string]float64{}
+	fired := false
+	if gc.GCCPUFractionThreshold > 0 {
+		fraction := 0.0
+		if total := delta(MetricTotalCPU); total > 0 {
+			fraction = delta(MetricGCCPU) / total
+		}
+		signals[WatchdogGCCPUFraction] = fraction
+		fired = gd.checkThreshold(WatchdogGCCPUFraction, &w.aboveCPU, fraction, gc.GCCPUFractionThreshold) || fired
+	}
+	if gc.GCCyclesPerMinuteThreshold > 0 && sample.Elapsed > 0 {
+		perMinute := delta(MetricGCCycles) / sample.Elapsed.Minutes()
+		signals[WatchdogGCCycles] = perMinute
+		fired = gd.checkThreshold(WatchdogGCCycles, &w.aboveCycles, perMinute, gc.GCCyclesPerMinuteThreshold) || fired
+	}
+	if gc.GCPauseP99ThresholdMs > 0 {
+		current, _ := sample.Histogram(MetricGCPauses)
+		last, _ := previous.Histogram(MetricGCPauses)
+		p99, _ := histogramQuantile(last, current, 0.99)
+		p99Ms := p99 * float64(time.Second/time.Millisecond)
+		signals[WatchdogGCPauseP99] = p99Ms
+		fired = gd.checkThreshold(WatchdogGCPauseP99, &w.abovePause, p99Ms, gc.GCPauseP99ThresholdMs) || fired
+	}
+	if fired {
+		gd.takeHeapDump(WatchdogGCPressure)
+		file, err := writeMemStatsDump(configs, signals)
+		gd.emitDump(WatchdogGCPressure, file, err)
+	}
+}
+
+// writeMemStatsDump writes runtime.MemStats and the GC signals that fired as JSON
+// Reading MemStats stops the world, it is only done once the watchdog fired
+func writeMemStatsDump(goDumpConfigs *GoDumpConfigs, signals map[string]float64) (string, error) {
+	var prefix *string
+	if goDumpConfigs.GCDumpConfigs != nil {
+		prefix = goDumpConfigs.GCDumpConfigs.GCDumpPrefix
+	}
+	var memStats runtime.MemStats
+	runtime.ReadMemStats(&memStats)
+	return writeDumpFile(dumpFilePath(goDumpConfigs, prefix, DefaultGCDumpPrefix, ".json"), func(f *os.File) error {
+		encoder := json.NewEncoder(f)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(struct {
+			Time     string
+			Signals  map[string]float64
+			MemStats runtime.MemStats
+		}{
+			Time:     time.Now().Format("2006-01-02T15:04:05"),
+			Signals:  signals,
+			MemStats: memStats,
+		})
+	})
+}
@@ -0,0 +1,123 @@
+package godump
+
+import (
+	"math"
+	"os"
+	"runtime/metrics"
+	"strings"
+	"testing"
+	"time"
+)
+
+func gcSample(elapsed time.Duration, gcCPU, totalCPU, cycles float64, pauses []uint64) *Sample {
+	return &Sample{
+		Elapsed: elapsed,
+		metrics: map[string]float64{
+			MetricGCCPU:    gcCPU,
+			MetricTotalCPU: totalCPU,
+			MetricGCCycles: cycles,
+		},
+		histograms: map[string]*metrics.Float64Histogram{
+			MetricGCPauses: {
+				Counts:  pauses,
+				Buckets: []float64{0, 0.001, 0.01, 0.1, math.Inf(1)},
+			},
+		},
+	}
+}
+
+func TestHistogramQuantile(t *testing.T) {
+	previous := &metrics.Float64Histogram{Counts: []uint64{10, 0, 0, 0}, Buckets: []float64{0, 1, 2, 3, math.Inf(1)}}
+	current := &metrics.Float64Histogram{Counts: []uint64{10, 98, 1, 1}, Buckets: previous.Buckets}
+	// The observations before previous are ignored
+	if value, count := histogramQuantile(previous, current, 0.5); value != 2 || count != 100 {
+		t.Errorf("Error: Expected p50 of 2 over 100 observations, got %v over %v", value, count)
+	}
+	// The last bucket is open, its lower bound is reported
+	if value, _ := histogramQuantile(previous, current, 1); value != 3 {
+		t.Errorf("Error: Expected p100 of 3, got %v", value)
+	}
+	if _, count := histogramQuantile(current, current, 0.99); count != 0 {
+		t.Errorf("Error: Expected no observation, got %v", count)
+	}
+}
+
+func TestGCPressureWatchdog(t *testing.T) {
+	configs := &GoDumpConfigs{
+		GoDumpGC:           true,
+		GoDumpPath:         t.TempDir(),
+		WatchdogIntervalMs: 1000,
+		GCDumpConfigs: &DumpGCConfigs{
+			GCCPUFractionThreshold:     0.25,
+			GCCyclesPerMinuteThreshold: 120,
+			GCPauseP99ThresholdMs:      5,
+		},
+	}
+	gds, err := NewGoDumpService(configs)
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	var received []Event
+	gds.OnEvent(func(e Event) { received = append(received, e) })
+
+	w := &gcPressureWatchdog{}
+	w.check(gds, configs, gcSample(0, 1, 10, 5, []uint64{10, 0, 0, 0}))
+	// 10% of the CPU in the GC, 60 cycles per minute and sub-millisecond pauses
+	w.check(gds, configs, gcSample(time.Second, 2, 20, 6, []uint64{20, 0, 0, 0}))
+	if len(received) != 0 {
+		t.Fatalf("Error: Expected no event under the thresholds, got %+v", received)
+	}
+	// 50% of the CPU in the GC, 300 cycles per minute and pauses of up to 10ms
+	w.check(gds, configs, gcSample(time.Second, 7, 30, 11, []uint64{20, 10, 0, 0}))
+	crossed := map[string]float64{}
+	files := 0
+	for _, e := range received {
+		switch e.Type {
+		case EventThresholdCrossed:
+			crossed[e.Watchdog] = e.Value
+		case EventDumpWritten:
+			files++
+			if _, err := os.Stat(e.File); err != nil {
+				t.Errorf("Error: Expected the dump %v to exist: %v", e.File, err)
+			}
+		case EventDumpFailed:
+			t.Errorf("Error: Unexpected dump failure %v", e.Err)
+		}
+	}
+	if crossed[WatchdogGCCPUFraction] != 0.5 || crossed[WatchdogGCCycles] != 300 || crossed[WatchdogGCPauseP99] != 10 {
+		t.Errorf("Error: Unexpected signals %v", crossed)
+	}
+	if files != 2 {
+		t.Errorf("Error: Expected a heap dump and a MemStats dump, got %v files", files)
+	}
+	entries, _ := os.ReadDir(configs.GoDumpPath)
+	found := false
+	for _, entry := range entries {
+		if strings.HasPrefix(entry.Name(), DefaultGCDumpPrefix) && strings.HasSuffix(entry.Name(), ".json") {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("Error: Expected a %v*.json file in %v", DefaultGCDumpPrefix, configs.GoDumpPath)
+	}
+}
+
+func TestValidateGCConfigs(t *testing.T) {
+	configs := &GoDumpConfigs{
+		GoDumpGC:           true,
+		GoDumpPath:         t.TempDir(),
+		WatchdogIntervalMs: 1000,
+		GCDumpConfigs:      &DumpGCConfigs{},
+	}
+	if err := configs.Validate(); err == nil {
+		t.Errorf("Error: Expected an error when every GC threshold is 0")
+	}
+	configs.GCDumpConfigs.GCCPUFractionThreshold = 1.5
+	if err := configs.Validate(); err == nil {
+		t.Errorf("Error: Expected an error for a GC CPU fraction above 1")
+	}
+	configs.GCDumpConfigs.GCCPUFractionThreshold = 0.3
+	if err := configs.Validate(); err != nil {
+		t.Errorf("Error: Unexpected error %v", err)
+	}
+}
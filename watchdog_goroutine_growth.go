@@ -0,0 +1,121 @@
+package godump
+
+import (
+	"fmt"
+	"log/slog"
+	"sort"
+	"time"
+)
+
+/* Goroutine growth watchdog
+ GoroutineThreshold only compares the total number of goroutines to a fixed number, a slow leak stays under it for a long time
+ This watchdog counts the goroutines per creation site (the "created by" function and the line of its go statement) on every sample
+ A creation site is leaking when, over the last GoroutineGrowthWindowMs:
+	- its count never went down from one sample to the next
+	- it gained more than GoroutineGrowthThreshold goroutines
+ The goroutine dump then names every leaking creation site with the stack of one of its goroutines
+ GoroutineGrowthTiers compare the growth of the fastest growing creation site to their levels, GoroutineGrowthThreshold only
+ applies next to them when it is set
+*/
+
+const (
+	WatchdogGoroutineGrowth         = "goroutine_growth"
+	DefaultGoroutineGrowthThreshold = 10
+)
+
+type goroutineGrowthWatchdog struct {
+	times  []time.Time
+	counts []map[string]uint64 // goroutines per creation site on every sample of the window, oldest first
+	above  map[string]bool
+	tiers  tierState
+}
+
+func (w *goroutineGrowthWatchdog) check(gd *GoDumpService, configs *GoDumpConfigs, sample *Sample) {
+	goroutines, _, err := sample.goroutineProfile()
+	if err != nil {
+		gd.logger().Warn("godump could not read the goroutine profile", slog.String("watchdog", WatchdogGoroutineGrowth), slog.Any("error", err))
+		return
+	}
+	if w.above == nil {
+		w.above = map[string]bool{}
+	}
+	counts := map[string]uint64{}
+	stacks := map[string]string{}
+	for _, g := range goroutines {
+		site := g.creationSite()
+		if site == "" {
+			continue
+		}
+		counts[site]++
+		if _, ok := stacks[site]; !ok {
+			stacks[site] = g.Stack
+		}
+	}
+	w.times = append(w.times, sample.Time)
+	w.counts = append(w.counts, counts)
+	window := time.Duration(configs.GoroutineDumpConfigs.GoroutineGrowthWindowMs) * time.Millisecond
+	// Drop the oldest sample once the next one covers the window on its own
+	for len(w.times) > 2 && sample.Time.Sub(w.times[1]) >= window {
+		w.times, w.counts = w.times[1:], w.counts[1:]
+	}
+	if sample.Time.Sub(w.times[0]) < window {
+		// The window is not covered yet
+		return
+	}
+	threshold := float64(configs.GoroutineDumpConfigs.GoroutineGrowthThreshold)
+	tiers := configs.GoroutineDumpConfigs.GoroutineGrowthTiers
+	if threshold == 0 {
+		threshold = DefaultGoroutineGrowthThreshold
+	}
+	// the tiers may be set without the threshold
+	checkSites := configs.GoroutineDumpConfigs.GoroutineGrowthThreshold > 0 || tiers == nil
+	sites := make([]string, 0, len(counts))
+	for site := range counts {
+		sites = append(sites, site)
+	}
+	for site := range w.above {
+		if _, ok := counts[site]; !ok {
+			sites = append(sites, site)
+		}
+	}
+	sort.Strings(sites)
+	leaking := dumpSection{title: "Leaking Creation Sites"}
+	fastest := uint64(0)
+	for _, site := range sites {
+		growth := w.monotonicGrowth(site)
+		fastest = max(fastest, growth)
+		if !checkSites {
+			continue
+		}
+		above := w.above[site]
+		if gd.checkDetailThreshold(WatchdogGoroutineGrowth, site, &above, float64(growth), threshold) {
+			leaking.lines = append(leaking.lines,
+				fmt.Sprintf("%s: %d -> %d goroutines over %v", site, w.counts[0][site], counts[site], sample.Time.Sub(w.times[0])),
+				stacks[site], "")
+		}
+		if above {
+			w.above[site] = true
+		} else {
+			delete(w.above, site)
+		}
+	}
+	if len(leaking.lines) > 0 {
+		gd.takeGoroutineDump(WatchdogGoroutineGrowth, nil, leaking)
+	}
+	if tiers != nil {
+		gd.checkTiers(WatchdogGoroutineGrowth, "", tiers, &w.tiers, float64(fastest), 1, configs, sample)
+	}
+}
+
+// monotonicGrowth returns how many goroutines a creation site gained over the window, 0 when its count went down at some point
+func (w *goroutineGrowthWatchdog) monotonicGrowth(site string) uint64 {
+	first := w.counts[0][site]
+	previous := first
+	for _, counts := range w.counts[1:] {
+		if counts[site] < previous {
+			return 0
+		}
+		previous = counts[site]
+	}
+	return previous - first
+}
@@ -0,0 +1,64 @@
+package godump
+
+import (
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func leakGoroutines(n int, stop chan bool) {
+	for i := 0; i < n; i++ {
+		go func() { <-stop }()
+	}
+}
+
+func TestGoroutineGrowthWatchdog(t *testing.T) {
+	configs := &GoDumpConfigs{
+		GoDumpGoroutine:    true,
+		GoDumpPath:         t.TempDir(),
+		WatchdogIntervalMs: 1000,
+		GoroutineDumpConfigs: &DumpGoroutineConfigs{
+			GoroutineGrowthWindowMs:  3000,
+			GoroutineGrowthThreshold: 5,
+		},
+	}
+	gds, err := NewGoDumpService(configs)
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	var received []Event
+	gds.OnEvent(func(e Event) { received = append(received, e) })
+	stop := make(chan bool)
+	defer close(stop)
+
+	w := &goroutineGrowthWatchdog{}
+	now := time.Now()
+	for i := 0; i <= 3; i++ {
+		leakGoroutines(3, stop)
+		time.Sleep(10 * time.Millisecond)
+		w.check(gds, configs, &Sample{Time: now.Add(time.Duration(i) * time.Second)})
+	}
+	var crossed, written *Event
+	for i := range received {
+		switch received[i].Type {
+		case EventThresholdCrossed:
+			crossed = &received[i]
+		case EventDumpWritten:
+			written = &received[i]
+		}
+	}
+	if crossed == nil || !strings.Contains(crossed.Detail, "leakGoroutines") || crossed.Value != 9 {
+		t.Fatalf("Error: Expected the leaking creation site to be reported, got %+v", received)
+	}
+	if written == nil {
+		t.Fatalf("Error: Expected a goroutine dump, got %+v", received)
+	}
+	dump, err := os.ReadFile(written.File)
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	if !strings.Contains(string(dump), "Leaking Creation Sites:") || !strings.Contains(string(dump), crossed.Detail+": 3 -> 12 goroutines") {
+		t.Errorf("Error: Expected the dump to name the leaking site, got %s", dump)
+	}
+}
@@ -0,0 +1,172 @@
+package godump
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+/* Non-Go memory watchdog
+ Heap metrics and MemStats only see the memory of the Go runtime, leaks in C libraries linked through cgo are invisible to them
+ The watchdog compares two values, Linux only:
+	- The resident memory of the process: VmRSS in /proc/self/status
+	- All the memory mapped by the Go runtime: /memory/classes/total:bytes, the equivalent of MemStats.Sys
+ The runtime counts memory it reserved but did not touch yet, so the gap is a lower bound of the memory used outside of Go
+ When the gap exceeds NativeMemoryThresholdBytes a dump with /proc/self/smaps_rollup and the resident memory of /proc/self/smaps
+ summed by mapping is written
+*/
+
+type DumpNativeMemoryConfigs struct {
+	NativeMemoryThresholdBytes uint64 // resident bytes not accounted for by the Go runtime
+	NativeMemoryDumpPrefix     *string
+}
+
+const DefaultNativeMemoryDumpPrefix = "nativememorydump"
+
+const WatchdogNativeMemory = "native_memory_bytes"
+
+// The resident memory is read through a variable so the tests can replace it
+var readRSS = readProcRSS
+
+// readProcRSS returns the VmRSS value of /proc/self/status in bytes
+func readProcRSS() (uint64, error) {
+	f, err := os.Open("/proc/self/status")
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if value, ok := strings.CutPrefix(scanner.Text(), "VmRSS:"); ok {
+			return parseKB(value)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return 0, err
+	}
+	return 0, fmt.Errorf("no VmRSS line in /proc/self/status")
+}
+
+// parseKB parses a "1234 kB" value from /proc into bytes
+func parseKB(value string) (uint64, error) {
+	kb, err := strconv.ParseUint(strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(value), "kB")), 10, 64)
+	return kb * 1024, err
+}
+
+type nativeMemoryWatchdog struct {
+	above bool
+}
+
+func (w *nativeMemoryWatchdog) check(gd *GoDumpService, configs *GoDumpConfigs, sample *Sample) {
+	rss, err := readRSS()
+	if err != nil {
+		gd.logger().Debug("godump could not read the value", slog.String("watchdog", WatchdogNativeMemory), slog.Any("error", err))
+		return
+	}
+	gap := uint64(0)
+	if rss > sample.TotalMemoryBytes {
+		gap = rss - sample.TotalMemoryBytes
+	}
+	if gd.checkThreshold(WatchdogNativeMemory, &w.above, float64(gap), float64(configs.NativeMemoryDumpConfigs.NativeMemoryThresholdBytes)) {
+		file, err := writeNativeMemoryDump(configs, rss, sample.TotalMemoryBytes)
+		gd.emitDump(WatchdogNativeMemory, file, err)
+	}
+}
+
+// smapsMapping is the resident memory of the mappings of one file, or of the anonymous mappings
+type smapsMapping struct {
+	name     string
+	mappings int
+	rss      uint64
+}
+
+// smapsByMapping sums the Rss lines of an smaps file by mapping name, the biggest mappings first
+func smapsByMapping(r io.Reader) ([]smapsMapping, error) {
+	byName := map[string]*smapsMapping{}
+	var current *smapsMapping
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		// A mapping header starts with its address range, e.g. "7f1c2a000000-7f1c2a021000 rw-p 00000000 00:00 0 [heap]"
+		if strings.Contains(fields[0], "-") && !strings.HasSuffix(fields[0], ":") {
+			name := "[anon]"
+			if len(fields) >= 6 {
+				name = strings.Join(fields[5:], " ")
+			}
+			current = byName[name]
+			if current == nil {
+				current = &smapsMapping{name: name}
+				byName[name] = current
+			}
+			current.mappings++
+			continue
+		}
+		if fields[0] == "Rss:" && current != nil && len(fields) >= 2 {
+			rss, err := parseKB(fields[1])
+			if err != nil {
+				return nil, err
+			}
+			current.rss += rss
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	mappings := make([]smapsMapping, 0, len(byName))
+	for _, mapping := range byName {
+		mappings = append(mappings, *mapping)
+	}
+	sort.Slice(mappings, func(i, j int) bool {
+		if mappings[i].rss != mappings[j].rss {
+			return mappings[i].rss > mappings[j].rss
+		}
+		return mappings[i].name < mappings[j].name
+	})
+	return mappings, nil
+}
+
+// writeNativeMemoryDump writes the resident memory breakdown and returns the path of the file it created
+func writeNativeMemoryDump(goDumpConfigs *GoDumpConfigs, rss uint64, goMemory uint64) (string, error) {
+	var prefix *string
+	if goDumpConfigs.NativeMemoryDumpConfigs != nil {
+		prefix = goDumpConfigs.NativeMemoryDumpConfigs.NativeMemoryDumpPrefix
+	}
+	return writeDumpFile(dumpFilePath(goDumpConfigs, prefix, DefaultNativeMemoryDumpPrefix, ".txt"), func(f *os.File) error {
+		f.WriteString("Native Memory Dump\n---\n")
+		f.WriteString("Time: " + time.Now().Format("2006-01-02T15:04:05") + "\n")
+		f.WriteString("---\n\n")
+		f.WriteString("Resident Memory (VmRSS) bytes: " + fmt.Sprint(rss) + "\n")
+		f.WriteString("Go Runtime Memory (MemStats.Sys) bytes: " + fmt.Sprint(goMemory) + "\n")
+		f.WriteString("Gap bytes: " + fmt.Sprint(max(int64(rss)-int64(goMemory), 0)) + "\n")
+		f.WriteString("---\n\n")
+		f.WriteString("smaps_rollup:\n")
+		if rollup, err := os.ReadFile("/proc/self/smaps_rollup"); err == nil {
+			f.Write(rollup)
+		}
+		f.WriteString("---\n\n")
+		f.WriteString("Resident Memory by Mapping:\n")
+		smaps, err := os.Open("/proc/self/smaps")
+		if err != nil {
+			return err
+		}
+		defer smaps.Close()
+		mappings, err := smapsByMapping(smaps)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(f, "%12s %8s  %s\n", "Rss kB", "Mappings", "Mapping")
+		for _, mapping := range mappings {
+			fmt.Fprintf(f, "%12d %8d  %s\n", mapping.rss/1024, mapping.mappings, mapping.name)
+		}
+		return nil
+	})
+}
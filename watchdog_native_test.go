@@ -0,0 +1,76 @@
+package godump
+
+import (
+	"os"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestSmapsByMapping(t *testing.T) {
+	smaps := `00400000-00452000 r-xp 00000000 08:02 173521 /usr/lib/libfoo.so
+Size:                328 kB
+Rss:                 300 kB
+00652000-00653000 rw-p 00052000 08:02 173521 /usr/lib/libfoo.so
+Rss:                   4 kB
+7f1c2a000000-7f1c2a021000 rw-p 00000000 00:00 0
+Rss:                1024 kB
+VmFlags: rd wr mr mw me ac sd
+7ffd1a2b3000-7ffd1a2d4000 rw-p 00000000 00:00 0 [stack]
+Rss:                  16 kB
+`
+	mappings, err := smapsByMapping(strings.NewReader(smaps))
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	if len(mappings) != 3 {
+		t.Fatalf("Error: Expected 3 mappings, got %+v", mappings)
+	}
+	if mappings[0].name != "[anon]" || mappings[0].rss != 1024*1024 {
+		t.Errorf("Error: Expected the anonymous mapping first, got %+v", mappings[0])
+	}
+	if mappings[1].name != "/usr/lib/libfoo.so" || mappings[1].rss != 304*1024 || mappings[1].mappings != 2 {
+		t.Errorf("Error: Expected the library mappings to be summed, got %+v", mappings[1])
+	}
+}
+
+func TestNativeMemoryWatchdog(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("Skipping: /proc is only available on Linux")
+	}
+	rss := uint64(100 << 20)
+	readRSS = func() (uint64, error) { return rss, nil }
+	t.Cleanup(func() { readRSS = readProcRSS })
+	configs := &GoDumpConfigs{
+		GoDumpNativeMemory:      true,
+		GoDumpPath:              t.TempDir(),
+		WatchdogIntervalMs:      1000,
+		NativeMemoryDumpConfigs: &DumpNativeMemoryConfigs{NativeMemoryThresholdBytes: 64 << 20},
+	}
+	gds, err := NewGoDumpService(configs)
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	var received []Event
+	gds.OnEvent(func(e Event) { received = append(received, e) })
+
+	w := &nativeMemoryWatchdog{}
+	w.check(gds, configs, &Sample{TotalMemoryBytes: 50 << 20})
+	if len(received) != 0 {
+		t.Fatalf("Error: Expected no event under the threshold, got %+v", received)
+	}
+	w.check(gds, configs, &Sample{TotalMemoryBytes: 20 << 20})
+	if len(received) != 2 || received[0].Value != 80<<20 || received[1].Type != EventDumpWritten {
+		t.Fatalf("Error: Expected the gap to fire with a dump, got %+v", received)
+	}
+	dump, err := os.ReadFile(received[1].File)
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	if !strings.Contains(string(dump), "Gap bytes: 83886080") || !strings.Contains(string(dump), "Resident Memory by Mapping:") {
+		t.Errorf("Error: Unexpected dump content %s", dump)
+	}
+	if real, err := readProcRSS(); err != nil || real == 0 {
+		t.Errorf("Error: Expected the resident memory, got %v (%v)", real, err)
+	}
+}
@@ -0,0 +1,215 @@
+package godump
+
+import (
+	"bufio"
+	"fmt"
+	"log/slog"
+	"os"
+	"runtime/pprof"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+/* OS resources watchdog
+ Catches thread leaks (e.g. from blocking cgo calls) and file descriptor leaks (e.g. from unclosed responses)
+ The values are read from the operating system on every sample, Linux only:
+	- OS threads: the Threads line of /proc/self/status
+	- Threads created by the runtime: the count of the threadcreate profile
+	- Open file descriptors: the entries of /proc/self/fd
+ Each value can have a limit and a growth rate per minute, measured over OSGrowthWindowMs
+ When any of them is exceeded a dump with the threadcreate profile and the open file descriptors (with their readlink target) is written
+*/
+
+type DumpOSConfigs struct {
+	ThreadThreshold       uint64  // OS threads of the process, 0 disables it
+	ThreadGrowthPerMinute float64 // 0 disables it
+	ThreadCreateThreshold uint64  // threads created by the runtime since the start, 0 disables it
+	FDThreshold           uint64  // open file descriptors, 0 disables it
+	FDGrowthPerMinute     float64 // 0 disables it
+	OSGrowthWindowMs      uint64  // window the growth rates are measured over, DefaultOSGrowthWindowMs when 0
+	OSDumpPrefix          *string
+}
+
+const (
+	DefaultOSDumpPrefix     = "osdump"
+	DefaultOSGrowthWindowMs = 60000
+)
+
+// Names of the OS resources signals as reported in Event.Watchdog
+const (
+	WatchdogThreads      = "os_threads"
+	WatchdogThreadGrowth = "os_threads_growth_per_minute"
+	WatchdogThreadCreate = "threadcreate"
+	WatchdogFDs          = "fds"
+	WatchdogFDGrowth     = "fds_growth_per_minute"
+	WatchdogOSResources  = "os_resources" // the dump written when any signal fires
+)
+
+// The OS values are read through variables so the tests can replace them
+var (
+	readThreads      = readProcThreads
+	readThreadCreate = func() (uint64, error) { return uint64(pprof.Lookup("threadcreate").Count()), nil }
+	readFDs          = countOpenFDs
+)
+
+// readProcThreads returns the Threads value of /proc/self/status
+func readProcThreads() (uint64, error) {
+	f, err := os.Open("/proc/self/status")
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if value, ok := strings.CutPrefix(scanner.Text(), "Threads:"); ok {
+			return strconv.ParseUint(strings.TrimSpace(value), 10, 64)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return 0, err
+	}
+	return 0, fmt.Errorf("no Threads line in /proc/self/status")
+}
+
+// countOpenFDs returns the number of entries of /proc/self/fd
+func countOpenFDs() (uint64, error) {
+	entries, err := os.ReadDir("/proc/self/fd")
+	if err != nil {
+		return 0, err
+	}
+	// The directory read itself holds a descriptor that is closed by now
+	return uint64(max(len(entries)-1, 0)), nil
+}
+
+// growthWindow keeps the values seen over a window to measure how fast they grow
+type growthWindow struct {
+	times  []time.Time
+	values []float64
+}
+
+// perMinute adds a value and returns its growth per minute over the window, ok is false until the window is covered
+func (g *growthWindow) perMinute(now time.Time, value float64, window time.Duration) (float64, bool) {
+	g.times = append(g.times, now)
+	g.values = append(g.values, value)
+	// Drop the oldest value once the next one covers the window on its own
+	for len(g.times) > 2 && now.Sub(g.times[1]) >= window {
+		g.times, g.values = g.times[1:], g.values[1:]
+	}
+	elapsed := now.Sub(g.times[0])
+	if elapsed < window || elapsed <= 0 {
+		return 0, false
+	}
+	return (value - g.values[0]) / elapsed.Minutes(), true
+}
+
+type osResourcesWatchdog struct {
+	threadGrowth      growthWindow
+	fdGrowth          growthWindow
+	aboveThreads      bool
+	aboveThreadGrowth bool
+	aboveThreadCreate bool
+	aboveFDs          bool
+	aboveFDGrowth     bool
+}
+
+func (w *osResourcesWatchdog) check(gd *GoDumpService, configs *GoDumpConfigs, sample *Sample) {
+	osConfigs := configs.OSDumpConfigs
+	window := time.Duration(osConfigs.OSGrowthWindowMs) * time.Millisecond
+	if window == 0 {
+		window = DefaultOSGrowthWindowMs * time.Millisecond
+	}
+	read := func(name string, reader func() (uint64, error)) (float64, bool) {
+		value, err := reader()
+		if err != nil {
+			gd.logger().Debug("godump could not read the value", slog.String("watchdog", name), slog.Any("error", err))
+			return 0, false
+		}
+		return float64(value), true
+	}
+	fired := false
+	if osConfigs.ThreadThreshold > 0 || osConfigs.ThreadGrowthPerMinute > 0 {
+		if threads, ok := read(WatchdogThreads, readThreads); ok {
+			if osConfigs.ThreadThreshold > 0 {
+				fired = gd.checkThreshold(WatchdogThreads, &w.aboveThreads, threads, float64(osConfigs.ThreadThreshold)) || fired
+			}
+			if growth, ok := w.threadGrowth.perMinute(sample.Time, threads, window); ok && osConfigs.ThreadGrowthPerMinute > 0 {
+				fired = gd.checkThreshold(WatchdogThreadGrowth, &w.aboveThreadGrowth, growth, osConfigs.ThreadGrowthPerMinute) || fired
+			}
+		}
+	}
+	if osConfigs.ThreadCreateThreshold > 0 {
+		if created, ok := read(WatchdogThreadCreate, readThreadCreate); ok {
+			fired = gd.checkThreshold(WatchdogThreadCreate, &w.aboveThreadCreate, created, float64(osConfigs.ThreadCreateThreshold)) || fired
+		}
+	}
+	if osConfigs.FDThreshold > 0 || osConfigs.FDGrowthPerMinute > 0 {
+		if fds, ok := read(WatchdogFDs, readFDs); ok {
+			if osConfigs.FDThreshold > 0 {
+				fired = gd.checkThreshold(WatchdogFDs, &w.aboveFDs, fds, float64(osConfigs.FDThreshold)) || fired
+			}
+			if growth, ok := w.fdGrowth.perMinute(sample.Time, fds, window); ok && osConfigs.FDGrowthPerMinute > 0 {
+				fired = gd.checkThreshold(WatchdogFDGrowth, &w.aboveFDGrowth, growth, osConfigs.FDGrowthPerMinute) || fired
+			}
+		}
+	}
+	if fired {
+		file, err := writeOSDump(configs)
+		gd.emitDump(WatchdogOSResources, file, err)
+	}
+}
+
+// writeOSDump writes the threadcreate profile and the open file descriptors and returns the path of the file it created
+func writeOSDump(goDumpConfigs *GoDumpConfigs) (string, error) {
+	var prefix *string
+	if goDumpConfigs.OSDumpConfigs != nil {
+		prefix = goDumpConfigs.OSDumpConfigs.OSDumpPrefix
+	}
+	return writeDumpFile(dumpFilePath(goDumpConfigs, prefix, DefaultOSDumpPrefix, ".txt"), func(f *os.File) error {
+		f.WriteString("OS Resources Dump\n---\n")
+		f.WriteString("Time: " + time.Now().Format("2006-01-02T15:04:05") + "\n")
+		f.WriteString("---\n\n")
+		if threads, err := readThreads(); err == nil {
+			f.WriteString("Number of OS Threads: " + fmt.Sprint(threads) + "\n")
+		}
+		fds := openFDs()
+		f.WriteString("Number of Open File Descriptors: " + fmt.Sprint(len(fds)) + "\n")
+		f.WriteString("---\n\n")
+		f.WriteString("Thread Creation Profile:\n")
+		if err := pprof.Lookup("threadcreate").WriteTo(f, 1); err != nil {
+			return err
+		}
+		f.WriteString("---\n\n")
+		f.WriteString("Open File Descriptors:\n")
+		for _, fd := range fds {
+			f.WriteString(fd + "\n")
+		}
+		return nil
+	})
+}
+
+// openFDs lists the open file descriptors as "<fd> -> <target>", sorted by descriptor
+func openFDs() []string {
+	entries, err := os.ReadDir("/proc/self/fd")
+	if err != nil {
+		return nil
+	}
+	numbers := make([]int, 0, len(entries))
+	for _, entry := range entries {
+		if n, err := strconv.Atoi(entry.Name()); err == nil {
+			numbers = append(numbers, n)
+		}
+	}
+	sort.Ints(numbers)
+	fds := make([]string, 0, len(numbers))
+	for _, n := range numbers {
+		target, err := os.Readlink("/proc/self/fd/" + strconv.Itoa(n))
+		if err != nil {
+			// The descriptor used to read the directory is already closed
+			continue
+		}
+		fds = append(fds, strconv.Itoa(n)+" -> "+target)
+	}
+	return fds
+}
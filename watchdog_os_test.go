@@ -0,0 +1,92 @@
+package godump
+
+import (
+	"os"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestGrowthWindow(t *testing.T) {
+	g := growthWindow{}
+	now := time.Now()
+	for i := 0; i < 60; i++ {
+		if _, ok := g.perMinute(now.Add(time.Duration(i)*time.Second), float64(i), time.Minute); ok {
+			t.Fatalf("Error: Expected no growth before the window is covered")
+		}
+	}
+	growth, ok := g.perMinute(now.Add(time.Minute), 60, time.Minute)
+	if !ok || growth != 60 {
+		t.Errorf("Error: Expected a growth of 60 per minute, got %v", growth)
+	}
+	// The window slides, only the last minute counts
+	growth, _ = g.perMinute(now.Add(2*time.Minute), 60, time.Minute)
+	if growth > 1 {
+		t.Errorf("Error: Expected the old values to be dropped, got a growth of %v", growth)
+	}
+	if len(g.times) > 62 {
+		t.Errorf("Error: Expected the window to drop old values, kept %v", len(g.times))
+	}
+}
+
+func TestOSResourcesWatchdog(t *testing.T) {
+	threads, fds := uint64(10), uint64(5)
+	readThreads = func() (uint64, error) { return threads, nil }
+	readFDs = func() (uint64, error) { return fds, nil }
+	t.Cleanup(func() {
+		readThreads = readProcThreads
+		readFDs = countOpenFDs
+	})
+	configs := &GoDumpConfigs{
+		GoDumpOS:           true,
+		GoDumpPath:         t.TempDir(),
+		WatchdogIntervalMs: 1000,
+		OSDumpConfigs: &DumpOSConfigs{
+			ThreadThreshold:   100,
+			FDGrowthPerMinute: 30,
+			OSGrowthWindowMs:  10000,
+		},
+	}
+	gds, err := NewGoDumpService(configs)
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	var received []Event
+	gds.OnEvent(func(e Event) { received = append(received, e) })
+
+	w := &osResourcesWatchdog{}
+	now := time.Now()
+	// One descriptor leaked every second is 60 per minute
+	for i := 0; i <= 10; i++ {
+		fds++
+		w.check(gds, configs, &Sample{Time: now.Add(time.Duration(i) * time.Second)})
+	}
+	if len(received) != 2 || received[0].Watchdog != WatchdogFDGrowth || received[0].Value != 60 || received[1].Type != EventDumpWritten {
+		t.Fatalf("Error: Expected the FD growth to fire, got %+v", received)
+	}
+	dump, err := os.ReadFile(received[1].File)
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	if !strings.Contains(string(dump), "Thread Creation Profile:") || !strings.Contains(string(dump), "Open File Descriptors:") {
+		t.Errorf("Error: Unexpected dump content %s", dump)
+	}
+	if runtime.GOOS == "linux" && !strings.Contains(string(dump), " -> ") {
+		t.Errorf("Error: Expected the open file descriptors to be listed, got %s", dump)
+	}
+}
+
+func TestReadProcThreads(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("Skipping: /proc is only available on Linux")
+	}
+	threads, err := readProcThreads()
+	if err != nil || threads == 0 {
+		t.Errorf("Error: Expected the number of threads, got %v (%v)", threads, err)
+	}
+	fds, err := countOpenFDs()
+	if err != nil || fds < 3 {
+		t.Errorf("Error: Expected at least the standard file descriptors, got %v (%v)", fds, err)
+	}
+}
@@ -0,0 +1,86 @@
+package godump
+
+import (
+	"log/slog"
+	"time"
+)
+
+/* Scheduler latency watchdog
+ Catches goroutines that are runnable but do not get scheduled, which neither the goroutine count nor the hang detection notice
+ Two signals are watched, any of them can be disabled by leaving its threshold at 0:
+	- The quantile (p99 by default) of the scheduling latencies added to /sched/latencies:seconds since the previous sample
+	- The ticker lag, how late the sampler itself woke up compared to WatchdogIntervalMs
+ A signal only fires once it stayed above its threshold for SchedSustainedMs, a goroutine dump is then written
+*/
+
+type DumpSchedConfigs struct {
+	SchedLatencyThresholdMs float64 // 0 disables it
+	SchedLatencyQuantile    float64 // quantile of the latencies compared to the threshold, DefaultSchedLatencyQuantile when 0
+	TickerLagThresholdMs    float64 // 0 disables it
+	SchedSustainedMs        uint64  // how long a signal has to stay above its threshold, 0 fires on the first sample above it
+}
+
+const DefaultSchedLatencyQuantile = 0.99
+
+// Names of the scheduler signals as reported in Event.Watchdog
+const (
+	WatchdogSchedLatency = "sched_latency_ms"
+	WatchdogTickerLag    = "ticker_lag_ms"
+	WatchdogScheduler    = "scheduler" // the goroutine dump written when any signal fires
+)
+
+const MetricSchedLatencies = "/sched/latencies:seconds"
+
+// sustainedSignal tracks a value that has to stay above its threshold for some time before it fires
+type sustainedSignal struct {
+	since time.Time // first sample of the current run above the threshold
+	above bool
+}
+
+// check returns true when the signal fires, the events are only emitted once the value was sustained
+func (s *sustainedSignal) check(gd *GoDumpService, name string, now time.Time, value, threshold float64, sustained time.Duration) bool {
+	if value <= threshold {
+		s.since = time.Time{}
+	} else if s.since.IsZero() {
+		s.since = now
+	}
+	if !s.above && value > threshold && now.Sub(s.since) < sustained {
+		gd.logger().Debug("godump threshold exceeded, waiting for it to be sustained",
+			slog.String("watchdog", name), slog.Float64("value", value), slog.Float64("threshold", threshold),
+			slog.Duration("for", now.Sub(s.since)), slog.Duration("sustained", sustained))
+		return false
+	}
+	return gd.checkThreshold(name, &s.above, value, threshold)
+}
+
+type schedulerWatchdog struct {
+	previous *Sample
+	latency  sustainedSignal
+	lag      sustainedSignal
+}
+
+func (w *schedulerWatchdog) check(gd *GoDumpService, configs *GoDumpConfigs, sample *Sample) {
+	previous := w.previous
+	w.previous = sample
+	sched := configs.SchedDumpConfigs
+	sustained := time.Duration(sched.SchedSustainedMs) * time.Millisecond
+	fired := false
+	if sched.SchedLatencyThresholdMs > 0 && previous != nil {
+		quantile := sched.SchedLatencyQuantile
+		if quantile == 0 {
+			quantile = DefaultSchedLatencyQuantile
+		}
+		current, _ := sample.Histogram(MetricSchedLatencies)
+		last, _ := previous.Histogram(MetricSchedLatencies)
+		latency, _ := histogramQuantile(last, current, quantile)
+		latencyMs := latency * float64(time.Second/time.Millisecond)
+		fired = w.latency.check(gd, WatchdogSchedLatency, sample.Time, latencyMs, sched.SchedLatencyThresholdMs, sustained) || fired
+	}
+	if sched.TickerLagThresholdMs > 0 {
+		lagMs := float64(sample.TickerLag) / float64(time.Millisecond)
+		fired = w.lag.check(gd, WatchdogTickerLag, sample.Time, lagMs, sched.TickerLagThresholdMs, sustained) || fired
+	}
+	if fired {
+		gd.takeGoroutineDump(WatchdogScheduler, nil)
+	}
+}
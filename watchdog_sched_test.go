@@ -0,0 +1,67 @@
+package godump
+
+import (
+	"math"
+	"runtime/metrics"
+	"testing"
+	"time"
+)
+
+func schedSample(now time.Time, lag time.Duration, latencies []uint64) *Sample {
+	return &Sample{
+		Time:      now,
+		TickerLag: lag,
+		histograms: map[string]*metrics.Float64Histogram{
+			MetricSchedLatencies: {
+				Counts:  latencies,
+				Buckets: []float64{0, 0.001, 0.01, 0.1, math.Inf(1)},
+			},
+		},
+	}
+}
+
+func TestSchedulerWatchdogSustained(t *testing.T) {
+	configs := &GoDumpConfigs{
+		GoDumpSched:        true,
+		GoDumpPath:         t.TempDir(),
+		WatchdogIntervalMs: 1000,
+		SchedDumpConfigs: &DumpSchedConfigs{
+			SchedLatencyThresholdMs: 5,
+			TickerLagThresholdMs:    50,
+			SchedSustainedMs:        2000,
+		},
+	}
+	gds, err := NewGoDumpService(configs)
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	var received []Event
+	gds.OnEvent(func(e Event) { received = append(received, e) })
+
+	w := &schedulerWatchdog{}
+	now := time.Now()
+	w.check(gds, configs, schedSample(now, 0, []uint64{100, 0, 0, 0}))
+	// Latencies of up to 10ms, not sustained for 2s yet
+	w.check(gds, configs, schedSample(now.Add(time.Second), 0, []uint64{100, 100, 0, 0}))
+	w.check(gds, configs, schedSample(now.Add(2*time.Second), 0, []uint64{100, 200, 0, 0}))
+	if len(received) != 0 {
+		t.Fatalf("Error: Expected no event before the latency is sustained, got %+v", received)
+	}
+	w.check(gds, configs, schedSample(now.Add(3*time.Second), 0, []uint64{100, 300, 0, 0}))
+	if len(received) != 2 || received[0].Watchdog != WatchdogSchedLatency || received[0].Value != 10 || received[1].Type != EventDumpWritten {
+		t.Fatalf("Error: Expected the latency to fire with a goroutine dump, got %+v", received)
+	}
+	received = nil
+	w.check(gds, configs, schedSample(now.Add(4*time.Second), 0, []uint64{200, 300, 0, 0}))
+	if len(received) != 1 || received[0].Type != EventThresholdRecovered || received[0].Watchdog != WatchdogSchedLatency {
+		t.Errorf("Error: Expected the latency to recover, got %+v", received)
+	}
+	// A ticker lag that goes back under its threshold never fires
+	received = nil
+	w.check(gds, configs, schedSample(now.Add(5*time.Second), 100*time.Millisecond, []uint64{300, 300, 0, 0}))
+	w.check(gds, configs, schedSample(now.Add(6*time.Second), 10*time.Millisecond, []uint64{400, 300, 0, 0}))
+	w.check(gds, configs, schedSample(now.Add(7*time.Second), 100*time.Millisecond, []uint64{500, 300, 0, 0}))
+	if len(received) != 0 {
+		t.Errorf("Error: Expected no event for an intermittent ticker lag, got %+v", received)
+	}
+}